@@ -0,0 +1,172 @@
+package raftsqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// The archive is a database file attached to every connection of the
+// store as the archive schema. Its logs table is named after the one of
+// the store and keeps the logs as they were stored, except for their
+// shared payloads, which are copied along with them so the archive
+// doesn't depend on the payloads table of the store, and the logs stored
+// externally, whose data is copied inline so it doesn't depend on the
+// blob directory either.
+
+// errNoArchive is returned when archiving logs from a store without an
+// archive.
+var errNoArchive = errors.New("no archive is configured")
+
+// createArchive creates the logs table of the archive if enabled,
+// switching the archive to the journal mode of the store.
+func (s *SqliteStore) createArchive(ctx context.Context) error {
+	if s.opts.archive == "" || s.opts.readOnly {
+		return nil
+	}
+
+	if _, err := s.db.ExecContext(ctx, "PRAGMA archive.journal_mode="+s.opts.journalMode); err != nil {
+		return fmt.Errorf("setting archive journal mode: %w", err)
+	}
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS archive.%s (idx INTEGER PRIMARY KEY, term INTEGER NOT NULL, data BLOB, crc INTEGER, appended_at INTEGER, blob_file TEXT, payload BLOB)",
+		s.opts.logsTable))
+	if err != nil {
+		return fmt.Errorf("creating archive table: %w", err)
+	}
+	return nil
+}
+
+// ArchiveLogsBefore moves the logs below idx from the store to the
+// archive set with WithArchive, returning how many were moved. The logs
+// are copied and deleted in a single transaction. Under WAL, a crash may
+// leave the copied logs in both databases, in which case archiving them
+// again replaces the copies. The data of the logs stored externally is
+// copied inline into the archive, and their files are removed once the
+// logs are deleted.
+func (s *SqliteStore) ArchiveLogsBefore(idx uint64) (int64, error) {
+	if s.opts.readOnly {
+		return 0, ErrReadOnly
+	}
+	if s.opts.archive == "" {
+		return 0, errNoArchive
+	}
+
+	ctx := context.Background()
+	var archived int64
+	var blobs []string
+	err := s.transaction(func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, fmt.Sprintf(
+			"INSERT OR REPLACE INTO archive.%[1]s (idx, term, data, crc, appended_at, blob_file, payload) "+
+				"SELECT idx, term, data, crc, appended_at, blob_file, (SELECT payload FROM main.%[2]s WHERE hash = payload_hash) "+
+				"FROM main.%[1]s WHERE idx < ?",
+			s.opts.logsTable, s.payloadsTable()), idx)
+		if err != nil {
+			return err
+		}
+		archived, err = res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if archived == 0 {
+			return nil
+		}
+
+		blobs, err = s.inlineArchivedBlobs(ctx, tx, idx)
+		if err != nil {
+			return err
+		}
+		if err := s.releasePayloads(ctx, tx, "idx < ?", idx); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM main.%s WHERE idx < ?", s.opts.logsTable), idx)
+		if err != nil {
+			return err
+		}
+		return s.shrinkBounds(ctx, tx, 0, idx-1)
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.removeBlobs(blobs)
+
+	s.opts.logger.Debug("archived logs", "before", idx, "count", archived)
+	return archived, nil
+}
+
+// inlineArchivedBlobs rewrites the archived copies of the logs below idx
+// stored externally with their data inline, so the archive doesn't
+// depend on the blob directory. It returns the files of the logs, to
+// remove once tx commits.
+func (s *SqliteStore) inlineArchivedBlobs(ctx context.Context, tx *sql.Tx, idx uint64) ([]string, error) {
+	if s.opts.blobDir == "" {
+		return nil, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT idx, blob_file FROM main.%s WHERE blob_file IS NOT NULL AND idx < ?", s.opts.logsTable), idx)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []uint64
+	var blobs []string
+	for rows.Next() {
+		var idx uint64
+		var name string
+		if err := rows.Scan(&idx, &name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		indexes = append(indexes, idx)
+		blobs = append(blobs, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// the logs are rewritten one at a time, so at most one of them is
+	// held in memory
+	for _, idx := range indexes {
+		var data []byte
+		err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT data FROM main.%s WHERE idx = ?", s.opts.logsTable), idx).Scan(&data)
+		if err != nil {
+			return nil, err
+		}
+		var log raft.Log
+		if err := s.decodeLog(data, nil, &log); err != nil {
+			return nil, err
+		}
+		encoded, err := s.encodeInline(&log)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = s.packLog(encoded); err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("UPDATE archive.%s SET data = ?, crc = ?, blob_file = NULL WHERE idx = ?", s.opts.logsTable),
+			data, s.checksum(data), idx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return blobs, nil
+}
+
+// getArchivedLog reads the log at idx from the archive through q into
+// log, or returns raft.ErrLogNotFound if it is not archived either.
+func (s *SqliteStore) getArchivedLog(ctx context.Context, q queryRower, idx uint64, log *raft.Log) error {
+	var data, shared []byte
+	var crc sql.NullInt64
+	err := q.QueryRowContext(ctx, fmt.Sprintf("SELECT data, crc, payload FROM archive.%s WHERE idx = ?", s.opts.logsTable), idx).
+		Scan(&data, &crc, &shared)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return raft.ErrLogNotFound
+		}
+		return err
+	}
+	return s.loadLog(idx, data, crc, shared, log)
+}
@@ -0,0 +1,125 @@
+package raftsqlite
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestArchiveLogsBefore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStoreWithOptions(dir+"/raft.db", WithArchive(dir+"/archive.db"))
+	assertNoError(t, err)
+	defer store.Close()
+
+	storeLogRange(t, store, 1, 100, "log")
+
+	archived, err := store.ArchiveLogsBefore(51)
+	assertNoError(t, err)
+	assert(t, archived == 50, fmt.Sprintf("want 50 logs archived, got: %d", archived))
+	_, err = os.Stat(dir + "/archive.db")
+	assertNoError(t, err)
+
+	first, err := store.FirstIndex()
+	assertNoError(t, err)
+	assert(t, first == 51, fmt.Sprintf("want first index 51, got: %d", first))
+	count, err := store.CountLogs()
+	assertNoError(t, err)
+	assert(t, count == 50, fmt.Sprintf("want 50 logs, got: %d", count))
+
+	// the archived logs are still readable, from the archive
+	log := new(raft.Log)
+	for _, idx := range []uint64{1, 25, 50, 51, 100} {
+		err = store.GetLog(idx, log)
+		assertNoError(t, err)
+		assert(t, log.Index == idx && string(log.Data) == "log", fmt.Sprintf("want log %d, got: %d %q", idx, log.Index, log.Data))
+	}
+	err = store.GetLog(101, log)
+	assert(t, errors.Is(err, raft.ErrLogNotFound), fmt.Sprintf("want log not found err, got: %v", err))
+
+	// and from a point in time reader
+	err = store.ReadSnapshot(func(r Reader) error {
+		for _, idx := range []uint64{1, 50, 51} {
+			if err := r.GetLog(idx, log); err != nil {
+				return err
+			}
+			assert(t, log.Index == idx, fmt.Sprintf("want log %d, got: %d", idx, log.Index))
+		}
+		err := r.GetLog(101, log)
+		assert(t, errors.Is(err, raft.ErrLogNotFound), fmt.Sprintf("want log not found err, got: %v", err))
+		return nil
+	})
+	assertNoError(t, err)
+
+	// nothing left to archive
+	archived, err = store.ArchiveLogsBefore(51)
+	assertNoError(t, err)
+	assert(t, archived == 0, fmt.Sprintf("want no logs archived, got: %d", archived))
+
+	// the archive is attached again once reopened
+	err = store.Close()
+	assertNoError(t, err)
+	store, err = NewStoreWithOptions(dir+"/raft.db", WithArchive(dir+"/archive.db"))
+	assertNoError(t, err)
+	err = store.GetLog(10, log)
+	assertNoError(t, err)
+	assert(t, log.Index == 10, fmt.Sprintf("want log 10, got: %d", log.Index))
+}
+
+func TestArchiveLogsBeforeIndirect(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStoreWithOptions(dir+"/raft.db",
+		WithArchive(dir+"/archive.db"), WithPayloadDedup(true), WithExternalBlobDir(dir+"/blobs", 512))
+	assertNoError(t, err)
+	defer store.Close()
+
+	// shared payloads and external files on both sides of the archived
+	// range
+	storeLogRange(t, store, 1, 10, "shared")
+	storeLogRange(t, store, 11, 20, strings.Repeat("x", 1024))
+
+	archived, err := store.ArchiveLogsBefore(6)
+	assertNoError(t, err)
+	assert(t, archived == 5, fmt.Sprintf("want 5 logs archived, got: %d", archived))
+	refs := payloadRefs(t, store)
+	assert(t, len(refs) == 1 && refs[0] == 5, fmt.Sprintf("want one payload with 5 refs, got: %v", refs))
+
+	archived, err = store.ArchiveLogsBefore(16)
+	assertNoError(t, err)
+	assert(t, archived == 10, fmt.Sprintf("want 10 logs archived, got: %d", archived))
+	refs = payloadRefs(t, store)
+	assert(t, len(refs) == 0, fmt.Sprintf("want no shared payloads, got: %v", refs))
+	// the archived logs are inlined, their files are removed
+	files := blobDirFiles(t, dir+"/blobs")
+	assert(t, len(files) == 5, fmt.Sprintf("want 5 external files, got: %d", len(files)))
+
+	log := new(raft.Log)
+	for idx := uint64(1); idx <= 20; idx++ {
+		err = store.GetLog(idx, log)
+		assertNoError(t, err)
+		want := "shared"
+		if idx > 10 {
+			want = strings.Repeat("x", 1024)
+		}
+		assert(t, string(log.Data) == want, fmt.Sprintf("want data of log %d, got: %q", idx, log.Data))
+	}
+}
+
+func TestArchiveLogsBeforeDisabled(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 10, "log")
+	_, err := store.ArchiveLogsBefore(5)
+	assert(t, err != nil, "want error without an archive")
+
+	_, err = NewStoreFromDB(store.db, WithArchive(t.TempDir()+"/archive.db"))
+	assert(t, err != nil, "want error for an archive on an existing handle")
+}
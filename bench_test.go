@@ -1,46 +1,50 @@
 package raftsqlite
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
 	"testing"
 
 	"github.com/hashicorp/raft"
 	raftbench "github.com/hashicorp/raft/bench"
 )
 
-func benchRunLog(b *testing.B, f func(*testing.B, raft.LogStore)) {
-	store := mustSqliteDiskStore(b)
-	defer func() {
-		store.Close()
-		store.deleteDB()
-	}()
-
-	inmem := mustSqliteInMemoryStore(b)
-	defer inmem.Close()
+// The raft benchmarks store the same indexes on every run, and b.Run may
+// invoke the function several times, so each invocation gets a fresh
+// store to avoid duplicate index errors.
 
+func benchRunLog(b *testing.B, f func(*testing.B, raft.LogStore)) {
 	b.Run("disk", func(b *testing.B) {
+		store := mustSqliteDiskStore(b)
+		defer func() {
+			store.Close()
+			store.deleteDB()
+		}()
 		f(b, store)
 	})
 
 	b.Run("memory", func(b *testing.B) {
+		inmem := mustSqliteInMemoryStore(b)
+		defer inmem.Close()
 		f(b, inmem)
 	})
 }
 
 func benchRunStable(b *testing.B, f func(*testing.B, raft.StableStore)) {
-	store := mustSqliteDiskStore(b)
-	defer func() {
-		store.Close()
-		store.deleteDB()
-	}()
-
-	inmem := mustSqliteInMemoryStore(b)
-	defer inmem.Close()
-
 	b.Run("disk", func(b *testing.B) {
+		store := mustSqliteDiskStore(b)
+		defer func() {
+			store.Close()
+			store.deleteDB()
+		}()
 		f(b, store)
 	})
 
 	b.Run("memory", func(b *testing.B) {
+		inmem := mustSqliteInMemoryStore(b)
+		defer inmem.Close()
 		f(b, inmem)
 	})
 }
@@ -57,6 +61,47 @@ func BenchmarkGetLog(b *testing.B) {
 	benchRunLog(b, raftbench.GetLog)
 }
 
+func BenchmarkGetLogConcurrent(b *testing.B) {
+	modes := map[string][]Option{
+		"writeconn": {func(o *options) { o.readPoolSize = 0 }},
+		"readpool":  nil,
+	}
+	for _, name := range []string{"writeconn", "readpool"} {
+		opts := modes[name]
+		b.Run(name, func(b *testing.B) {
+			store, err := NewStoreWithOptions(b.TempDir()+"/raft.db", opts...)
+			assertNoError(b, err)
+			defer func() {
+				store.Close()
+				store.deleteDB()
+			}()
+			storeLogRange(b, store, 1, 1000, "data")
+
+			var next atomic.Uint64
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				log := new(raft.Log)
+				for pb.Next() {
+					err := store.GetLog(next.Add(1)%1000+1, log)
+					assertNoError(b, err)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkGetLogMmap(b *testing.B) {
+	store, err := NewStoreWithOptions(b.TempDir()+"/raft.db", WithMmapSize(256<<20))
+	assertNoError(b, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	raftbench.GetLog(b, store)
+}
+
 func BenchmarkStoreLog(b *testing.B) {
 	benchRunLog(b, raftbench.StoreLog)
 }
@@ -65,6 +110,111 @@ func BenchmarkStoreLogs(b *testing.B) {
 	benchRunLog(b, raftbench.StoreLogs)
 }
 
+func BenchmarkInsertLogs(b *testing.B) {
+	inserts := map[string]func(*SqliteStore, context.Context, *sql.Tx, []*raft.Log) error{
+		"loop": (*SqliteStore).insertLogsLoop,
+		"multirow": func(s *SqliteStore, ctx context.Context, tx *sql.Tx, logs []*raft.Log) error {
+			return s.insertLogs(ctx, tx, logs, nil)
+		},
+	}
+	for _, batch := range []int{100, 1000} {
+		for _, name := range []string{"loop", "multirow"} {
+			insert := inserts[name]
+			b.Run(fmt.Sprintf("%s/%d", name, batch), func(b *testing.B) {
+				store := mustSqliteDiskStore(b)
+				defer func() {
+					store.Close()
+					store.deleteDB()
+				}()
+
+				logs := make([]*raft.Log, batch)
+				for i := range logs {
+					logs[i] = createRaftLog(0, "data")
+				}
+
+				b.ResetTimer()
+				for n := 0; n < b.N; n++ {
+					for i, log := range logs {
+						log.Index = uint64(n*batch + i + 1)
+					}
+					err := store.transaction(func(tx *sql.Tx) error {
+						return insert(store, context.Background(), tx, logs)
+					})
+					assertNoError(b, err)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkStoreLogsConcurrent(b *testing.B) {
+	modes := map[string][]Option{
+		"default":     {WithSynchronous("full")},
+		"groupcommit": {WithSynchronous("full"), WithGroupCommit(64, 0)},
+	}
+	for _, name := range []string{"default", "groupcommit"} {
+		opts := modes[name]
+		b.Run(name, func(b *testing.B) {
+			store, err := NewStoreWithOptions(b.TempDir()+"/raft.db", opts...)
+			assertNoError(b, err)
+			defer func() {
+				store.Close()
+				store.deleteDB()
+			}()
+
+			var next atomic.Uint64
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					err := store.StoreLog(createRaftLog(next.Add(1), "data"))
+					assertNoError(b, err)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkBulkLoad(b *testing.B) {
+	const total, batch = 100_000, 1000
+
+	restore := func(store *SqliteStore) error {
+		logs := make([]*raft.Log, batch)
+		for first := 1; first <= total; first += batch {
+			for i := range logs {
+				logs[i] = createRaftLog(uint64(first+i), "data")
+			}
+			if err := store.StoreLogs(logs); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, bulk := range []bool{false, true} {
+		b.Run(fmt.Sprintf("bulk=%v", bulk), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				b.StopTimer()
+				store := mustSqliteDiskStore(b)
+				b.StartTimer()
+
+				var err error
+				if bulk {
+					err = store.BulkLoad(func() error { return restore(store) })
+				} else {
+					err = restore(store)
+				}
+				assertNoError(b, err)
+
+				b.StopTimer()
+				store.Close()
+				store.deleteDB()
+				b.StartTimer()
+			}
+		})
+	}
+}
+
 func BenchmarkDeleteRange(b *testing.B) {
 	benchRunLog(b, raftbench.DeleteRange)
 }
@@ -0,0 +1,186 @@
+package raftsqlite
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/raft"
+)
+
+// externalMarker prefixes the log blobs whose data is stored in a file of
+// the blob directory. Like compressedMarker, it can't start a msgpack,
+// json or gob encoded log, msgpack only uses it for nil.
+const externalMarker = 0xc0
+
+// errNoBlobDir is returned when reading a log stored externally from a
+// store without a blob directory.
+var errNoBlobDir = errors.New("log data is stored externally but no blob directory is configured")
+
+// errBlobDirCopy is returned when copying the database of a store with a
+// blob directory, which the copy would not include.
+var errBlobDirCopy = errors.New("the database can't be copied without its external blob directory")
+
+// externalizeLog writes the data of log to a new file of the blob
+// directory if it is over the threshold, returning the blob standing for
+// the log before compression and the name of the file. The blob holds the
+// log without its data, following the marker, the checksum of the file
+// and its name. An empty name means the log is kept inline and the blob
+// is nil.
+func (s *SqliteStore) externalizeLog(log *raft.Log) ([]byte, string, error) {
+	if s.opts.blobDir == "" || len(log.Data) <= s.opts.blobThreshold {
+		return nil, "", nil
+	}
+
+	stripped := *log
+	stripped.Data = nil
+	encoded, err := s.opts.encoding.Encode(&stripped)
+	if err != nil {
+		return nil, "", err
+	}
+	if size := len(encoded) + len(log.Data); s.opts.maxValueSize > 0 && size > s.opts.maxValueSize {
+		return nil, "", fmt.Errorf("%w: log %d of %d bytes is over %d", ErrValueTooLarge, log.Index, size, s.opts.maxValueSize)
+	}
+
+	contents, err := s.seal(log.Data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// a random suffix keeps a failed or concurrent write of the same
+	// index from replacing the file of a stored log
+	var token [8]byte
+	if _, err := rand.Read(token[:]); err != nil {
+		return nil, "", err
+	}
+	name := fmt.Sprintf("%020d-%x.blob", log.Index, token)
+	if err := s.writeBlob(name, contents); err != nil {
+		return nil, "", fmt.Errorf("writing external data of log %d: %w", log.Index, err)
+	}
+
+	data := make([]byte, 0, 1+4+binary.MaxVarintLen64+len(name)+len(encoded))
+	data = append(data, externalMarker)
+	data = binary.BigEndian.AppendUint32(data, crc32.Checksum(contents, castagnoli))
+	data = binary.AppendUvarint(data, uint64(len(name)))
+	data = append(data, name...)
+	data = append(data, encoded...)
+	return data, name, nil
+}
+
+// writeBlob durably writes a file of the blob directory, so it is never
+// missing once the row referencing it commits.
+func (s *SqliteStore) writeBlob(name string, contents []byte) error {
+	if err := os.MkdirAll(s.opts.blobDir, s.opts.dirPerm); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.opts.blobDir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, s.opts.fileMode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(contents); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// persist the directory entry as well
+	dir, err := os.Open(s.opts.blobDir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// decodeExternalLog decodes a blob written by externalizeLog into log,
+// reading its data back from the blob directory.
+func (s *SqliteStore) decodeExternalLog(data []byte, log *raft.Log) error {
+	if s.opts.blobDir == "" {
+		return errNoBlobDir
+	}
+
+	data = data[1:]
+	if len(data) < 4 {
+		return errors.New("truncated external log")
+	}
+	crc := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	n, read := binary.Uvarint(data)
+	if read <= 0 || uint64(len(data)-read) < n {
+		return errors.New("truncated external log")
+	}
+	name := string(data[read : read+int(n)])
+	if err := s.opts.encoding.Decode(data[read+int(n):], log); err != nil {
+		return err
+	}
+
+	contents, err := os.ReadFile(filepath.Join(s.opts.blobDir, name))
+	if err != nil {
+		return fmt.Errorf("reading external data of log %d: %w", log.Index, err)
+	}
+	if s.opts.checksums && crc32.Checksum(contents, castagnoli) != crc {
+		return fmt.Errorf("%w: external data of index %d", ErrLogCorrupted, log.Index)
+	}
+	log.Data, err = s.open(contents)
+	return err
+}
+
+// blobRef returns the value of the blob_file column for the file name of
+// an externalized log.
+func blobRef(name string) any {
+	if name == "" {
+		return nil
+	}
+	return name
+}
+
+// blobFiles returns the files of the externalized logs matching where
+// within tx, so they can be removed once their rows are deleted.
+func (s *SqliteStore) blobFiles(ctx context.Context, tx *sql.Tx, where string, args ...any) ([]string, error) {
+	if s.opts.blobDir == "" {
+		return nil, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT blob_file FROM %s WHERE blob_file IS NOT NULL AND %s", s.opts.logsTable, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// removeBlobs removes files of the blob directory. They are no longer
+// referenced, so failing to remove them only wastes space.
+func (s *SqliteStore) removeBlobs(names []string) {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		err := os.Remove(filepath.Join(s.opts.blobDir, name))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.opts.logger.Warn("removing external log data failed", "file", name, "error", err)
+		}
+	}
+}
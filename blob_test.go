@@ -0,0 +1,167 @@
+package raftsqlite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// blobDirFiles returns the names of the files in dir.
+func blobDirFiles(t testing.TB, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestWithExternalBlobDir(t *testing.T) {
+	dir := t.TempDir()
+	blobDir := filepath.Join(dir, "blobs")
+	store, err := NewStoreWithOptions(filepath.Join(dir, "raft.db"), WithExternalBlobDir(blobDir, 1024))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	large := bytes.Repeat([]byte("payload "), 8192)
+	err = store.StoreLogs([]*raft.Log{
+		{Index: 1, Term: 1, Data: []byte("small")},
+		{Index: 2, Term: 1, Data: large},
+		{Index: 3, Term: 1, Data: []byte("small")},
+	})
+	assertNoError(t, err)
+
+	// only the large payload is moved out of the database
+	var rowSize int
+	var blobFile *string
+	err = store.db.QueryRow("SELECT LENGTH(data), blob_file FROM logs WHERE idx = 2").Scan(&rowSize, &blobFile)
+	assertNoError(t, err)
+	assert(t, rowSize < 1024, fmt.Sprintf("want a small row, got: %d bytes", rowSize))
+	assert(t, blobFile != nil, "want the row to reference its file")
+	assert(t, fileSize(t, filepath.Join(blobDir, *blobFile)) == int64(len(large)), "want the payload in the external file")
+	var inline int
+	err = store.db.QueryRow("SELECT COUNT(*) FROM logs WHERE blob_file IS NULL").Scan(&inline)
+	assertNoError(t, err)
+	assert(t, inline == 2, fmt.Sprintf("want 2 inline logs, got: %d", inline))
+
+	log := new(raft.Log)
+	err = store.GetLog(2, log)
+	assertNoError(t, err)
+	assert(t, log.Index == 2 && log.Term == 1 && bytes.Equal(log.Data, large), "want the external payload read back")
+
+	logs, err := store.GetLogs(1, 3)
+	assertNoError(t, err)
+	assert(t, len(logs) == 3 && bytes.Equal(logs[1].Data, large), "want the external payload read back by range")
+
+	// a corrupted file is detected
+	path := filepath.Join(blobDir, *blobFile)
+	err = os.WriteFile(path, bytes.Repeat([]byte("x"), len(large)), 0o600)
+	assertNoError(t, err)
+	err = store.GetLog(2, log)
+	assert(t, errors.Is(err, ErrLogCorrupted), fmt.Sprintf("want log corrupted err, got: %v", err))
+
+	repaired, removed, err := store.RepairCorrupted(func(idx uint64) (*raft.Log, error) {
+		return &raft.Log{Index: idx, Term: 1, Data: large}, nil
+	})
+	assertNoError(t, err)
+	assert(t, repaired == 1 && removed == 0, fmt.Sprintf("want 1 repaired, got: %d and %d", repaired, removed))
+	files := blobDirFiles(t, blobDir)
+	assert(t, len(files) == 1 && files[0] != *blobFile, fmt.Sprintf("want the corrupted file replaced, got: %v", files))
+	err = store.GetLog(2, log)
+	assertNoError(t, err)
+	assert(t, bytes.Equal(log.Data, large), "want the repaired payload read back")
+
+	// deleting the log removes its file
+	err = store.DeleteRange(1, 2)
+	assertNoError(t, err)
+	files = blobDirFiles(t, blobDir)
+	assert(t, len(files) == 0, fmt.Sprintf("want no external files, got: %v", files))
+}
+
+func TestWithExternalBlobDirEncrypted(t *testing.T) {
+	enc, err := NewAESGCMEncryptor(bytes.Repeat([]byte{1}, 32))
+	assertNoError(t, err)
+
+	dir := t.TempDir()
+	blobDir := filepath.Join(dir, "blobs")
+	path := filepath.Join(dir, "raft.db")
+	store, err := NewStoreWithOptions(path, WithExternalBlobDir(blobDir, 16), WithEncryptor(enc))
+	assertNoError(t, err)
+
+	secret := []byte("an external payload that must be encrypted")
+	err = store.StoreLog(&raft.Log{Index: 1, Term: 1, Data: secret})
+	assertNoError(t, err)
+
+	files := blobDirFiles(t, blobDir)
+	assert(t, len(files) == 1, fmt.Sprintf("want 1 external file, got: %v", files))
+	contents, err := os.ReadFile(filepath.Join(blobDir, files[0]))
+	assertNoError(t, err)
+	assert(t, !bytes.Contains(contents, secret), "want the external file encrypted")
+
+	log := new(raft.Log)
+	err = store.GetLog(1, log)
+	assertNoError(t, err)
+	assert(t, bytes.Equal(log.Data, secret), fmt.Sprintf("want %q, got: %q", secret, log.Data))
+	store.Close()
+
+	// the logs stored externally can't be read without the directory
+	store, err = NewStoreWithOptions(path, WithEncryptor(enc))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+	err = store.GetLog(1, log)
+	assert(t, errors.Is(err, errNoBlobDir), fmt.Sprintf("want no blob dir err, got: %v", err))
+}
+
+func TestWithExternalBlobDirUpsert(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithGroupCommit(4, time.Millisecond)}} {
+		dir := t.TempDir()
+		blobDir := filepath.Join(dir, "blobs")
+		opts = append(opts, WithExternalBlobDir(blobDir, 16), WithUpsertLogs(true))
+		store, err := NewStoreWithOptions(filepath.Join(dir, "raft.db"), opts...)
+		assertNoError(t, err)
+
+		storeLogRange(t, store, 1, 3, strings.Repeat("a", 32))
+		storeLogRange(t, store, 2, 3, strings.Repeat("b", 32))
+
+		// the files of the replaced logs are removed
+		files := blobDirFiles(t, blobDir)
+		assert(t, len(files) == 3, fmt.Sprintf("want 3 external files, got: %v", files))
+		log := new(raft.Log)
+		err = store.GetLog(3, log)
+		assertNoError(t, err)
+		assert(t, string(log.Data) == strings.Repeat("b", 32), fmt.Sprintf("want the replacing data, got: %q", log.Data))
+		store.Close()
+	}
+}
+
+func TestWithExternalBlobDirBackup(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStoreWithOptions(filepath.Join(dir, "raft.db"), WithExternalBlobDir(filepath.Join(dir, "blobs"), 16))
+	assertNoError(t, err)
+	defer store.Close()
+
+	err = store.Backup(filepath.Join(dir, "backup.db"))
+	assert(t, errors.Is(err, errBlobDirCopy), fmt.Sprintf("want blob dir copy err, got: %v", err))
+	err = store.VacuumInto(filepath.Join(dir, "backup.db"))
+	assert(t, errors.Is(err, errBlobDirCopy), fmt.Sprintf("want blob dir copy err, got: %v", err))
+	_, err = os.Stat(filepath.Join(dir, "backup.db"))
+	assert(t, errors.Is(err, os.ErrNotExist), "want no backup written")
+}
@@ -0,0 +1,85 @@
+package raftsqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// BootstrapCluster seeds a new cluster the way raft.BootstrapCluster does
+// on the storage side: it sets the current term to 1 and writes
+// configuration as the log at index 1, so a node started on the store
+// picks it up. Both are written in a single transaction. It returns
+// raft.ErrCantBootstrap if the store holds logs or a current term
+// already. Unlike raft.BootstrapCluster, snapshots are not looked at, the
+// store doesn't know which snapshot store the node uses.
+func (s *SqliteStore) BootstrapCluster(configuration raft.Configuration) error {
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+	if err := checkConfiguration(configuration); err != nil {
+		return err
+	}
+
+	log := &raft.Log{
+		Index: 1,
+		Term:  1,
+		Type:  raft.LogConfiguration,
+		Data:  raft.EncodeConfiguration(configuration),
+	}
+	ctx := context.Background()
+	return s.transaction(func(tx *sql.Tx) error {
+		_, last, err := s.bounds(ctx, tx)
+		if err != nil {
+			return err
+		}
+		term, _, err := s.getTx(tx, keyCurrentTerm)
+		if err != nil {
+			return err
+		}
+		if last != 0 || (term != nil && bytesToUint64(term) != 0) {
+			return raft.ErrCantBootstrap
+		}
+
+		if err := s.setTx(tx, keyCurrentTerm, uint64ToBytes(1)); err != nil {
+			return err
+		}
+		// the log is empty, so no log is replaced
+		_, err = s.storeLogsTx(ctx, tx, []*raft.Log{log})
+		return err
+	})
+}
+
+// checkConfiguration checks the configuration to bootstrap a cluster with,
+// as raft does before bootstrapping.
+func checkConfiguration(configuration raft.Configuration) error {
+	ids := make(map[raft.ServerID]bool)
+	addresses := make(map[raft.ServerAddress]bool)
+	var voters int
+	for _, server := range configuration.Servers {
+		if server.ID == "" {
+			return fmt.Errorf("empty ID in configuration: %v", configuration)
+		}
+		if server.Address == "" {
+			return fmt.Errorf("empty address in configuration: %v", server)
+		}
+		if ids[server.ID] {
+			return fmt.Errorf("found duplicate ID in configuration: %v", server.ID)
+		}
+		ids[server.ID] = true
+		if addresses[server.Address] {
+			return fmt.Errorf("found duplicate address in configuration: %v", server.Address)
+		}
+		addresses[server.Address] = true
+		if server.Suffrage == raft.Voter {
+			voters++
+		}
+	}
+	if voters == 0 {
+		return errors.New("need at least one voter in configuration")
+	}
+	return nil
+}
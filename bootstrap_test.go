@@ -0,0 +1,107 @@
+package raftsqlite
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func testConfiguration() raft.Configuration {
+	return raft.Configuration{Servers: []raft.Server{
+		{Suffrage: raft.Voter, ID: "node1", Address: "127.0.0.1:7001"},
+		{Suffrage: raft.Voter, ID: "node2", Address: "127.0.0.1:7002"},
+		{Suffrage: raft.Nonvoter, ID: "node3", Address: "127.0.0.1:7003"},
+	}}
+}
+
+func TestBootstrapCluster(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	configuration := testConfiguration()
+	err := store.BootstrapCluster(configuration)
+	assertNoError(t, err)
+
+	term, err := store.CurrentTerm()
+	assertNoError(t, err)
+	assert(t, term == 1, fmt.Sprintf("want term 1, got: %d", term))
+
+	log := new(raft.Log)
+	err = store.GetLog(1, log)
+	assertNoError(t, err)
+	assert(t, log.Type == raft.LogConfiguration, fmt.Sprintf("want a configuration log, got: %s", log.Type))
+	assert(t, log.Term == 1, fmt.Sprintf("want term 1, got: %d", log.Term))
+	got := raft.DecodeConfiguration(log.Data)
+	assert(t, len(got.Servers) == 3, fmt.Sprintf("want 3 servers, got: %v", got.Servers))
+	for i, server := range got.Servers {
+		assert(t, server == configuration.Servers[i], fmt.Sprintf("want server %v, got: %v", configuration.Servers[i], server))
+	}
+
+	// raft sees the bootstrapped store as existing state
+	exists, err := raft.HasExistingState(store, store, raft.NewInmemSnapshotStore())
+	assertNoError(t, err)
+	assert(t, exists, "want existing state")
+
+	err = store.BootstrapCluster(configuration)
+	assert(t, errors.Is(err, raft.ErrCantBootstrap), fmt.Sprintf("want can't bootstrap err, got: %v", err))
+}
+
+func TestBootstrapClusterPopulated(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 5, 10, "log")
+	err := store.BootstrapCluster(testConfiguration())
+	assert(t, errors.Is(err, raft.ErrCantBootstrap), fmt.Sprintf("want can't bootstrap err, got: %v", err))
+	first, err := store.FirstIndex()
+	assertNoError(t, err)
+	assert(t, first == 5, fmt.Sprintf("want first index 5, got: %d", first))
+
+	// a current term without logs is existing state as well
+	other := mustSqliteDiskStore(t)
+	defer func() {
+		other.Close()
+		other.deleteDB()
+	}()
+	err = other.SetCurrentTerm(3)
+	assertNoError(t, err)
+	err = other.BootstrapCluster(testConfiguration())
+	assert(t, errors.Is(err, raft.ErrCantBootstrap), fmt.Sprintf("want can't bootstrap err, got: %v", err))
+	last, err := other.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 0, fmt.Sprintf("want no logs, got last index: %d", last))
+}
+
+func TestBootstrapClusterInvalidConfiguration(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	configurations := []raft.Configuration{
+		{},
+		{Servers: []raft.Server{{Suffrage: raft.Nonvoter, ID: "node1", Address: "127.0.0.1:7001"}}},
+		{Servers: []raft.Server{
+			{Suffrage: raft.Voter, ID: "node1", Address: "127.0.0.1:7001"},
+			{Suffrage: raft.Voter, ID: "node1", Address: "127.0.0.1:7002"},
+		}},
+		{Servers: []raft.Server{{Suffrage: raft.Voter, ID: "node1"}}},
+	}
+	for _, configuration := range configurations {
+		err := store.BootstrapCluster(configuration)
+		assert(t, err != nil, fmt.Sprintf("want error for configuration %v", configuration))
+	}
+
+	last, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 0, fmt.Sprintf("want no logs, got last index: %d", last))
+}
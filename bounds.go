@@ -0,0 +1,90 @@
+package raftsqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// ErrNonMonotonic is returned by StoreLogs in strict monotonic mode when
+// the logs don't strictly follow the last stored index.
+var ErrNonMonotonic = errors.New("log index is not monotonic")
+
+// The first and last log indexes are persisted in a single row table,
+// named after the logs table with a _bounds suffix, so FirstIndex and
+// LastIndex don't need to look at the logs table. Both columns are NULL
+// while the log is empty. The row must be kept in sync by every
+// statement that inserts or deletes logs, in the same transaction.
+
+// queryRower is implemented by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// boundsTable returns the name of the table holding the log bounds.
+func (s *SqliteStore) boundsTable() string {
+	return s.opts.logsTable + "_bounds"
+}
+
+// bounds returns the first and last log indexes, or zeroes for an empty
+// log.
+func (s *SqliteStore) bounds(ctx context.Context, q queryRower) (first, last uint64, err error) {
+	err = q.QueryRowContext(ctx, fmt.Sprintf("SELECT IFNULL(first_index, 0), IFNULL(last_index, 0) FROM %s", s.boundsTable())).
+		Scan(&first, &last)
+	return first, last, err
+}
+
+// extendBounds widens the log bounds to include the indexes in
+// [min, max] after they have been inserted.
+func (s *SqliteStore) extendBounds(ctx context.Context, tx *sql.Tx, min, max uint64) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET first_index = IFNULL(MIN(first_index, ?1), ?1), last_index = IFNULL(MAX(last_index, ?2), ?2)",
+		s.boundsTable()), min, max)
+	return err
+}
+
+// shrinkBounds updates the log bounds after the indexes in [min, max]
+// have been deleted. They are only recomputed from the logs table when
+// the deleted range covers the current first or last index.
+func (s *SqliteStore) shrinkBounds(ctx context.Context, tx *sql.Tx, min, max uint64) error {
+	first, last, err := s.bounds(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if first == 0 && last == 0 {
+		return nil
+	}
+	if (first < min || first > max) && (last < min || last > max) {
+		return nil
+	}
+	return s.recomputeBounds(ctx, tx)
+}
+
+// recomputeBounds sets the log bounds from the contents of the logs
+// table.
+func (s *SqliteStore) recomputeBounds(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %[1]s SET first_index = (SELECT MIN(idx) FROM %[2]s), last_index = (SELECT MAX(idx) FROM %[2]s)",
+		s.boundsTable(), s.opts.logsTable))
+	return err
+}
+
+// checkMonotonic verifies that the indexes of logs are strictly
+// increasing and past the current last index, unless the log is empty.
+func (s *SqliteStore) checkMonotonic(ctx context.Context, tx *sql.Tx, logs []*raft.Log) error {
+	_, last, err := s.bounds(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	for i, log := range logs {
+		if (i > 0 || last != 0) && log.Index <= last {
+			return fmt.Errorf("%w: index %d does not follow %d", ErrNonMonotonic, log.Index, last)
+		}
+		last = log.Index
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package raftsqlite
+
+import (
+	"fmt"
+	"testing"
+)
+
+// assertBounds checks the persisted bounds against the expected values
+// and against a full scan of the logs table.
+func assertBounds(t *testing.T, store *SqliteStore, wantFirst, wantLast uint64) {
+	t.Helper()
+
+	first, err := store.FirstIndex()
+	assertNoError(t, err)
+	last, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, first == wantFirst, fmt.Sprintf("want first index %d, got: %d", wantFirst, first))
+	assert(t, last == wantLast, fmt.Sprintf("want last index %d, got: %d", wantLast, last))
+
+	var scanFirst, scanLast uint64
+	err = store.db.QueryRow("SELECT IFNULL(MIN(idx), 0), IFNULL(MAX(idx), 0) FROM logs").Scan(&scanFirst, &scanLast)
+	assertNoError(t, err)
+	assert(t, first == scanFirst, fmt.Sprintf("want first index %d from scan, got: %d", scanFirst, first))
+	assert(t, last == scanLast, fmt.Sprintf("want last index %d from scan, got: %d", scanLast, last))
+}
+
+func TestBounds(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	assertBounds(t, store, 0, 0)
+
+	storeLogRange(t, store, 10, 20, "log")
+	assertBounds(t, store, 10, 20)
+
+	// out of order appends extend both ends
+	storeLogRange(t, store, 5, 5, "log")
+	storeLogRange(t, store, 30, 30, "log")
+	assertBounds(t, store, 5, 30)
+
+	// a delete in the middle keeps the bounds
+	err := store.DeleteRange(12, 14)
+	assertNoError(t, err)
+	assertBounds(t, store, 5, 30)
+
+	// shrink from the front, across the gap
+	err = store.DeleteRange(1, 12)
+	assertNoError(t, err)
+	assertBounds(t, store, 15, 30)
+
+	// shrink from the back, across the gap
+	err = store.DeleteRange(20, 40)
+	assertNoError(t, err)
+	assertBounds(t, store, 15, 19)
+
+	// delete outside of the bounds
+	err = store.DeleteRange(100, 200)
+	assertNoError(t, err)
+	assertBounds(t, store, 15, 19)
+
+	err = store.DeleteRange(0, 100)
+	assertNoError(t, err)
+	assertBounds(t, store, 0, 0)
+
+	storeLogRange(t, store, 50, 52, "log")
+	assertBounds(t, store, 50, 52)
+}
+
+func TestMigrateBounds(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStore(path)
+	assertNoError(t, err)
+	storeLogRange(t, store, 3, 7, "log")
+
+	// downgrade the database to the schema before the persisted bounds
+	downgradeSchema(t, store, 4)
+	store.Close()
+
+	store, err = NewStore(path)
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	assertBounds(t, store, 3, 7)
+}
@@ -0,0 +1,101 @@
+package raftsqlite
+
+import (
+	"context"
+	"fmt"
+)
+
+// validCheckpointMode reports whether mode is a wal_checkpoint mode.
+func validCheckpointMode(mode string) bool {
+	switch mode {
+	case "passive", "full", "restart", "truncate":
+		return true
+	}
+	return false
+}
+
+// checkpoint runs a WAL checkpoint in the given mode, one of passive,
+// full, restart or truncate. It is a no-op if the database is not in WAL
+// mode.
+func (s *SqliteStore) checkpoint(mode string) error {
+	return s.checkpointCtx(context.Background(), mode)
+}
+
+// checkpointCtx is like checkpoint, but honors the given context.
+func (s *SqliteStore) checkpointCtx(ctx context.Context, mode string) error {
+	_, err := s.walCheckpoint(ctx, mode)
+	return err
+}
+
+// walCheckpoint runs a WAL checkpoint in the given mode, reporting
+// whether every frame of the WAL was checkpointed. Only a passive
+// checkpoint may leave frames behind without failing, the other modes
+// wait for the readers pinning them.
+func (s *SqliteStore) walCheckpoint(ctx context.Context, mode string) (complete bool, err error) {
+	var busy, log, checkpointed int
+	err = s.withReconnect(func() error {
+		return s.db.QueryRowContext(ctx, fmt.Sprintf("PRAGMA wal_checkpoint(%s)", mode)).Scan(&busy, &log, &checkpointed)
+	})
+	if err != nil {
+		return false, err
+	}
+	if busy != 0 {
+		return false, fmt.Errorf("wal checkpoint(%s) could not complete, %d of %d frames checkpointed", mode, checkpointed, log)
+	}
+
+	s.opts.logger.Debug("wal checkpoint", "mode", mode, "frames", log, "checkpointed", checkpointed)
+	return log == checkpointed, nil
+}
+
+// Sync copies the contents of the write-ahead log back into the database
+// file and syncs it to disk, waiting for concurrent writers and readers
+// as needed. Under WAL with synchronous=normal, the default, commits are
+// not synced until a checkpoint, so a power loss may roll back the most
+// recent ones. Sync guarantees that everything committed before it is
+// durable, at the cost of blocking the writers and an fsync of the
+// database file, so it is best reserved for critical moments rather than
+// called after every write.
+func (s *SqliteStore) Sync() error {
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+	return s.checkpoint("full")
+}
+
+// Checkpoint runs a WAL checkpoint in the given mode, one of passive,
+// full, restart or truncate, see the sqlite documentation of
+// wal_checkpoint. Passive checkpoints as much as possible without
+// waiting, the other modes wait for the writers and readers, returning
+// an error if they couldn't complete. It is a no-op if the database is
+// not in WAL mode.
+func (s *SqliteStore) Checkpoint(mode string) error {
+	if !validCheckpointMode(mode) {
+		return fmt.Errorf("invalid checkpoint mode %q", mode)
+	}
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+	return s.checkpoint(mode)
+}
+
+// Flush blocks until every write that returned successfully before it was
+// called is durable, returning an error if it can't be guaranteed, such
+// as when the store is closed. Writes are currently committed before they
+// return, so Flush runs a passive checkpoint, which syncs the WAL to disk
+// before copying it back into the database file as far as it can without
+// waiting for readers. If readers keep some of the WAL from being copied
+// back, the sync is not guaranteed, so Flush falls back to a full
+// checkpoint, waiting for them up to the busy timeout. Callers that need
+// durability at a given point should rely on Flush rather than on the
+// current write path, which may buffer writes in the future.
+func (s *SqliteStore) Flush(ctx context.Context) error {
+	if s.opts.readOnly {
+		// nothing was written, only check that the store is usable
+		return s.Ping(ctx)
+	}
+	complete, err := s.walCheckpoint(ctx, "passive")
+	if err != nil || complete {
+		return err
+	}
+	return s.checkpointCtx(ctx, "full")
+}
@@ -0,0 +1,143 @@
+package raftsqlite
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestSync(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 10, "log")
+	err := store.Sync()
+	assertNoError(t, err)
+
+	// a copy of the database file alone, as left behind by a crash that
+	// lost the WAL, must hold the synced logs
+	data, err := os.ReadFile(store.path)
+	assertNoError(t, err)
+	path := filepath.Join(t.TempDir(), "copy.db")
+	err = os.WriteFile(path, data, 0o600)
+	assertNoError(t, err)
+
+	restarted, err := NewStore(path)
+	assertNoError(t, err)
+	defer restarted.Close()
+
+	last, err := restarted.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 10, fmt.Sprintf("want last index 10, got: %d", last))
+
+	log := new(raft.Log)
+	err = restarted.GetLog(10, log)
+	assertNoError(t, err)
+	assert(t, string(log.Data) == "log", fmt.Sprintf("want data log, got: %s", log.Data))
+}
+
+func TestCheckpoint(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 10, "log")
+	for _, mode := range []string{"passive", "full", "restart", "truncate"} {
+		err := store.Checkpoint(mode)
+		assertNoError(t, err)
+	}
+	assert(t, fileSize(t, store.path+"-wal") == 0, "want wal truncated")
+
+	err := store.Checkpoint("full); DROP TABLE logs; --")
+	assert(t, err != nil, "want error for invalid checkpoint mode")
+}
+
+func TestFlush(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer store.deleteDB()
+
+	storeLogRange(t, store, 1, 10, "log")
+	err := store.Flush(context.Background())
+	assertNoError(t, err)
+
+	// a passive checkpoint copies the whole WAL when nothing is reading
+	var busy, log, checkpointed int
+	err = store.db.QueryRow("PRAGMA wal_checkpoint(PASSIVE)").Scan(&busy, &log, &checkpointed)
+	assertNoError(t, err)
+	assert(t, log == checkpointed, fmt.Sprintf("want the whole wal checkpointed, got %d of %d frames", checkpointed, log))
+
+	store.Close()
+	err = store.Flush(context.Background())
+	assert(t, err != nil, "want error flushing a closed store")
+}
+
+func TestFlushPinnedByReader(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithBusyTimeout(50*time.Millisecond))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 10, "log")
+	err = store.ReadSnapshot(func(r Reader) error {
+		// the reader pins the WAL as of its first read
+		if _, err := r.LastIndex(); err != nil {
+			return err
+		}
+		storeLogRange(t, store, 11, 20, "log")
+
+		// the frames of the write can't be checkpointed while it reads
+		err := store.Flush(context.Background())
+		assert(t, err != nil, "want error flushing a WAL pinned by a reader")
+		return nil
+	})
+	assertNoError(t, err)
+
+	err = store.Flush(context.Background())
+	assertNoError(t, err)
+	var busy, log, checkpointed int
+	err = store.db.QueryRow("PRAGMA wal_checkpoint(PASSIVE)").Scan(&busy, &log, &checkpointed)
+	assertNoError(t, err)
+	assert(t, log == checkpointed, fmt.Sprintf("want the whole wal checkpointed, got %d of %d frames", checkpointed, log))
+}
+
+func TestWithAutoCheckpoint(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	h := &capturingHandler{}
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithAutoCheckpoint(10*time.Millisecond, "passive"), WithLogger(slog.New(h)))
+	assertNoError(t, err)
+	defer store.deleteDB()
+
+	storeLogRange(t, store, 1, 10, "log")
+	deadline := time.Now().Add(5 * time.Second)
+	for !h.has(slog.LevelDebug, "wal checkpoint") {
+		assert(t, time.Now().Before(deadline), "want a checkpoint to run")
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	err = store.Close()
+	assertNoError(t, err)
+
+	// the pool goroutines may take a moment to exit after Close
+	for runtime.NumGoroutine() > goroutines {
+		assert(t, time.Now().Before(deadline), fmt.Sprintf("want %d goroutines after close, got: %d", goroutines, runtime.NumGoroutine()))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithAutoCheckpoint(time.Second, "sometimes"))
+	assert(t, err != nil, "want error for invalid auto checkpoint mode")
+}
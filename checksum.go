@@ -0,0 +1,185 @@
+package raftsqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+
+	"github.com/hashicorp/raft"
+)
+
+// ErrLogCorrupted is returned when a stored log does not match its
+// checksum.
+var ErrLogCorrupted = errors.New("log is corrupted")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// checksum returns the value stored in the crc column for a log blob, or
+// nil if checksums are disabled.
+func (s *SqliteStore) checksum(data []byte) any {
+	if !s.opts.checksums {
+		return nil
+	}
+	return int64(crc32.Checksum(data, castagnoli))
+}
+
+// verifyChecksum checks the blob of the log at idx against its stored
+// checksum. Logs stored without a checksum are not verified.
+func (s *SqliteStore) verifyChecksum(idx uint64, data []byte, crc sql.NullInt64) error {
+	if !s.opts.checksums || !crc.Valid {
+		return nil
+	}
+	if uint32(crc.Int64) != crc32.Checksum(data, castagnoli) {
+		return fmt.Errorf("%w: index %d", ErrLogCorrupted, idx)
+	}
+	return nil
+}
+
+// RepairCorrupted scans every log for checksum mismatches, including the
+// data of the logs stored externally or deduplicated, and fixes the
+// corrupted ones, calling replace with their index to fetch a correct
+// copy, such as from another node. A nil log from replace deletes the
+// corrupted one instead, leaving a gap the operator can fill later, and
+// so does a nil replace for every corrupted log. If replace fails the
+// store is left untouched. The fixes are applied in a single
+// transaction, returning how many logs were repaired and removed. Logs
+// stored without a checksum are not verified.
+func (s *SqliteStore) RepairCorrupted(replace func(idx uint64) (*raft.Log, error)) (repaired, removed int, err error) {
+	if s.opts.readOnly {
+		return 0, 0, ErrReadOnly
+	}
+	if !s.opts.checksums {
+		return 0, 0, errors.New("checksums are disabled")
+	}
+
+	corrupted, err := s.corruptedLogs()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(corrupted) == 0 {
+		return 0, 0, nil
+	}
+
+	// fetch the replacements before writing, they may take a while
+	replacements := make([]*raft.Log, len(corrupted))
+	if replace != nil {
+		for i, idx := range corrupted {
+			log, err := replace(idx)
+			if err != nil {
+				return 0, 0, fmt.Errorf("replacing log %d: %w", idx, err)
+			}
+			if log != nil && log.Index != idx {
+				return 0, 0, fmt.Errorf("replacement for log %d has index %d", idx, log.Index)
+			}
+			replacements[i] = log
+		}
+	}
+
+	// encoded once, as the transaction may be retried
+	encoded := make([]*encodedLog, len(corrupted))
+	newBlobs := make([]string, len(corrupted))
+	for i, log := range replacements {
+		if log == nil {
+			continue
+		}
+		if encoded[i], err = s.encodeLog(log); err != nil {
+			s.removeBlobs(newBlobs)
+			return 0, 0, err
+		}
+		newBlobs[i] = encoded[i].blobFile
+	}
+
+	ctx := context.Background()
+	var oldBlobs []string
+	defer s.logCache.remove(corrupted...)
+	err = s.transaction(func(tx *sql.Tx) error {
+		repaired, removed, oldBlobs = 0, 0, nil
+		for i, idx := range corrupted {
+			blobs, err := s.releaseLogs(ctx, tx, "idx = ?", idx)
+			if err != nil {
+				return err
+			}
+			oldBlobs = append(oldBlobs, blobs...)
+
+			log := replacements[i]
+			if log == nil {
+				if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE idx = ?", s.opts.logsTable), idx); err != nil {
+					return err
+				}
+				removed++
+				continue
+			}
+
+			enc := encoded[i]
+			_, err = tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET term = ?, data = ?, crc = ?, blob_file = ?, payload_hash = ? WHERE idx = ?", s.opts.logsTable),
+				log.Term, enc.data, s.checksum(enc.data), blobRef(enc.blobFile), payloadRef(enc.payloadHash), idx)
+			if err != nil {
+				return err
+			}
+			if enc.payloadHash != nil {
+				if err := s.retainPayload(ctx, tx, enc.payloadHash, enc.payload); err != nil {
+					return err
+				}
+			}
+			repaired++
+		}
+
+		if removed == 0 {
+			return nil
+		}
+		return s.recomputeBounds(ctx, tx)
+	})
+	if err != nil {
+		s.removeBlobs(newBlobs)
+		return 0, 0, err
+	}
+	s.removeBlobs(oldBlobs)
+
+	s.opts.logger.Warn("repaired corrupted logs", "repaired", repaired, "removed", removed)
+	return repaired, removed, nil
+}
+
+// corruptedLogs returns the indexes of the logs not matching their
+// checksum, in ascending order. The logs stored externally or
+// deduplicated are corrupted as well if their data is missing or doesn't
+// match its own checksum.
+func (s *SqliteStore) corruptedLogs() ([]uint64, error) {
+	tx, err := s.beginRead(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	// nothing to commit, the transaction only provides a stable view
+	defer tx.Rollback()
+
+	rows, err := tx.Query(fmt.Sprintf("SELECT idx, %s, blob_file IS NOT NULL OR payload_hash IS NOT NULL FROM %s WHERE crc IS NOT NULL ORDER BY idx ASC",
+		s.logColumns(), s.opts.logsTable))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var corrupted []uint64
+	for rows.Next() {
+		var idx uint64
+		var data, shared []byte
+		var crc sql.NullInt64
+		var indirect bool
+		if err := rows.Scan(&idx, &data, &crc, &shared, &indirect); err != nil {
+			return nil, err
+		}
+		if err := s.verifyChecksum(idx, data, crc); err != nil {
+			corrupted = append(corrupted, idx)
+			continue
+		}
+		if indirect {
+			err := s.decodeLog(data, shared, new(raft.Log))
+			if errors.Is(err, ErrLogCorrupted) || errors.Is(err, fs.ErrNotExist) {
+				corrupted = append(corrupted, idx)
+			}
+		}
+	}
+	return corrupted, rows.Err()
+}
@@ -0,0 +1,112 @@
+package raftsqlite
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+// corruptLog flips a bit of the stored blob of the log at idx.
+func corruptLog(t testing.TB, store *SqliteStore, idx uint64) {
+	t.Helper()
+
+	var data []byte
+	err := store.db.QueryRow("SELECT data FROM logs WHERE idx = ?", idx).Scan(&data)
+	assertNoError(t, err)
+
+	data[len(data)-1] ^= 0x01
+	_, err = store.db.Exec("UPDATE logs SET data = ? WHERE idx = ?", data, idx)
+	assertNoError(t, err)
+}
+
+func TestChecksums(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 3, "log")
+	corruptLog(t, store, 2)
+
+	err := store.GetLog(1, new(raft.Log))
+	assertNoError(t, err)
+
+	err = store.GetLog(2, new(raft.Log))
+	assert(t, errors.Is(err, ErrLogCorrupted), fmt.Sprintf("want log corrupted err, got: %v", err))
+
+	_, err = store.GetLogs(1, 3)
+	assert(t, errors.Is(err, ErrLogCorrupted), fmt.Sprintf("want log corrupted err, got: %v", err))
+}
+
+func TestChecksumsDisabled(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithChecksums(false))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err = store.StoreLog(createRaftLog(1, "log1"))
+	assertNoError(t, err)
+
+	var crcs int
+	err = store.db.QueryRow("SELECT COUNT(crc) FROM logs").Scan(&crcs)
+	assertNoError(t, err)
+	assert(t, crcs == 0, fmt.Sprintf("want no checksums stored, got: %d", crcs))
+}
+
+func TestRepairCorrupted(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 5, "log")
+	corruptLog(t, store, 2)
+	corruptLog(t, store, 5)
+
+	var asked []uint64
+	repaired, removed, err := store.RepairCorrupted(func(idx uint64) (*raft.Log, error) {
+		asked = append(asked, idx)
+		if idx == 2 {
+			return createRaftLog(2, "fixed"), nil
+		}
+		return nil, nil
+	})
+	assertNoError(t, err)
+	assert(t, fmt.Sprint(asked) == "[2 5]", fmt.Sprintf("want replacements asked for [2 5], got: %v", asked))
+	assert(t, repaired == 1 && removed == 1, fmt.Sprintf("want 1 repaired and 1 removed, got: %d and %d", repaired, removed))
+
+	log := new(raft.Log)
+	err = store.GetLog(2, log)
+	assertNoError(t, err)
+	assert(t, string(log.Data) == "fixed", fmt.Sprintf("want fixed data, got: %s", log.Data))
+
+	err = store.GetLog(5, new(raft.Log))
+	assert(t, errors.Is(err, raft.ErrLogNotFound), fmt.Sprintf("want log not found err, got: %v", err))
+	last, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 4, fmt.Sprintf("want last index 4, got: %d", last))
+
+	_, err = store.GetLogs(1, 4)
+	assertNoError(t, err)
+
+	// nothing left to repair
+	repaired, removed, err = store.RepairCorrupted(nil)
+	assertNoError(t, err)
+	assert(t, repaired == 0 && removed == 0, fmt.Sprintf("want nothing repaired, got: %d and %d", repaired, removed))
+
+	// a failing replacement leaves the store untouched
+	corruptLog(t, store, 3)
+	errFetch := errors.New("fetch failed")
+	_, _, err = store.RepairCorrupted(func(idx uint64) (*raft.Log, error) {
+		return nil, errFetch
+	})
+	assert(t, errors.Is(err, errFetch), fmt.Sprintf("want fetch err, got: %v", err))
+	err = store.GetLog(3, new(raft.Log))
+	assert(t, errors.Is(err, ErrLogCorrupted), fmt.Sprintf("want log corrupted err, got: %v", err))
+}
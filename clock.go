@@ -0,0 +1,17 @@
+package raftsqlite
+
+import "time"
+
+// Clock is the source of the current time for the store, used for the
+// key expirations, the time logs are stored at and the snapshot IDs.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// realClock is the Clock backed by time.Now.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,53 @@
+package raftsqlite
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced time source.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1700000000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestWithClock(t *testing.T) {
+	clock := newFakeClock()
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithClock(clock))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err = store.StoreLog(createRaftLog(1, "log1"))
+	assertNoError(t, err)
+	clock.Advance(time.Minute)
+	storeLogRange(t, store, 2, 3, "log")
+
+	want := map[uint64]time.Time{1: clock.Now().Add(-time.Minute), 2: clock.Now(), 3: clock.Now()}
+	for idx, at := range want {
+		var appendedAt int64
+		err = store.db.QueryRow("SELECT appended_at FROM logs WHERE idx = ?", idx).Scan(&appendedAt)
+		assertNoError(t, err)
+		assert(t, appendedAt == at.UnixNano(), fmt.Sprintf("want log %d appended at %d, got: %d", idx, at.UnixNano(), appendedAt))
+	}
+}
@@ -0,0 +1,124 @@
+package raftsqlite
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// compressedMarker prefixes the log blobs compressed with a Codec. It is
+// never used by msgpack, and can't start a json or gob encoded value
+// either, so it can't be mistaken for the first byte of an uncompressed
+// log.
+const compressedMarker = 0xc1
+
+// errNoCodec is returned when reading a compressed log from a store
+// without a Codec.
+var errNoCodec = errors.New("log is compressed but no codec is configured")
+
+// Codec compresses the encoded logs before they are written to the
+// database.
+type Codec interface {
+	// Compress returns the compressed form of src.
+	Compress(src []byte) ([]byte, error)
+
+	// Decompress reverses Compress.
+	Decompress(src []byte) ([]byte, error)
+}
+
+// encodedLog is a log as stored in the database.
+type encodedLog struct {
+	// data is the blob of the logs table.
+	data []byte
+
+	// blobFile is the file of the blob directory holding the data of
+	// the log, if it is stored externally.
+	blobFile string
+
+	// payloadHash and payload are the key and the sealed contents of the
+	// data of the log in the payloads table, if it is deduplicated.
+	payloadHash, payload []byte
+}
+
+// encodeLog returns log as stored in the database. The data of the log is
+// stored externally or deduplicated if enabled, then the blob is
+// compressed and encrypted, if a Codec or an Encryptor are set. The
+// maximum value size applies to the encoded log, before compression.
+func (s *SqliteStore) encodeLog(log *raft.Log) (*encodedLog, error) {
+	enc := new(encodedLog)
+	data, name, err := s.externalizeLog(log)
+	if err != nil {
+		return nil, err
+	}
+	enc.blobFile = name
+	if name == "" {
+		data, enc.payloadHash, enc.payload, err = s.shareLog(log)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if data == nil {
+		data, err = s.encodeInline(log)
+		if err != nil {
+			return nil, err
+		}
+		if s.opts.maxValueSize > 0 && len(data) > s.opts.maxValueSize {
+			return nil, fmt.Errorf("%w: log %d of %d bytes is over %d", ErrValueTooLarge, log.Index, len(data), s.opts.maxValueSize)
+		}
+	}
+
+	enc.data, err = s.packLog(data)
+	if err != nil {
+		s.removeBlobs([]string{name})
+		return nil, err
+	}
+	return enc, nil
+}
+
+// packLog compresses and encrypts the blob of an encoded log, if a Codec
+// or an Encryptor are set.
+func (s *SqliteStore) packLog(data []byte) ([]byte, error) {
+	if s.opts.codec != nil {
+		compressed, err := s.opts.codec.Compress(data)
+		if err != nil {
+			return nil, err
+		}
+		data = append([]byte{compressedMarker}, compressed...)
+	}
+	return s.seal(data)
+}
+
+// decodeLog reverses encodeLog, given the shared payload of the log read
+// along with its blob. Logs stored without compression are decoded
+// regardless of the configured Codec.
+func (s *SqliteStore) decodeLog(data, shared []byte, log *raft.Log) error {
+	data, err := s.open(data)
+	if err != nil {
+		return err
+	}
+
+	if len(data) > 0 && data[0] == compressedMarker {
+		if s.opts.codec == nil {
+			return errNoCodec
+		}
+
+		var err error
+		data, err = s.opts.codec.Decompress(data[1:])
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(data) > 0 {
+		switch data[0] {
+		case externalMarker:
+			return s.decodeExternalLog(data, log)
+		case sharedMarker:
+			return s.decodeSharedLog(data, shared, log)
+		case customMarker:
+			data = data[1:]
+		}
+	}
+	return s.opts.encoding.Decode(data, log)
+}
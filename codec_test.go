@@ -0,0 +1,97 @@
+package raftsqlite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+type gzipCodec struct{}
+
+func (gzipCodec) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func rawLogSize(t testing.TB, store *SqliteStore, idx uint64) int {
+	t.Helper()
+
+	var data []byte
+	err := store.db.QueryRow("SELECT data FROM logs WHERE idx = ?", idx).Scan(&data)
+	assertNoError(t, err)
+	return len(data)
+}
+
+func TestWithCompression(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	plain, err := NewStore(path)
+	assertNoError(t, err)
+
+	payload := strings.Repeat("compressible ", 100)
+	err = plain.StoreLog(createRaftLog(1, payload))
+	assertNoError(t, err)
+	plain.Close()
+
+	store, err := NewStoreWithOptions(path, WithCompression(gzipCodec{}))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err = store.StoreLogs([]*raft.Log{
+		createRaftLog(2, payload),
+		createRaftLog(3, payload),
+	})
+	assertNoError(t, err)
+
+	plainSize, compressedSize := rawLogSize(t, store, 1), rawLogSize(t, store, 2)
+	assert(t, compressedSize < plainSize, fmt.Sprintf("want compressed blob smaller than %d bytes, got: %d", plainSize, compressedSize))
+
+	// both the uncompressed and compressed logs are readable
+	logs, err := store.GetLogs(1, 3)
+	assertNoError(t, err)
+	for _, log := range logs {
+		assert(t, string(log.Data) == payload, fmt.Sprintf("log %d payload mismatch", log.Index))
+	}
+}
+
+func TestCompressedLogWithoutCodec(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStoreWithOptions(path, WithCompression(gzipCodec{}))
+	assertNoError(t, err)
+	err = store.StoreLog(createRaftLog(1, "log1"))
+	assertNoError(t, err)
+	store.Close()
+
+	store, err = NewStore(path)
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err = store.GetLog(1, new(raft.Log))
+	assert(t, err == errNoCodec, fmt.Sprintf("want no codec err, got: %v", err))
+}
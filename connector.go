@@ -0,0 +1,92 @@
+package raftsqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+)
+
+// registeredDriver returns the driver registered as driverName. It is
+// looked up through database/sql rather than instantiated, so the
+// connections share any hooks or functions registered on it.
+var registeredDriver = sync.OnceValue(func() driver.Driver {
+	// sql.Open only fails for unknown drivers, and the driver is
+	// registered by its import
+	db, _ := sql.Open(driverName, "")
+	defer db.Close()
+	return db.Driver()
+})
+
+// dsnConnector is a driver.Connector opening connections to a fixed DSN,
+// the same way sql.Open does for drivers without their own connector.
+type dsnConnector struct {
+	dsn string
+
+	// pragmas are applied to every new connection, without the PRAGMA
+	// keyword.
+	pragmas []string
+
+	// archive is the database file attached to every new connection as
+	// the archive schema, if set.
+	archive string
+}
+
+// openDB returns a handle to the database at dsn, opening connections
+// through a connector which applies pragmas to each one of them.
+func openDB(dsn string, pragmas ...string) *sql.DB {
+	return sql.OpenDB(dsnConnector{dsn: normalizeDSN(dsn), pragmas: pragmas})
+}
+
+// openStoreDB is like openDB, but also attaches the archive of the store
+// to each connection.
+func (s *SqliteStore) openStoreDB(dsn string, pragmas ...string) *sql.DB {
+	return sql.OpenDB(dsnConnector{dsn: normalizeDSN(dsn), pragmas: pragmas, archive: s.opts.archive})
+}
+
+// Connect opens a new connection. The drivers don't support canceling
+// the open itself, so the context is only checked beforehand.
+func (c dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	conn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	for _, pragma := range c.pragmas {
+		if err := execConn(ctx, conn, "PRAGMA "+pragma); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if c.archive != "" {
+		if err := execConn(ctx, conn, "ATTACH DATABASE "+quoteString(c.archive)+" AS archive"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Driver returns the underlying driver.
+func (c dsnConnector) Driver() driver.Driver {
+	return registeredDriver()
+}
+
+// execConn runs query, which takes no arguments, on conn.
+func execConn(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		return err
+	}
+
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(nil)
+	return err
+}
@@ -0,0 +1,142 @@
+package raftsqlite
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// sharedMarker prefixes the log blobs whose data is shared through the
+// payloads table. Like compressedMarker, it can't start a msgpack, json
+// or gob encoded log, msgpack only uses it for false.
+const sharedMarker = 0xc2
+
+// payloadsTable returns the name of the table holding the shared log
+// payloads, keyed by their SHA-256 and counting the logs referencing
+// them.
+func (s *SqliteStore) payloadsTable() string {
+	return s.opts.logsTable + "_payloads"
+}
+
+// logColumns returns the columns selected to load a log: its blob, its
+// checksum and its shared payload, NULL unless deduplicated.
+func (s *SqliteStore) logColumns() string {
+	return fmt.Sprintf("data, crc, (SELECT payload FROM %s WHERE hash = payload_hash)", s.payloadsTable())
+}
+
+// shareLog returns the blob standing for log before compression when its
+// data is deduplicated, which holds the log without its data following
+// the marker and the hash of the data, along with that hash and the
+// sealed data to store in the payloads table. A nil blob means the data
+// is kept with the log.
+func (s *SqliteStore) shareLog(log *raft.Log) (data, hash, payload []byte, err error) {
+	if !s.opts.dedupPayloads || len(log.Data) == 0 {
+		return nil, nil, nil, nil
+	}
+
+	stripped := *log
+	stripped.Data = nil
+	encoded, err := s.opts.encoding.Encode(&stripped)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if size := len(encoded) + len(log.Data); s.opts.maxValueSize > 0 && size > s.opts.maxValueSize {
+		return nil, nil, nil, fmt.Errorf("%w: log %d of %d bytes is over %d", ErrValueTooLarge, log.Index, size, s.opts.maxValueSize)
+	}
+
+	sum := sha256.Sum256(log.Data)
+	payload, err = s.seal(log.Data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	data = make([]byte, 0, 1+len(sum)+len(encoded))
+	data = append(data, sharedMarker)
+	data = append(data, sum[:]...)
+	data = append(data, encoded...)
+	return data, sum[:], payload, nil
+}
+
+// decodeSharedLog decodes a blob written by shareLog into log, along with
+// its shared payload.
+func (s *SqliteStore) decodeSharedLog(data, shared []byte, log *raft.Log) error {
+	data = data[1:]
+	if len(data) < sha256.Size {
+		return errors.New("truncated shared log")
+	}
+	hash := data[:sha256.Size]
+	if err := s.opts.encoding.Decode(data[sha256.Size:], log); err != nil {
+		return err
+	}
+
+	if shared == nil {
+		return fmt.Errorf("%w: shared payload of index %d is missing", ErrLogCorrupted, log.Index)
+	}
+	payload, err := s.open(shared)
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(payload); s.opts.checksums && !bytes.Equal(sum[:], hash) {
+		return fmt.Errorf("%w: shared payload of index %d", ErrLogCorrupted, log.Index)
+	}
+	log.Data = payload
+	return nil
+}
+
+// payloadRef returns the value of the payload_hash column for the hash
+// of a deduplicated log.
+func payloadRef(hash []byte) any {
+	if hash == nil {
+		return nil
+	}
+	return hash
+}
+
+// retainPayload stores payload under hash within tx, or takes another
+// reference to it if it is already stored.
+func (s *SqliteStore) retainPayload(ctx context.Context, tx *sql.Tx, hash, payload []byte) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (hash, payload, refs) VALUES (?, ?, 1) ON CONFLICT (hash) DO UPDATE SET refs = refs + 1",
+		s.payloadsTable()), hash, payload)
+	return err
+}
+
+// releasePayloads drops the references of the logs matching where to
+// their shared payloads within tx, before the logs are deleted or
+// replaced, removing the payloads no longer referenced.
+func (s *SqliteStore) releasePayloads(ctx context.Context, tx *sql.Tx, where string, args ...any) error {
+	// nothing to release, which spares a scan of the logs for the
+	// stores not deduplicating their payloads
+	var shared bool
+	err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s)", s.payloadsTable())).Scan(&shared)
+	if err != nil || !shared {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %[1]s SET refs = refs - released.n FROM "+
+			"(SELECT payload_hash, COUNT(*) AS n FROM %[2]s WHERE payload_hash IS NOT NULL AND %[3]s GROUP BY payload_hash) AS released "+
+			"WHERE %[1]s.hash = released.payload_hash",
+		s.payloadsTable(), s.opts.logsTable, where), args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE refs <= 0", s.payloadsTable()))
+	return err
+}
+
+// releaseLogs releases what the logs matching where reference outside of
+// their row within tx, before they are deleted or replaced. It returns
+// the files of the blob directory to remove once tx commits.
+func (s *SqliteStore) releaseLogs(ctx context.Context, tx *sql.Tx, where string, args ...any) ([]string, error) {
+	if err := s.releasePayloads(ctx, tx, where, args...); err != nil {
+		return nil, err
+	}
+	return s.blobFiles(ctx, tx, where, args...)
+}
@@ -0,0 +1,107 @@
+package raftsqlite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+// payloadRefs returns the reference count of every shared payload of the
+// default store.
+func payloadRefs(t testing.TB, store *SqliteStore) []int {
+	t.Helper()
+
+	rows, err := store.db.Query("SELECT refs FROM logs_payloads ORDER BY refs")
+	assertNoError(t, err)
+	defer rows.Close()
+
+	var refs []int
+	for rows.Next() {
+		var n int
+		assertNoError(t, rows.Scan(&n))
+		refs = append(refs, n)
+	}
+	assertNoError(t, rows.Err())
+	return refs
+}
+
+func TestWithPayloadDedup(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithPayloadDedup(true))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	payload := bytes.Repeat([]byte("heartbeat"), 100)
+	for first := uint64(1); first <= 100; first += 25 {
+		logs := make([]*raft.Log, 0, 25)
+		for idx := first; idx < first+25; idx++ {
+			logs = append(logs, &raft.Log{Index: idx, Term: 1, Data: payload})
+		}
+		err = store.StoreLogs(logs)
+		assertNoError(t, err)
+	}
+
+	refs := payloadRefs(t, store)
+	assert(t, fmt.Sprint(refs) == "[100]", fmt.Sprintf("want a single payload with 100 refs, got: %v", refs))
+
+	// the payload is no longer stored with the logs
+	var rowSize int
+	err = store.db.QueryRow("SELECT MAX(LENGTH(data)) FROM logs").Scan(&rowSize)
+	assertNoError(t, err)
+	assert(t, rowSize < len(payload), fmt.Sprintf("want rows smaller than the payload, got: %d bytes", rowSize))
+
+	log := new(raft.Log)
+	err = store.GetLog(42, log)
+	assertNoError(t, err)
+	assert(t, log.Index == 42 && bytes.Equal(log.Data, payload), "want the shared payload read back")
+	logs, err := store.GetLogs(1, 100)
+	assertNoError(t, err)
+	assert(t, len(logs) == 100 && bytes.Equal(logs[99].Data, payload), "want the shared payload read back by range")
+
+	err = store.DeleteRange(1, 40)
+	assertNoError(t, err)
+	refs = payloadRefs(t, store)
+	assert(t, fmt.Sprint(refs) == "[60]", fmt.Sprintf("want 60 refs left, got: %v", refs))
+
+	err = store.DeleteRange(41, 100)
+	assertNoError(t, err)
+	refs = payloadRefs(t, store)
+	assert(t, len(refs) == 0, fmt.Sprintf("want no payload left, got: %v", refs))
+}
+
+func TestWithPayloadDedupUpsert(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithPayloadDedup(true), WithUpsertLogs(true))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 3, "noop")
+	refs := payloadRefs(t, store)
+	assert(t, fmt.Sprint(refs) == "[3]", fmt.Sprintf("want a single payload with 3 refs, got: %v", refs))
+
+	// replacing the logs moves their references
+	err = store.StoreLogs([]*raft.Log{
+		{Index: 2, Term: 2, Data: []byte("other")},
+		{Index: 3, Term: 2, Data: []byte("other")},
+	})
+	assertNoError(t, err)
+	refs = payloadRefs(t, store)
+	assert(t, fmt.Sprint(refs) == "[1 2]", fmt.Sprintf("want payloads with 1 and 2 refs, got: %v", refs))
+
+	// a missing payload is reported as corruption
+	_, err = store.db.Exec("DELETE FROM logs_payloads WHERE refs = 2")
+	assertNoError(t, err)
+	err = store.GetLog(2, new(raft.Log))
+	assert(t, errors.Is(err, ErrLogCorrupted), fmt.Sprintf("want log corrupted err, got: %v", err))
+
+	repaired, removed, err := store.RepairCorrupted(nil)
+	assertNoError(t, err)
+	assert(t, repaired == 0 && removed == 2, fmt.Sprintf("want 2 removed, got: %d and %d", repaired, removed))
+}
@@ -0,0 +1,56 @@
+//go:build !modernc
+
+package raftsqlite
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// driverName is the database/sql driver used to open the store.
+const driverName = "sqlite3"
+
+// normalizeDSN adapts a DSN to the syntax understood by the driver.
+// mattn/go-sqlite3 is the reference syntax, so it is returned as is.
+func normalizeDSN(dsn string) string {
+	return dsn
+}
+
+// isBusyError reports whether err is a transient SQLITE_BUSY or
+// SQLITE_LOCKED error.
+func isBusyError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
+
+// isCorruptError reports whether err is a SQLITE_CORRUPT or SQLITE_NOTADB
+// error.
+func isCorruptError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrCorrupt || sqliteErr.Code == sqlite3.ErrNotADB
+}
+
+// isDiskFullError reports whether err is a SQLITE_FULL error.
+func isDiskFullError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrFull
+}
+
+// isReadOnlyDBError reports whether err is a SQLITE_READONLY error.
+func isReadOnlyDBError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrReadonly
+}
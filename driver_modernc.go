@@ -0,0 +1,80 @@
+//go:build modernc
+
+package raftsqlite
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// driverName is the database/sql driver used to open the store.
+const driverName = "sqlite"
+
+// normalizeDSN adapts a DSN to the syntax understood by the driver.
+// modernc.org/sqlite expects pragmas as _pragma=name(value) query
+// parameters, so the mattn/go-sqlite3 equivalents are rewritten.
+func normalizeDSN(dsn string) string {
+	pos := strings.IndexRune(dsn, '?')
+	if pos < 1 {
+		return dsn
+	}
+
+	params, err := url.ParseQuery(dsn[pos+1:])
+	if err != nil {
+		// let the driver report the malformed DSN
+		return dsn
+	}
+
+	for param, pragma := range mattnPragmaParams {
+		for _, v := range params[param] {
+			params.Add("_pragma", pragma+"("+v+")")
+		}
+		params.Del(param)
+	}
+	return dsn[:pos+1] + params.Encode()
+}
+
+// isBusyError reports whether err is a transient SQLITE_BUSY or
+// SQLITE_LOCKED error.
+func isBusyError(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	// extended result codes carry the primary code in the lower byte
+	code := sqliteErr.Code() & 0xff
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
+
+// isCorruptError reports whether err is a SQLITE_CORRUPT or SQLITE_NOTADB
+// error.
+func isCorruptError(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code() & 0xff
+	return code == sqlite3.SQLITE_CORRUPT || code == sqlite3.SQLITE_NOTADB
+}
+
+// isDiskFullError reports whether err is a SQLITE_FULL error.
+func isDiskFullError(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code()&0xff == sqlite3.SQLITE_FULL
+}
+
+// isReadOnlyDBError reports whether err is a SQLITE_READONLY error.
+func isReadOnlyDBError(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code()&0xff == sqlite3.SQLITE_READONLY
+}
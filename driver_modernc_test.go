@@ -0,0 +1,81 @@
+//go:build modernc
+
+package raftsqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestModerncStoreRoundTrip(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err := store.StoreLog(createRaftLog(1, "log1"))
+	assertNoError(t, err)
+
+	log := new(raft.Log)
+	err = store.GetLog(1, log)
+	assertNoError(t, err)
+	assert(t, string(log.Data) == "log1", fmt.Sprintf("want log1, got: %s", log.Data))
+}
+
+func TestModerncNormalizeDSN(t *testing.T) {
+	dsn := normalizeDSN("file:raft.db?_journal_mode=WAL&cache=shared")
+	want := "file:raft.db?_pragma=journal_mode%28WAL%29&cache=shared"
+	assert(t, dsn == want, fmt.Sprintf("want %s, got: %s", want, dsn))
+
+	dsn = normalizeDSN("file::memory:?cache=shared")
+	want = "file::memory:?cache=shared"
+	assert(t, dsn == want, fmt.Sprintf("want %s, got: %s", want, dsn))
+}
+
+func TestModerncCanceledQuery(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 10, "log")
+
+	// cancel reads at random points, a query canceled right after its
+	// first row must not leave the connection unusable
+	log := new(raft.Log)
+	for i := 0; i < 5000; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i%50)*time.Microsecond)
+		store.GetLogCtx(ctx, uint64(i%10)+1, log)
+		cancel()
+	}
+
+	err := store.GetLog(1, log)
+	assertNoError(t, err)
+	assert(t, string(log.Data) == "log", fmt.Sprintf("want log, got: %s", log.Data))
+}
+
+func TestModerncInterruptQuery(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	// a query which never ends on its own must be interrupted once its
+	// context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var n int
+	err := store.readDB.QueryRowContext(ctx, "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c) SELECT count(*) FROM c").Scan(&n)
+	assert(t, errors.Is(err, context.DeadlineExceeded), fmt.Sprintf("want deadline exceeded err, got: %v", err))
+
+	err = store.StoreLog(createRaftLog(1, "log"))
+	assertNoError(t, err)
+}
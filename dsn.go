@@ -0,0 +1,72 @@
+package raftsqlite
+
+import (
+	"net/url"
+	"strings"
+)
+
+// mattnPragmaParams maps the mattn/go-sqlite3 DSN parameters to the
+// pragma they configure.
+var mattnPragmaParams = map[string]string{
+	"_busy_timeout": "busy_timeout",
+	"_timeout":      "busy_timeout",
+	"_foreign_keys": "foreign_keys",
+	"_fk":           "foreign_keys",
+	"_journal_mode": "journal_mode",
+	"_journal":      "journal_mode",
+	"_synchronous":  "synchronous",
+	"_sync":         "synchronous",
+}
+
+// managedPragmas are the pragmas the store sets from its options. DSN
+// parameters setting them are dropped: they would be applied to every new
+// connection of the pool, and switching the journal mode of a database
+// while other connections use it fails.
+var managedPragmas = map[string]bool{
+	"journal_mode": true,
+	"synchronous":  true,
+}
+
+// stripManagedParams returns dsn without the query parameters setting a
+// managed pragma, either in the mattn/go-sqlite3 syntax or the
+// _pragma=name(value) one of modernc.org/sqlite, along with the removed
+// parameters. The other parameters are kept as is.
+func stripManagedParams(dsn string) (string, []string) {
+	pos := strings.IndexRune(dsn, '?')
+	if pos < 0 {
+		return dsn, nil
+	}
+
+	var kept, removed []string
+	for _, param := range strings.Split(dsn[pos+1:], "&") {
+		key, value, _ := strings.Cut(param, "=")
+		key, err := url.QueryUnescape(key)
+		if err == nil {
+			value, err = url.QueryUnescape(value)
+		}
+		if err == nil && managedPragmas[paramPragma(key, value)] {
+			removed = append(removed, key+"="+value)
+			continue
+		}
+		kept = append(kept, param)
+	}
+	if len(removed) == 0 {
+		return dsn, nil
+	}
+	if len(kept) == 0 {
+		return dsn[:pos], removed
+	}
+	return dsn[:pos+1] + strings.Join(kept, "&"), removed
+}
+
+// paramPragma returns the pragma the DSN parameter key=value sets, or an
+// empty string if it sets none.
+func paramPragma(key, value string) string {
+	if key != "_pragma" {
+		return mattnPragmaParams[key]
+	}
+	if pos := strings.IndexAny(value, "(="); pos >= 0 {
+		value = value[:pos]
+	}
+	return strings.ToLower(strings.TrimSpace(value))
+}
@@ -0,0 +1,61 @@
+package raftsqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestStripManagedParams(t *testing.T) {
+	cases := []struct {
+		dsn     string
+		want    string
+		removed []string
+	}{
+		{"/tmp/raft.db", "/tmp/raft.db", nil},
+		{"file:raft.db?_busy_timeout=100&cache=shared", "file:raft.db?_busy_timeout=100&cache=shared", nil},
+		{"file:raft.db?_journal_mode=DELETE", "file:raft.db", []string{"_journal_mode=DELETE"}},
+		{"file:raft.db?_fk=1&_journal=MEMORY&_sync=0&mode=rwc", "file:raft.db?_fk=1&mode=rwc", []string{"_journal=MEMORY", "_sync=0"}},
+		{"file:raft.db?_pragma=journal_mode(delete)&_pragma=foreign_keys(1)", "file:raft.db?_pragma=foreign_keys(1)", []string{"_pragma=journal_mode(delete)"}},
+		{"file:raft.db?_pragma=Synchronous%3DOFF&_txlock=immediate", "file:raft.db?_txlock=immediate", []string{"_pragma=Synchronous=OFF"}},
+	}
+	for _, c := range cases {
+		got, removed := stripManagedParams(c.dsn)
+		assert(t, got == c.want, fmt.Sprintf("want %q for %q, got: %q", c.want, c.dsn, got))
+		assert(t, reflect.DeepEqual(removed, c.removed), fmt.Sprintf("want removed %q for %q, got: %q", c.removed, c.dsn, removed))
+	}
+}
+
+func TestDSNManagedParams(t *testing.T) {
+	dir := t.TempDir()
+	dsn := "file:" + dir + "/raft.db?_journal_mode=DELETE&_sync=OFF&_foreign_keys=1"
+
+	h := &capturingHandler{}
+	store, err := NewStoreWithOptions(dsn, WithLogger(slog.New(h)))
+	assertNoError(t, err)
+	defer store.Close()
+	assert(t, h.has(slog.LevelWarn, "ignoring DSN parameter of a pragma managed by the store"), "want the dropped parameters to be logged")
+	assert(t, store.DSN() == dsn, fmt.Sprintf("want dsn %q, got: %q", dsn, store.DSN()))
+
+	storeLogRange(t, store, 1, 10, "log")
+	_, err = os.Stat(dir + "/raft.db-wal")
+	assertNoError(t, err)
+
+	var mode string
+	var sync, fk int
+	err = store.db.QueryRow("PRAGMA journal_mode").Scan(&mode)
+	assertNoError(t, err)
+	assert(t, mode == "wal", fmt.Sprintf("want wal journal mode, got: %s", mode))
+	for _, db := range []*sql.DB{store.db, store.readDB} {
+		err = db.QueryRow("PRAGMA synchronous").Scan(&sync)
+		assertNoError(t, err)
+		assert(t, sync == 1, fmt.Sprintf("want normal synchronous mode, got: %d", sync))
+		// unrelated parameters pass through
+		err = db.QueryRow("PRAGMA foreign_keys").Scan(&fk)
+		assertNoError(t, err)
+		assert(t, fk == 1, "want foreign keys enabled by the DSN")
+	}
+}
@@ -0,0 +1,233 @@
+package raftsqlite
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// dumpRecord is a line of the DumpJSON output, either a log or a kv entry
+// depending on Kind. Byte slices are base64 encoded by encoding/json.
+type dumpRecord struct {
+	Kind string `json:"kind"`
+
+	Index      uint64       `json:"index,omitempty"`
+	Term       uint64       `json:"term,omitempty"`
+	Type       raft.LogType `json:"type,omitempty"`
+	Data       []byte       `json:"data,omitempty"`
+	Extensions []byte       `json:"extensions,omitempty"`
+	AppendedAt *time.Time   `json:"appended_at,omitempty"`
+	// StoredAt is when the log was stored, in unix nanoseconds, which
+	// DeleteLogsOlderThan goes by.
+	StoredAt int64 `json:"stored_at,omitempty"`
+
+	Key       []byte     `json:"key,omitempty"`
+	Value     []byte     `json:"value,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+const (
+	dumpKindLog = "log"
+	dumpKindKV  = "kv"
+)
+
+// DumpJSON writes the logs, in index order, followed by the kv entries,
+// in key order and along with their expiration if any, to w as newline
+// delimited JSON objects. The records are streamed from a single read
+// transaction, so the dump is consistent without holding the whole store
+// in memory. The output can be loaded back with ImportJSON.
+func (s *SqliteStore) DumpJSON(w io.Writer) error {
+	tx, err := s.beginRead(context.Background())
+	if err != nil {
+		return err
+	}
+	// nothing to commit, the transaction only provides a stable view
+	defer tx.Rollback()
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	rows, err := tx.Query(fmt.Sprintf("SELECT idx, %s, appended_at FROM %s ORDER BY idx ASC", s.logColumns(), s.opts.logsTable))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var idx uint64
+		var data, shared []byte
+		var crc, storedAt sql.NullInt64
+		if err := rows.Scan(&idx, &data, &crc, &shared, &storedAt); err != nil {
+			return err
+		}
+		log := new(raft.Log)
+		if err := s.loadLog(idx, data, crc, shared, log); err != nil {
+			return err
+		}
+
+		record := dumpRecord{
+			Kind:       dumpKindLog,
+			Index:      log.Index,
+			Term:       log.Term,
+			Type:       log.Type,
+			Data:       log.Data,
+			Extensions: log.Extensions,
+		}
+		if !log.AppendedAt.IsZero() {
+			record.AppendedAt = &log.AppendedAt
+		}
+		if storedAt.Valid {
+			record.StoredAt = storedAt.Int64
+		}
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	rows, err = tx.Query(fmt.Sprintf("SELECT key, value, expires_at FROM %s WHERE expires_at IS NULL OR expires_at > ? ORDER BY key ASC", s.opts.kvTable),
+		s.opts.clock.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k, v []byte
+		var expiresAt sql.NullInt64
+		if err := rows.Scan(&k, &v, &expiresAt); err != nil {
+			return err
+		}
+
+		v, err := s.open(v)
+		if err != nil {
+			return err
+		}
+		record := dumpRecord{Kind: dumpKindKV, Key: k, Value: v}
+		if expiresAt.Valid {
+			t := time.Unix(0, expiresAt.Int64)
+			record.ExpiresAt = &t
+		}
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// importBatchSize is the number of logs ImportJSON inserts at once.
+const importBatchSize = 1000
+
+// ImportJSON loads the logs and kv entries from the newline delimited
+// JSON produced by DumpJSON. The log indexes must be strictly increasing
+// and past the last stored index. The input is decoded up front, as the
+// transaction may be run again when the database is busy and r can only
+// be read once, so it must fit in memory. Everything is imported within a
+// single transaction, inserting the logs in batches, so on malformed input
+// or any other error nothing is stored. The logs keep the time they were
+// stored at, which DeleteLogsOlderThan goes by, and the keys set with
+// SetWithTTL expire at the same time as in the dumped store.
+func (s *SqliteStore) ImportJSON(r io.Reader) error {
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+
+	logs, storedAt, kvs, err := decodeDump(r)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	return s.transaction(func(tx *sql.Tx) error {
+		_, last, err := s.bounds(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if len(logs) > 0 && logs[0].Index <= last {
+			return fmt.Errorf("%w: index %d does not follow %d", ErrNonMonotonic, logs[0].Index, last)
+		}
+
+		for start := 0; start < len(logs); start += importBatchSize {
+			end := min(start+importBatchSize, len(logs))
+			if err := s.insertLogs(ctx, tx, logs[start:end], storedAt[start:end]); err != nil {
+				return err
+			}
+		}
+		for _, kv := range kvs {
+			if kv.ExpiresAt == nil {
+				if err := s.setTx(tx, kv.Key, kv.Value); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// the key expires as it would have in the dumped store
+			v, err := s.sealValue(kv.Value)
+			if err != nil {
+				return err
+			}
+			if err := s.setSealedTTLTx(tx, kv.Key, v, *kv.ExpiresAt); err != nil {
+				return err
+			}
+		}
+
+		if len(logs) == 0 {
+			return nil
+		}
+		return s.extendBounds(ctx, tx, logs[0].Index, logs[len(logs)-1].Index)
+	})
+}
+
+// decodeDump decodes the records of a DumpJSON output, returning its logs,
+// checked to be strictly increasing, the times they were stored at and
+// its kv entries.
+func decodeDump(r io.Reader) (logs []*raft.Log, storedAt []int64, kvs []dumpRecord, err error) {
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var record dumpRecord
+		err := dec.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			return logs, storedAt, kvs, nil
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("decoding record %d: %w", line, err)
+		}
+
+		switch record.Kind {
+		case dumpKindLog:
+			if len(logs) > 0 && record.Index <= logs[len(logs)-1].Index {
+				return nil, nil, nil, fmt.Errorf("record %d: %w: index %d does not follow %d", line, ErrNonMonotonic, record.Index, logs[len(logs)-1].Index)
+			}
+
+			log := &raft.Log{
+				Index:      record.Index,
+				Term:       record.Term,
+				Type:       record.Type,
+				Data:       record.Data,
+				Extensions: record.Extensions,
+			}
+			if record.AppendedAt != nil {
+				log.AppendedAt = *record.AppendedAt
+			}
+			logs = append(logs, log)
+			storedAt = append(storedAt, record.StoredAt)
+		case dumpKindKV:
+			kvs = append(kvs, record)
+		default:
+			return nil, nil, nil, fmt.Errorf("record %d: unknown kind %q", line, record.Kind)
+		}
+	}
+}
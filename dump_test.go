@@ -0,0 +1,260 @@
+package raftsqlite
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestDumpJSON(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err := store.StoreLogs([]*raft.Log{
+		{Index: 1, Term: 1, Type: raft.LogConfiguration, Data: []byte("config")},
+		{Index: 2, Term: 1, Type: raft.LogCommand, Data: []byte{0x00, 0xff}, Extensions: []byte("ext")},
+		{Index: 3, Term: 2, Type: raft.LogCommand, Data: []byte("cmd")},
+	})
+	assertNoError(t, err)
+	err = store.Set([]byte("CurrentTerm"), uint64ToBytes(2))
+	assertNoError(t, err)
+	err = store.Set([]byte("LastVoteCand"), []byte("node1"))
+	assertNoError(t, err)
+
+	var buf bytes.Buffer
+	err = store.DumpJSON(&buf)
+	assertNoError(t, err)
+
+	// the data is base64 encoded
+	first, _, _ := bytes.Cut(buf.Bytes(), []byte("\n"))
+	assert(t, bytes.Contains(first, []byte(`"data":"Y29uZmln"`)), fmt.Sprintf("want base64 data, got: %s", first))
+
+	var records []dumpRecord
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var record dumpRecord
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		assertNoError(t, err)
+		records = append(records, record)
+	}
+	assertNoError(t, scanner.Err())
+	assert(t, len(records) == 5, fmt.Sprintf("want 5 records, got: %d", len(records)))
+
+	for i, want := range []uint64{1, 2, 3} {
+		r := records[i]
+		assert(t, r.Kind == "log" && r.Index == want, fmt.Sprintf("want log %d, got: %+v", want, r))
+	}
+	assert(t, records[0].Type == raft.LogConfiguration, fmt.Sprintf("want configuration log, got: %s", records[0].Type))
+	assert(t, bytes.Equal(records[1].Data, []byte{0x00, 0xff}), fmt.Sprintf("want binary data, got: %v", records[1].Data))
+	assert(t, string(records[1].Extensions) == "ext", fmt.Sprintf("want extensions, got: %s", records[1].Extensions))
+	assert(t, records[2].Term == 2, fmt.Sprintf("want term 2, got: %d", records[2].Term))
+
+	assert(t, records[3].Kind == "kv" && string(records[3].Key) == "CurrentTerm", fmt.Sprintf("want CurrentTerm, got: %+v", records[3]))
+	assert(t, bytesToUint64(records[3].Value) == 2, fmt.Sprintf("want term 2, got: %v", records[3].Value))
+	assert(t, records[4].Kind == "kv" && string(records[4].Key) == "LastVoteCand", fmt.Sprintf("want LastVoteCand, got: %+v", records[4]))
+	assert(t, string(records[4].Value) == "node1", fmt.Sprintf("want node1, got: %s", records[4].Value))
+}
+
+// writerFunc is an io.Writer calling itself.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestDumpJSONDoesNotBlockWrites(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 10, "log")
+
+	// a slow consumer of the dump must not hold the write connection
+	var stored bool
+	w := writerFunc(func(p []byte) (int, error) {
+		if stored {
+			return len(p), nil
+		}
+		done := make(chan error, 1)
+		go func() { done <- store.StoreLog(createRaftLog(11, "log")) }()
+		select {
+		case err := <-done:
+			stored = true
+			return len(p), err
+		case <-time.After(5 * time.Second):
+			return 0, errors.New("write blocked by the dump")
+		}
+	})
+	err := store.DumpJSON(w)
+	assertNoError(t, err)
+	assert(t, stored, "want a log stored while dumping")
+}
+
+func TestImportJSON(t *testing.T) {
+	clock := newFakeClock()
+	src, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithClock(clock))
+	assertNoError(t, err)
+	defer func() {
+		src.Close()
+		src.deleteDB()
+	}()
+
+	storeLogRange(t, src, 5, 5+importBatchSize+10, "log")
+	clock.Advance(time.Hour)
+	err = src.StoreLog(&raft.Log{Index: 2000, Term: 3, Type: raft.LogBarrier, Extensions: []byte("ext")})
+	assertNoError(t, err)
+	err = src.Set([]byte("key1"), []byte("val1"))
+	assertNoError(t, err)
+	err = src.SetUint64([]byte("key2"), 2)
+	assertNoError(t, err)
+
+	var buf bytes.Buffer
+	err = src.DumpJSON(&buf)
+	assertNoError(t, err)
+
+	clock.Advance(time.Hour)
+	dst, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithClock(clock))
+	assertNoError(t, err)
+	defer func() {
+		dst.Close()
+		dst.deleteDB()
+	}()
+
+	err = dst.ImportJSON(bytes.NewReader(buf.Bytes()))
+	assertNoError(t, err)
+
+	var got bytes.Buffer
+	err = dst.DumpJSON(&got)
+	assertNoError(t, err)
+	assert(t, bytes.Equal(got.Bytes(), buf.Bytes()), "want the imported store to dump the same records")
+
+	first, err := dst.FirstIndex()
+	assertNoError(t, err)
+	last, err := dst.LastIndex()
+	assertNoError(t, err)
+	assert(t, first == 5 && last == 2000, fmt.Sprintf("want range [5, 2000], got: [%d, %d]", first, last))
+
+	// the logs keep the time they were stored at in the dumped store
+	deleted, err := dst.DeleteLogsOlderThan(clock.Now().Add(-90*time.Minute), last)
+	assertNoError(t, err)
+	assert(t, deleted == importBatchSize+11, fmt.Sprintf("want %d logs deleted, got: %d", importBatchSize+11, deleted))
+	first, err = dst.FirstIndex()
+	assertNoError(t, err)
+	assert(t, first == 2000, fmt.Sprintf("want first index 2000, got: %d", first))
+
+	// importing the same logs again does not follow the last index
+	err = dst.ImportJSON(bytes.NewReader(buf.Bytes()))
+	assert(t, errors.Is(err, ErrNonMonotonic), fmt.Sprintf("want non monotonic err, got: %v", err))
+}
+
+func TestImportJSONTTL(t *testing.T) {
+	clock := newFakeClock()
+	src, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithClock(clock))
+	assertNoError(t, err)
+	defer src.Close()
+
+	err = src.SetWithTTL([]byte("lease"), []byte("node1"), time.Minute)
+	assertNoError(t, err)
+	err = src.Set([]byte("term"), []byte("1"))
+	assertNoError(t, err)
+
+	var buf bytes.Buffer
+	err = src.DumpJSON(&buf)
+	assertNoError(t, err)
+
+	dst, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithClock(clock))
+	assertNoError(t, err)
+	defer dst.Close()
+	err = dst.ImportJSON(&buf)
+	assertNoError(t, err)
+
+	val, err := dst.Get([]byte("lease"))
+	assertNoError(t, err)
+	assert(t, string(val) == "node1", fmt.Sprintf("want node1, got: %s", val))
+
+	// the imported key expires when the dumped one did
+	clock.Advance(time.Minute)
+	_, err = dst.Get([]byte("lease"))
+	assert(t, err == ErrKeyNotFound, fmt.Sprintf("want not found err, got: %v", err))
+	val, err = dst.Get([]byte("term"))
+	assertNoError(t, err)
+	assert(t, string(val) == "1", fmt.Sprintf("want 1, got: %s", val))
+}
+
+func TestImportJSONBusy(t *testing.T) {
+	src := mustSqliteDiskStore(t)
+	defer func() {
+		src.Close()
+		src.deleteDB()
+	}()
+
+	storeLogRange(t, src, 1, 5, "log")
+	err := src.Set([]byte("key"), []byte("val"))
+	assertNoError(t, err)
+
+	var buf bytes.Buffer
+	err = src.DumpJSON(&buf)
+	assertNoError(t, err)
+
+	path := t.TempDir() + "/raft.db"
+	dst, err := NewStoreWithOptions(path, WithBusyTimeout(0), WithMaxRetries(10))
+	assertNoError(t, err)
+	defer func() {
+		dst.Close()
+		dst.deleteDB()
+	}()
+
+	// the import is retried once the lock is released, after the input
+	// was read by the first attempt
+	unlock := lockDB(t, path)
+	time.AfterFunc(30*time.Millisecond, unlock)
+	err = dst.ImportJSON(bytes.NewReader(buf.Bytes()))
+	assertNoError(t, err)
+	assert(t, dst.txRetries.Load() > 0, "want the import to be retried")
+
+	count, err := dst.CountLogs()
+	assertNoError(t, err)
+	assert(t, count == 5, fmt.Sprintf("want 5 logs, got: %d", count))
+	val, err := dst.Get([]byte("key"))
+	assertNoError(t, err)
+	assert(t, string(val) == "val", fmt.Sprintf("want val, got: %s", val))
+}
+
+func TestImportJSONInvalid(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	inputs := map[string]string{
+		"malformed":      `{"kind":"kv","key":"a2V5","value":"dmFs"}` + "\n" + `{"kind":"log","index":1,`,
+		"unknown kind":   `{"kind":"kv","key":"a2V5","value":"dmFs"}` + "\n" + `{"kind":"snapshot"}`,
+		"out of order":   `{"kind":"log","index":2}` + "\n" + `{"kind":"log","index":1}`,
+		"duplicate":      `{"kind":"log","index":1}` + "\n" + `{"kind":"log","index":1}`,
+		"invalid base64": `{"kind":"log","index":1,"data":"!!"}`,
+	}
+	for name, input := range inputs {
+		err := store.ImportJSON(strings.NewReader(input))
+		assert(t, err != nil, fmt.Sprintf("want error importing %s input", name))
+	}
+
+	// nothing was partially committed
+	count, err := store.CountLogs()
+	assertNoError(t, err)
+	assert(t, count == 0, fmt.Sprintf("want 0 logs, got: %d", count))
+	_, err = store.Get([]byte("key"))
+	assert(t, errors.Is(err, ErrKeyNotFound), fmt.Sprintf("want not found err, got: %v", err))
+}
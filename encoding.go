@@ -0,0 +1,136 @@
+package raftsqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// ErrEncodingMismatch is returned when opening a database whose logs were
+// written with a different Encoding than the configured one.
+var ErrEncodingMismatch = errors.New("database encoding does not match")
+
+// Encoding serializes the logs before they are compressed, encrypted and
+// written to the database.
+type Encoding interface {
+	// Name identifies the encoding. It is recorded in the database, which
+	// then can only be opened with an encoding of the same name.
+	Name() string
+
+	// Encode returns the serialized form of v.
+	Encode(v any) ([]byte, error)
+
+	// Decode reverses Encode, storing the result in v.
+	Decode(data []byte, v any) error
+}
+
+// customMarker prefixes the log blobs encoded with an Encoding other than
+// the ones of this package, whose output may start with any byte,
+// including the markers of the compressed, external and shared logs. Like
+// them, it can't start a msgpack, json or gob encoded log, msgpack only
+// uses it for true.
+const customMarker = 0xc3
+
+// builtinEncoding reports whether e is one of the encodings of this
+// package, none of which starts a log with a marker byte.
+func builtinEncoding(e Encoding) bool {
+	switch e.(type) {
+	case msgpackEncoding, jsonEncoding, gobEncoding:
+		return true
+	}
+	return false
+}
+
+// encodeInline encodes log as stored inline, prefixed by customMarker if
+// it is encoded with a custom Encoding.
+func (s *SqliteStore) encodeInline(log *raft.Log) ([]byte, error) {
+	data, err := s.opts.encoding.Encode(log)
+	if err != nil || builtinEncoding(s.opts.encoding) {
+		return data, err
+	}
+	return append([]byte{customMarker}, data...), nil
+}
+
+// NewMsgpackEncoding returns the msgpack Encoding, the default.
+func NewMsgpackEncoding() Encoding {
+	return msgpackEncoding{}
+}
+
+type msgpackEncoding struct{}
+
+func (msgpackEncoding) Name() string { return "msgpack" }
+
+func (msgpackEncoding) Encode(v any) ([]byte, error) {
+	buf, err := encodeMsgPack(v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackEncoding) Decode(data []byte, v any) error {
+	return decodeMsgPack(data, v)
+}
+
+// NewJSONEncoding returns an Encoding using encoding/json, which makes the
+// stored logs human readable at the cost of size.
+func NewJSONEncoding() Encoding {
+	return jsonEncoding{}
+}
+
+type jsonEncoding struct{}
+
+func (jsonEncoding) Name() string { return "json" }
+
+func (jsonEncoding) Encode(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonEncoding) Decode(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// NewGobEncoding returns an Encoding using encoding/gob.
+func NewGobEncoding() Encoding {
+	return gobEncoding{}
+}
+
+type gobEncoding struct{}
+
+func (gobEncoding) Name() string { return "gob" }
+
+func (gobEncoding) Encode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobEncoding) Decode(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// checkEncoding verifies that the database logs were written with the
+// configured encoding.
+func (s *SqliteStore) checkEncoding(ctx context.Context) error {
+	var name string
+	err := s.db.QueryRowContext(ctx, "SELECT value FROM store_meta WHERE store = ? AND key = 'encoding'", s.opts.logsTable).Scan(&name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: no encoding recorded", ErrEncodingMismatch)
+		}
+		return err
+	}
+
+	if want := s.opts.encoding.Name(); name != want {
+		return fmt.Errorf("%w: database uses %q, store configured with %q", ErrEncodingMismatch, name, want)
+	}
+	return nil
+}
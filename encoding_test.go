@@ -0,0 +1,141 @@
+package raftsqlite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestWithEncoding(t *testing.T) {
+	for _, encoding := range []Encoding{NewJSONEncoding(), NewGobEncoding()} {
+		t.Run(encoding.Name(), func(t *testing.T) {
+			store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithEncoding(encoding), WithCompression(gzipCodec{}))
+			assertNoError(t, err)
+			defer func() {
+				store.Close()
+				store.deleteDB()
+			}()
+
+			want := &raft.Log{
+				Index:      1,
+				Term:       2,
+				Type:       raft.LogConfiguration,
+				Data:       []byte("log1"),
+				Extensions: []byte("ext"),
+				AppendedAt: time.Unix(1700000000, 0).UTC(),
+			}
+			err = store.StoreLog(want)
+			assertNoError(t, err)
+			storeLogRange(t, store, 2, 3, "log")
+
+			got := new(raft.Log)
+			err = store.GetLog(1, got)
+			assertNoError(t, err)
+			assert(t, got.Index == want.Index && got.Term == want.Term && got.Type == want.Type, fmt.Sprintf("want log %+v, got: %+v", want, got))
+			assert(t, string(got.Data) == "log1" && string(got.Extensions) == "ext", fmt.Sprintf("want log %+v, got: %+v", want, got))
+			assert(t, got.AppendedAt.Equal(want.AppendedAt), fmt.Sprintf("want appended at %s, got: %s", want.AppendedAt, got.AppendedAt))
+
+			logs, err := store.GetLogs(2, 3)
+			assertNoError(t, err)
+			assert(t, len(logs) == 2 && string(logs[1].Data) == "log", fmt.Sprintf("want 2 logs, got: %d", len(logs)))
+		})
+	}
+}
+
+// prefixEncoding is a custom Encoding prefixing the JSON encoding with a
+// given byte, such as one of the markers of the stored logs.
+type prefixEncoding struct{ prefix byte }
+
+func (e prefixEncoding) Name() string { return fmt.Sprintf("prefix-%x", e.prefix) }
+
+func (e prefixEncoding) Encode(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{e.prefix}, data...), nil
+}
+
+func (e prefixEncoding) Decode(data []byte, v any) error {
+	if len(data) == 0 || data[0] != e.prefix {
+		return fmt.Errorf("missing prefix %x", e.prefix)
+	}
+	return json.Unmarshal(data[1:], v)
+}
+
+func TestCustomEncodingMarkers(t *testing.T) {
+	for _, prefix := range []byte{externalMarker, compressedMarker, sharedMarker, customMarker, '{'} {
+		for _, opts := range [][]Option{nil, {WithCompression(gzipCodec{})}} {
+			encoding := prefixEncoding{prefix}
+			store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", append(opts, WithEncoding(encoding))...)
+			assertNoError(t, err)
+
+			storeLogRange(t, store, 1, 3, "log")
+			logs, err := store.GetLogs(1, 3)
+			assertNoError(t, err)
+			assert(t, len(logs) == 3 && string(logs[2].Data) == "log", fmt.Sprintf("%s: want 3 logs, got: %+v", encoding.Name(), logs))
+			store.Close()
+		}
+	}
+}
+
+func TestJSONEncodingStored(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithEncoding(NewJSONEncoding()))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err = store.StoreLog(createRaftLog(1, "log1"))
+	assertNoError(t, err)
+
+	var data []byte
+	err = store.db.QueryRow("SELECT data FROM logs WHERE idx = 1").Scan(&data)
+	assertNoError(t, err)
+	assert(t, json.Valid(data), fmt.Sprintf("want json stored, got: %q", data))
+}
+
+func TestEncodingMismatch(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStoreWithOptions(path, WithEncoding(NewJSONEncoding()))
+	assertNoError(t, err)
+	store.Close()
+
+	_, err = NewStore(path)
+	assert(t, errors.Is(err, ErrEncodingMismatch), fmt.Sprintf("want encoding mismatch err, got: %v", err))
+	ro, err := NewStoreWithOptions(path, WithEncoding(NewJSONEncoding()), WithReadOnly(true))
+	assertNoError(t, err)
+	ro.Close()
+	_, err = NewStoreWithOptions(path, WithEncoding(NewGobEncoding()), WithReadOnly(true))
+	assert(t, errors.Is(err, ErrEncodingMismatch), fmt.Sprintf("want encoding mismatch err, got: %v", err))
+}
+
+func TestMigrateEncoding(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStore(path)
+	assertNoError(t, err)
+	storeLogRange(t, store, 1, 3, "log")
+
+	// downgrade the database to the schema before the recorded encoding
+	downgradeSchema(t, store, 6)
+	store.Close()
+
+	// the existing logs were encoded with msgpack
+	_, err = NewStoreWithOptions(path, WithEncoding(NewJSONEncoding()))
+	assert(t, errors.Is(err, ErrEncodingMismatch), fmt.Sprintf("want encoding mismatch err, got: %v", err))
+
+	store, err = NewStore(path)
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err = store.GetLog(3, new(raft.Log))
+	assertNoError(t, err)
+}
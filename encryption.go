@@ -0,0 +1,77 @@
+package raftsqlite
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Encryptor encrypts the log blobs and kv values before they are written
+// to the database.
+type Encryptor interface {
+	// Seal returns the encrypted form of plaintext.
+	Seal(plaintext []byte) ([]byte, error)
+
+	// Open reverses Seal.
+	Open(ciphertext []byte) ([]byte, error)
+}
+
+// aesGCM is an Encryptor using AES-256 in GCM mode. Each sealed value is
+// prefixed by its random nonce.
+type aesGCM struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCMEncryptor returns an Encryptor using AES-256-GCM with the
+// given 32-byte key. A random nonce is generated for every value and
+// stored alongside its ciphertext.
+func NewAESGCMEncryptor(key []byte) (Encryptor, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid key size %d, want 32 bytes", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &aesGCM{aead: aead}, nil
+}
+
+func (e *aesGCM) Seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, e.aead.NonceSize(), e.aead.NonceSize()+len(plaintext)+e.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return e.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (e *aesGCM) Open(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < e.aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:e.aead.NonceSize()], ciphertext[e.aead.NonceSize():]
+	return e.aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// seal encrypts a value with the configured Encryptor, if any.
+func (s *SqliteStore) seal(b []byte) ([]byte, error) {
+	if s.opts.encryptor == nil {
+		return b, nil
+	}
+	return s.opts.encryptor.Seal(b)
+}
+
+// open reverses seal.
+func (s *SqliteStore) open(b []byte) ([]byte, error) {
+	if s.opts.encryptor == nil {
+		return b, nil
+	}
+	return s.opts.encryptor.Open(b)
+}
@@ -0,0 +1,62 @@
+package raftsqlite
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestWithEncryptor(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	enc, err := NewAESGCMEncryptor(key)
+	assertNoError(t, err)
+
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStoreWithOptions(path, WithEncryptor(enc), WithCompression(gzipCodec{}))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err = store.StoreLog(createRaftLog(1, "secret log"))
+	assertNoError(t, err)
+	err = store.Set([]byte("key1"), []byte("secret value"))
+	assertNoError(t, err)
+
+	log := new(raft.Log)
+	err = store.GetLog(1, log)
+	assertNoError(t, err)
+	assert(t, string(log.Data) == "secret log", fmt.Sprintf("want secret log, got: %s", log.Data))
+
+	val, err := store.Get([]byte("key1"))
+	assertNoError(t, err)
+	assert(t, string(val) == "secret value", fmt.Sprintf("want secret value, got: %s", val))
+
+	// the raw rows do not leak the plaintext
+	db, err := sql.Open(driverName, path)
+	assertNoError(t, err)
+	defer db.Close()
+
+	var data, value []byte
+	err = db.QueryRow("SELECT data FROM logs WHERE idx = 1").Scan(&data)
+	assertNoError(t, err)
+	err = db.QueryRow("SELECT value FROM kv WHERE key = ?", []byte("key1")).Scan(&value)
+	assertNoError(t, err)
+	assert(t, !bytes.Contains(data, []byte("secret log")), "raw log blob contains the plaintext")
+	assert(t, !bytes.Contains(value, []byte("secret value")), "raw kv value contains the plaintext")
+
+	// a different key can't read the data
+	other, err := NewAESGCMEncryptor(bytes.Repeat([]byte{0x24}, 32))
+	assertNoError(t, err)
+	_, err = other.Open(value)
+	assert(t, err != nil, "want error opening with the wrong key")
+}
+
+func TestNewAESGCMEncryptorKeySize(t *testing.T) {
+	_, err := NewAESGCMEncryptor([]byte("short"))
+	assert(t, err != nil, "want error for a short key")
+}
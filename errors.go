@@ -0,0 +1,73 @@
+package raftsqlite
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrBusy is returned when the database stayed locked by another
+	// connection for longer than the busy timeout and retries allowed.
+	ErrBusy = errors.New("database is busy")
+
+	// ErrDiskFull is returned when a write failed because the disk or
+	// the database reached its maximum size.
+	ErrDiskFull = errors.New("database or disk is full")
+
+	// ErrReadOnlyDB is returned when sqlite refused to write to the
+	// database, such as when the file is not writable. Unlike ErrReadOnly,
+	// it comes from the database rather than from the store settings.
+	ErrReadOnlyDB = errors.New("database is read-only")
+)
+
+// classifyError returns the error among ErrBusy, ErrDiskFull,
+// ErrReadOnlyDB and ErrCorrupt matching the sqlite result code of err, or
+// nil if there is none.
+func classifyError(err error) error {
+	switch {
+	case isBusyError(err):
+		return ErrBusy
+	case isDiskFullError(err):
+		return ErrDiskFull
+	case isReadOnlyDBError(err):
+		return ErrReadOnlyDB
+	case isCorruptError(err):
+		return ErrCorrupt
+	}
+	return nil
+}
+
+// wrapError wraps err with its classification, if any, so callers can
+// match it with errors.Is while the driver error stays available to
+// errors.As.
+func wrapError(err error) error {
+	class := classifyError(err)
+	if class == nil || errors.Is(err, class) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", class, err)
+}
+
+// IsBusy reports whether err means the database was locked by another
+// connection, see ErrBusy.
+func IsBusy(err error) bool {
+	return errors.Is(err, ErrBusy) || isBusyError(err)
+}
+
+// IsDiskFull reports whether err means the disk or the database is full,
+// see ErrDiskFull.
+func IsDiskFull(err error) bool {
+	return errors.Is(err, ErrDiskFull) || isDiskFullError(err)
+}
+
+// IsReadOnlyDB reports whether err means sqlite refused to write to the
+// database, see ErrReadOnlyDB.
+func IsReadOnlyDB(err error) bool {
+	return errors.Is(err, ErrReadOnlyDB) || isReadOnlyDBError(err)
+}
+
+// IsCorrupt reports whether err means the database file is damaged, see
+// ErrCorrupt.
+func IsCorrupt(err error) bool {
+	return errors.Is(err, ErrCorrupt) || isCorruptError(err)
+}
@@ -0,0 +1,93 @@
+package raftsqlite
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// mountTmpfs mounts a tmpfs of the given size on a temporary directory,
+// skipping the test if it can't, such as when not running as root.
+func mountTmpfs(t *testing.T, size string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := syscall.Mount("tmpfs", dir, "tmpfs", 0, "size="+size); err != nil {
+		t.Skipf("mounting a tmpfs: %v", err)
+	}
+	// registered after TempDir, so it runs before the removal
+	t.Cleanup(func() { syscall.Unmount(dir, 0) })
+	return dir
+}
+
+func TestDiskFull(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"default":      nil,
+		"group commit": {WithGroupCommit(8, time.Millisecond)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := mountTmpfs(t, "1m")
+
+			// taken up front, so space can be freed once the disk is full
+			err := os.WriteFile(dir+"/filler", make([]byte, 256<<10), 0o600)
+			assertNoError(t, err)
+
+			path := dir + "/raft.db"
+			store, err := NewStoreWithOptions(path, opts...)
+			assertNoError(t, err)
+			defer func() { store.Close() }()
+
+			data := strings.Repeat("x", 4096)
+			var stored uint64
+			for idx := uint64(1); ; idx += 8 {
+				logs := make([]*raft.Log, 8)
+				for i := range logs {
+					logs[i] = createRaftLog(idx+uint64(i), data)
+				}
+				err = store.StoreLogs(logs)
+				if err != nil {
+					break
+				}
+				stored = idx + 7
+				if stored > 1000 {
+					t.Fatal("want the disk to fill up")
+				}
+			}
+			assert(t, errors.Is(err, ErrDiskFull), fmt.Sprintf("want disk full err, got: %v", err))
+			assert(t, IsDiskFull(err), fmt.Sprintf("want disk full err, got: %v", err))
+
+			err = store.Set([]byte("key"), []byte(strings.Repeat("v", 512<<10)))
+			assert(t, errors.Is(err, ErrDiskFull), fmt.Sprintf("want disk full err, got: %v", err))
+
+			// the failed writes left nothing behind
+			last, err := store.LastIndex()
+			assertNoError(t, err)
+			assert(t, last == stored, fmt.Sprintf("want last index %d, got: %d", stored, last))
+			_, err = store.Get([]byte("key"))
+			assert(t, errors.Is(err, ErrKeyNotFound), fmt.Sprintf("want key not found err, got: %v", err))
+
+			// the store recovers once there is space again
+			err = os.Remove(dir + "/filler")
+			assertNoError(t, err)
+			err = store.StoreLog(createRaftLog(stored+1, data))
+			assertNoError(t, err)
+
+			err = store.Close()
+			assertNoError(t, err)
+			store, err = NewStoreWithOptions(path, append(opts, WithIntegrityCheck("full"))...)
+			assertNoError(t, err)
+			log := new(raft.Log)
+			for _, idx := range []uint64{1, stored, stored + 1} {
+				err = store.GetLog(idx, log)
+				assertNoError(t, err)
+				assert(t, string(log.Data) == data, fmt.Sprintf("want data of log %d", idx))
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package raftsqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestIsBusy(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStore(path)
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	other, err := NewStoreWithOptions(path, WithBusyTimeout(0), WithMaxRetries(0))
+	assertNoError(t, err)
+	defer other.Close()
+
+	// hold the write lock from the first store
+	conn, err := store.db.Conn(context.Background())
+	assertNoError(t, err)
+	defer conn.Close()
+	_, err = conn.ExecContext(context.Background(), "BEGIN IMMEDIATE")
+	assertNoError(t, err)
+	defer conn.ExecContext(context.Background(), "ROLLBACK")
+
+	err = other.StoreLog(createRaftLog(1, "log"))
+	assert(t, err != nil, "want error writing to a locked database")
+	assert(t, IsBusy(err), fmt.Sprintf("want busy err, got: %v", err))
+	assert(t, errors.Is(err, ErrBusy), fmt.Sprintf("want err to match ErrBusy, got: %v", err))
+	assert(t, !IsDiskFull(err) && !IsReadOnlyDB(err) && !IsCorrupt(err), fmt.Sprintf("want only a busy err, got: %v", err))
+
+	assert(t, !IsBusy(nil), "want nil not to be busy")
+	assert(t, !IsBusy(ErrKeyNotFound), "want ErrKeyNotFound not to be busy")
+}
+
+func TestIsReadOnlyDB(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStore(path)
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	// bypass the store checks to reach sqlite through a read-only handle
+	ro, err := NewStoreWithOptions(path, WithReadOnly(true))
+	assertNoError(t, err)
+	defer ro.Close()
+
+	err = ro.transaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM logs")
+		return err
+	})
+	assert(t, IsReadOnlyDB(err), fmt.Sprintf("want read-only db err, got: %v", err))
+	assert(t, errors.Is(err, ErrReadOnlyDB), fmt.Sprintf("want err to match ErrReadOnlyDB, got: %v", err))
+	assert(t, !errors.Is(err, ErrReadOnly), "want the sqlite error, not the store one")
+}
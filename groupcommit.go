@@ -0,0 +1,172 @@
+package raftsqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// commitRequest is a StoreLogs call waiting for the group commit writer.
+type commitRequest struct {
+	ctx   context.Context
+	logs  []*raft.Log
+	start time.Time
+
+	// done receives the outcome of the call, it is buffered so the
+	// writer never blocks on it.
+	done chan error
+}
+
+// startGroupCommit starts the writer goroutine committing the queued
+// StoreLogs calls.
+func (s *SqliteStore) startGroupCommit() {
+	s.commits = make(chan *commitRequest, s.opts.groupCommitBatch)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for req := range s.commits {
+			s.commitBatch(s.collectBatch(req))
+		}
+	}()
+}
+
+// stopGroupCommit stops queuing StoreLogs calls. The writer commits the
+// ones already queued before exiting. It is safe to call more than once.
+func (s *SqliteStore) stopGroupCommit() {
+	s.commitMu.Lock()
+	defer s.commitMu.Unlock()
+
+	if s.commits != nil && !s.commitsClosed {
+		close(s.commits)
+	}
+	s.commitsClosed = true
+}
+
+// groupCommit queues logs for the writer and waits for them to be
+// committed.
+func (s *SqliteStore) groupCommit(ctx context.Context, logs []*raft.Log) error {
+	// the select below picks at random when both cases are ready, which
+	// would still queue the logs of a done context
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	req := &commitRequest{
+		ctx:   ctx,
+		logs:  logs,
+		start: time.Now(),
+		done:  make(chan error, 1),
+	}
+
+	// the read lock keeps the queue open while sending, a full queue
+	// only blocks until the writer picks up the next batch
+	s.commitMu.RLock()
+	if s.commitsClosed {
+		s.commitMu.RUnlock()
+		return ErrClosed
+	}
+	select {
+	case s.commits <- req:
+	case <-ctx.Done():
+		s.commitMu.RUnlock()
+		return ctx.Err()
+	}
+	s.commitMu.RUnlock()
+
+	// once queued, the logs may be committed at any time, so the call
+	// can't return before knowing whether they were
+	return <-req.done
+}
+
+// collectBatch returns first along with the calls queued within the
+// configured delay, up to the batch size.
+func (s *SqliteStore) collectBatch(first *commitRequest) []*commitRequest {
+	batch := []*commitRequest{first}
+
+	var timeout <-chan time.Time
+	if s.opts.groupCommitDelay > 0 {
+		timer := time.NewTimer(s.opts.groupCommitDelay)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for len(batch) < s.opts.groupCommitBatch {
+		if timeout == nil {
+			// without a delay, only take the calls already waiting
+			select {
+			case req, ok := <-s.commits:
+				if !ok {
+					return batch
+				}
+				batch = append(batch, req)
+				continue
+			default:
+				return batch
+			}
+		}
+
+		select {
+		case req, ok := <-s.commits:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, req)
+		case <-timeout:
+			return batch
+		}
+	}
+	return batch
+}
+
+// commitBatch stores the logs of every call of batch within a single
+// transaction. Each call gets its own savepoint, so a failing call is
+// rolled back on its own and only its caller gets the error.
+func (s *SqliteStore) commitBatch(batch []*commitRequest) {
+	errs := make([]error, len(batch))
+	var replaced []string
+	err := s.transaction(func(tx *sql.Tx) error {
+		ctx := context.Background()
+		replaced = nil
+		for i, req := range batch {
+			errs[i] = req.ctx.Err()
+			if errs[i] != nil {
+				continue
+			}
+
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT group_commit"); err != nil {
+				return err
+			}
+			var blobs []string
+			blobs, errs[i] = s.storeLogsTx(ctx, tx, req.logs)
+			if errs[i] == nil {
+				replaced = append(replaced, blobs...)
+			} else {
+				if _, err := tx.ExecContext(ctx, "ROLLBACK TO group_commit"); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.ExecContext(ctx, "RELEASE group_commit"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	s.opts.logger.Debug("group commit", "calls", len(batch), "error", err)
+	if err == nil {
+		s.removeBlobs(replaced)
+	}
+
+	for i, req := range batch {
+		if err != nil {
+			req.done <- err
+			continue
+		}
+		if errs[i] == nil {
+			s.opts.observer.ObserveStoreLogs(len(req.logs), time.Since(req.start))
+		}
+		// the errors of the calls come straight from their statements
+		req.done <- wrapError(errs[i])
+	}
+}
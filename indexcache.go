@@ -0,0 +1,121 @@
+package raftsqlite
+
+import (
+	"context"
+	"sync"
+)
+
+// indexCache caches the first and last log indexes in memory. A nil
+// *indexCache caches nothing.
+//
+// Every write transaction may move the indexes, so the cache is
+// invalidated when one starts and again once it ends, and isn't filled
+// while one is running. A read racing with a write may load the indexes
+// as they were before the write, so every invalidation bumps a
+// generation, and the indexes are only cached if no invalidation
+// happened since their read started.
+type indexCache struct {
+	mu          sync.Mutex
+	valid       bool
+	first, last uint64
+	gen         uint64
+
+	// writes counts the running write transactions.
+	writes int
+}
+
+// newIndexCache returns a cache of the log indexes, or nil if disabled.
+func newIndexCache(enabled bool) *indexCache {
+	if !enabled {
+		return nil
+	}
+	return new(indexCache)
+}
+
+// get returns the cached indexes, if any.
+func (c *indexCache) get() (first, last uint64, ok bool) {
+	if c == nil {
+		return 0, 0, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.first, c.last, c.valid
+}
+
+// generation returns the current generation, to be taken before reading
+// the indexes given to set.
+func (c *indexCache) generation() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// set caches the indexes read since generation gen, unless they may have
+// been invalidated since or a write is running.
+func (c *indexCache) set(gen, first, last uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen || c.writes > 0 {
+		return
+	}
+	c.first, c.last, c.valid = first, last, true
+}
+
+// beginWrite invalidates the indexes as a write transaction starts, it
+// must be followed by endWrite.
+func (c *indexCache) beginWrite() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes++
+	c.gen++
+	c.valid = false
+}
+
+// endWrite invalidates the indexes as a write transaction ends, whether
+// it committed or not.
+func (c *indexCache) endWrite() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes--
+	c.gen++
+	c.valid = false
+}
+
+// invalidate drops the cached indexes.
+func (c *indexCache) invalidate() {
+	c.beginWrite()
+	c.endWrite()
+}
+
+// indexBounds returns the first and last log indexes, from the index
+// cache if enabled.
+func (s *SqliteStore) indexBounds(ctx context.Context) (first, last uint64, err error) {
+	if first, last, ok := s.indexCache.get(); ok {
+		return first, last, nil
+	}
+	gen := s.indexCache.generation()
+
+	first, last, err = s.bounds(ctx, s.readDB)
+	if err != nil {
+		return 0, 0, err
+	}
+	s.indexCache.set(gen, first, last)
+	return first, last, nil
+}
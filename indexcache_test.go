@@ -0,0 +1,129 @@
+package raftsqlite
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithIndexCache(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithIndexCache(true))
+	assertNoError(t, err)
+	defer store.Close()
+
+	first, err := store.FirstIndex()
+	assertNoError(t, err)
+	last, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, first == 0 && last == 0, fmt.Sprintf("want range [0, 0], got: [%d, %d]", first, last))
+
+	storeLogRange(t, store, 1, 10, "log")
+	first, err = store.FirstIndex()
+	assertNoError(t, err)
+	last, err = store.LastIndex()
+	assertNoError(t, err)
+	assert(t, first == 1 && last == 10, fmt.Sprintf("want range [1, 10], got: [%d, %d]", first, last))
+
+	// the cached indexes are served without querying, even once changed
+	// behind the back of the store
+	_, err = store.db.Exec("UPDATE logs_bounds SET first_index = 100, last_index = 200")
+	assertNoError(t, err)
+	first, err = store.FirstIndex()
+	assertNoError(t, err)
+	last, err = store.LastIndex()
+	assertNoError(t, err)
+	assert(t, first == 1 && last == 10, fmt.Sprintf("want cached range [1, 10], got: [%d, %d]", first, last))
+	_, err = store.db.Exec("UPDATE logs_bounds SET first_index = 1, last_index = 10")
+	assertNoError(t, err)
+
+	// writes invalidate them
+	err = store.DeleteRange(1, 4)
+	assertNoError(t, err)
+	first, err = store.FirstIndex()
+	assertNoError(t, err)
+	assert(t, first == 5, fmt.Sprintf("want first index 5, got: %d", first))
+
+	err = store.StoreLog(createRaftLog(11, "log"))
+	assertNoError(t, err)
+	last, err = store.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 11, fmt.Sprintf("want last index 11, got: %d", last))
+}
+
+func TestWithIndexCacheConcurrent(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithIndexCache(true))
+	assertNoError(t, err)
+	defer store.Close()
+
+	storeLogRange(t, store, 1, 10, "log")
+
+	// the bounds known to be committed, only ever moving forward
+	var committedFirst, committedLast atomic.Uint64
+	committedFirst.Store(1)
+	committedLast.Store(10)
+
+	const appends = 200
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		for idx := uint64(11); idx < 11+appends; idx++ {
+			if err := store.StoreLog(createRaftLog(idx, "log")); err != nil {
+				t.Error(err)
+				return
+			}
+			committedLast.Store(idx)
+
+			// trim the head every few appends
+			if idx%10 == 0 {
+				first := committedFirst.Load()
+				if err := store.DeleteRange(first, first+4); err != nil {
+					t.Error(err)
+					return
+				}
+				committedFirst.Store(first + 5)
+			}
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				wantFirst, wantLast := committedFirst.Load(), committedLast.Load()
+				first, err := store.FirstIndex()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				last, err := store.LastIndex()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if first < wantFirst || last < wantLast {
+					t.Errorf("stale range [%d, %d], committed [%d, %d]", first, last, wantFirst, wantLast)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	first, err := store.FirstIndex()
+	assertNoError(t, err)
+	last, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, first == committedFirst.Load() && last == 10+appends,
+		fmt.Sprintf("want range [%d, %d], got: [%d, %d]", committedFirst.Load(), 10+appends, first, last))
+}
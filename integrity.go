@@ -0,0 +1,61 @@
+package raftsqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrCorrupt is returned when the database file is damaged.
+var ErrCorrupt = errors.New("database is corrupt")
+
+// checkIntegrity runs the integrity check selected by the options,
+// returning ErrCorrupt along with the reported problems if it fails.
+func (s *SqliteStore) checkIntegrity(ctx context.Context) error {
+	var pragma string
+	switch s.opts.integrityCheck {
+	case "off":
+		return nil
+	case "quick":
+		pragma = "quick_check"
+	case "full":
+		pragma = "integrity_check"
+	}
+
+	problems, err := s.integrityProblems(ctx, pragma)
+	if err != nil {
+		// badly damaged files fail the check itself
+		if isCorruptError(err) {
+			return fmt.Errorf("%w: %w", ErrCorrupt, err)
+		}
+		return err
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrCorrupt, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// integrityProblems returns the problems reported by the given integrity
+// check pragma.
+func (s *SqliteStore) integrityProblems(ctx context.Context, pragma string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "PRAGMA "+pragma)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var problem string
+		if err := rows.Scan(&problem); err != nil {
+			return nil, err
+		}
+		if problem != "ok" {
+			problems = append(problems, problem)
+		}
+	}
+	return problems, rows.Err()
+}
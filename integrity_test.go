@@ -0,0 +1,40 @@
+package raftsqlite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestWithIntegrityCheck(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStore(path)
+	assertNoError(t, err)
+	storeLogRange(t, store, 1, 500, string(bytes.Repeat([]byte("x"), 512)))
+	err = store.Close()
+	assertNoError(t, err)
+
+	for _, mode := range []string{"off", "quick", "full"} {
+		store, err := NewStoreWithOptions(path, WithIntegrityCheck(mode))
+		assertNoError(t, err)
+		store.Close()
+	}
+
+	// overwrite a few pages in the middle of the logs table
+	data, err := os.ReadFile(path)
+	assertNoError(t, err)
+	mid := len(data) / 2
+	copy(data[mid:], bytes.Repeat([]byte{0xde, 0xad, 0xbe, 0xef}, 4096))
+	err = os.WriteFile(path, data, 0o600)
+	assertNoError(t, err)
+
+	for _, mode := range []string{"quick", "full"} {
+		_, err = NewStoreWithOptions(path, WithIntegrityCheck(mode))
+		assert(t, errors.Is(err, ErrCorrupt), fmt.Sprintf("want corrupt err for %s check, got: %v", mode, err))
+	}
+
+	_, err = NewStoreWithOptions(path, WithIntegrityCheck("sometimes"))
+	assert(t, err != nil, "want error for invalid integrity check")
+}
@@ -0,0 +1,264 @@
+package raftsqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// getTx returns the value of k within tx, reporting whether it exists.
+// Expired keys are reported as absent.
+func (s *SqliteStore) getTx(tx *sql.Tx, k []byte) ([]byte, bool, error) {
+	var value []byte
+	// the prepared statement may belong to the read pool
+	err := tx.QueryRow(s.getKVQuery(), k, s.opts.clock.Now().UnixNano()).Scan(&value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	value, err = s.open(value)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// setTx sets k to v within tx, removing any expiration.
+func (s *SqliteStore) setTx(tx *sql.Tx, k, v []byte) error {
+	v, err := s.sealValue(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(s.stmtSetKV).Exec(k, v)
+	return err
+}
+
+// sealValue checks the size of a k/v value and seals it.
+func (s *SqliteStore) sealValue(v []byte) ([]byte, error) {
+	if s.opts.maxValueSize > 0 && len(v) > s.opts.maxValueSize {
+		return nil, fmt.Errorf("%w: value of %d bytes is over %d", ErrValueTooLarge, len(v), s.opts.maxValueSize)
+	}
+	return s.seal(v)
+}
+
+// CompareAndSwap atomically sets k to new if its current value equals
+// old, reporting whether the swap happened. A missing key matches an
+// empty or nil old, in which case it is created. A false result with a
+// nil error means the precondition did not hold.
+func (s *SqliteStore) CompareAndSwap(k, old, new []byte) (bool, error) {
+	if s.opts.readOnly {
+		return false, ErrReadOnly
+	}
+
+	var swapped bool
+	err := s.transaction(func(tx *sql.Tx) error {
+		swapped = false
+
+		current, exists, err := s.getTx(tx, k)
+		if err != nil {
+			return err
+		}
+
+		if exists && !bytes.Equal(current, old) || !exists && len(old) > 0 {
+			return nil
+		}
+
+		if err := s.setTx(tx, k, new); err != nil {
+			return fmt.Errorf("swapping key: %w", err)
+		}
+		swapped = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return swapped, nil
+}
+
+// CompareAndDelete atomically deletes k if its current value equals
+// expected, reporting whether the delete happened, such as to release a
+// lease only if it is still held. A false result with a nil error means
+// the key is absent or holds another value.
+func (s *SqliteStore) CompareAndDelete(k, expected []byte) (bool, error) {
+	if s.opts.readOnly {
+		return false, ErrReadOnly
+	}
+
+	var deleted bool
+	err := s.transaction(func(tx *sql.Tx) error {
+		deleted = false
+
+		current, exists, err := s.getTx(tx, k)
+		if err != nil {
+			return err
+		}
+		if !exists || !bytes.Equal(current, expected) {
+			return nil
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE key = ?", s.opts.kvTable), k); err != nil {
+			return fmt.Errorf("deleting key: %w", err)
+		}
+		deleted = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return deleted, nil
+}
+
+// SetAndGetPrevious sets k to v, returning the value it replaced and
+// whether the key existed, within a single transaction. Expired keys are
+// reported as absent.
+func (s *SqliteStore) SetAndGetPrevious(k, v []byte) (prev []byte, existed bool, err error) {
+	if s.opts.readOnly {
+		return nil, false, ErrReadOnly
+	}
+
+	err = s.transaction(func(tx *sql.Tx) error {
+		prev, existed, err = s.getTx(tx, k)
+		if err != nil {
+			return err
+		}
+		return s.setTx(tx, k, v)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return prev, existed, nil
+}
+
+// IncrementUint64 atomically adds delta to the uint64 value of key,
+// returning the new value. A missing key is treated as 0.
+func (s *SqliteStore) IncrementUint64(key []byte, delta uint64) (uint64, error) {
+	if s.opts.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	var val uint64
+	err := s.transaction(func(tx *sql.Tx) error {
+		current, exists, err := s.getTx(tx, key)
+		if err != nil {
+			return err
+		}
+
+		val = 0
+		if exists {
+			if len(current) != 8 {
+				return fmt.Errorf("value of key %q is not a uint64", key)
+			}
+			val = bytesToUint64(current)
+		}
+
+		val += delta
+		return s.setTx(tx, key, uint64ToBytes(val))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return val, nil
+}
+
+// ScanPrefix returns all the entries whose key starts with prefix.
+func (s *SqliteStore) ScanPrefix(prefix []byte) (map[string][]byte, error) {
+	values := make(map[string][]byte)
+	err := s.IteratePrefix(prefix, func(k, v []byte) error {
+		values[string(k)] = v
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// IteratePrefix calls fn for every entry whose key starts with prefix, in
+// ascending key order, stopping at the first error returned by fn. The
+// entries are streamed from a single read transaction, so fn must not
+// call other methods of the store.
+func (s *SqliteStore) IteratePrefix(prefix []byte, fn func(k, v []byte) error) error {
+	// A range on the primary key rather than a LIKE lets sqlite use the
+	// index, and is not affected by the LIKE wildcards.
+	query := fmt.Sprintf("SELECT key, value FROM %s WHERE (expires_at IS NULL OR expires_at > ?)", s.opts.kvTable)
+	args := []any{s.opts.clock.Now().UnixNano()}
+	if len(prefix) > 0 {
+		query += " AND key >= ?"
+		args = append(args, prefix)
+	}
+	if upper := prefixUpperBound(prefix); upper != nil {
+		query += " AND key < ?"
+		args = append(args, upper)
+	}
+	query += " ORDER BY key ASC"
+
+	tx, err := s.beginRead(context.Background())
+	if err != nil {
+		return err
+	}
+	// nothing to commit, the transaction only provides a stable view
+	defer tx.Rollback()
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k, v []byte
+		if err := rows.Scan(&k, &v); err != nil {
+			return err
+		}
+
+		v, err := s.open(v)
+		if err != nil {
+			return err
+		}
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// DeletePrefix removes every entry whose key starts with prefix in a
+// single transaction, returning how many were removed. Expired entries
+// not yet swept are removed and counted as well. An empty prefix removes
+// every entry.
+func (s *SqliteStore) DeletePrefix(prefix []byte) (int64, error) {
+	if s.opts.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE 1", s.opts.kvTable)
+	var args []any
+	if len(prefix) > 0 {
+		query += " AND key >= ?"
+		args = append(args, prefix)
+	}
+	if upper := prefixUpperBound(prefix); upper != nil {
+		query += " AND key < ?"
+		args = append(args, upper)
+	}
+
+	var deleted int64
+	err := s.transaction(func(tx *sql.Tx) error {
+		res, err := tx.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		deleted, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
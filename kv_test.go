@@ -0,0 +1,239 @@
+package raftsqlite
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	// create if absent
+	swapped, err := store.CompareAndSwap([]byte("lease"), nil, []byte("node1"))
+	assertNoError(t, err)
+	assert(t, swapped, "want swap to create the missing key")
+
+	// creating again fails as the key now exists
+	swapped, err = store.CompareAndSwap([]byte("lease"), nil, []byte("node2"))
+	assertNoError(t, err)
+	assert(t, !swapped, "want swap to fail for an existing key")
+
+	// mismatch
+	swapped, err = store.CompareAndSwap([]byte("lease"), []byte("node3"), []byte("node2"))
+	assertNoError(t, err)
+	assert(t, !swapped, "want swap to fail on a mismatch")
+
+	val, err := store.Get([]byte("lease"))
+	assertNoError(t, err)
+	assert(t, string(val) == "node1", fmt.Sprintf("want node1, got: %s", val))
+
+	// successful swap
+	swapped, err = store.CompareAndSwap([]byte("lease"), []byte("node1"), []byte("node2"))
+	assertNoError(t, err)
+	assert(t, swapped, "want swap to succeed")
+
+	val, err = store.Get([]byte("lease"))
+	assertNoError(t, err)
+	assert(t, string(val) == "node2", fmt.Sprintf("want node2, got: %s", val))
+
+	// a missing key does not match a non-empty old value
+	swapped, err = store.CompareAndSwap([]byte("404"), []byte("node1"), []byte("node2"))
+	assertNoError(t, err)
+	assert(t, !swapped, "want swap to fail for a missing key")
+	_, err = store.Get([]byte("404"))
+	assert(t, err == ErrKeyNotFound, fmt.Sprintf("want not found err, got: %v", err))
+}
+
+func TestCompareAndDelete(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err := store.Set([]byte("lease"), []byte("node1"))
+	assertNoError(t, err)
+
+	// mismatch
+	deleted, err := store.CompareAndDelete([]byte("lease"), []byte("node2"))
+	assertNoError(t, err)
+	assert(t, !deleted, "want delete to fail on a mismatch")
+	val, err := store.Get([]byte("lease"))
+	assertNoError(t, err)
+	assert(t, string(val) == "node1", fmt.Sprintf("want node1, got: %s", val))
+
+	// match
+	deleted, err = store.CompareAndDelete([]byte("lease"), []byte("node1"))
+	assertNoError(t, err)
+	assert(t, deleted, "want delete to succeed")
+	_, err = store.Get([]byte("lease"))
+	assert(t, err == ErrKeyNotFound, fmt.Sprintf("want not found err, got: %v", err))
+
+	// absent key, even with an empty expected value
+	for _, expected := range [][]byte{nil, []byte("node1")} {
+		deleted, err = store.CompareAndDelete([]byte("lease"), expected)
+		assertNoError(t, err)
+		assert(t, !deleted, fmt.Sprintf("want delete to fail for a missing key, expected %q", expected))
+	}
+}
+
+func TestSetAndGetPrevious(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	prev, existed, err := store.SetAndGetPrevious([]byte("key"), []byte("v1"))
+	assertNoError(t, err)
+	assert(t, !existed && prev == nil, fmt.Sprintf("want no previous value, got: %q %v", prev, existed))
+
+	prev, existed, err = store.SetAndGetPrevious([]byte("key"), []byte("v2"))
+	assertNoError(t, err)
+	assert(t, existed && string(prev) == "v1", fmt.Sprintf("want previous value v1, got: %q %v", prev, existed))
+
+	val, err := store.Get([]byte("key"))
+	assertNoError(t, err)
+	assert(t, string(val) == "v2", fmt.Sprintf("want v2, got: %s", val))
+
+	// an existing empty value is still reported
+	err = store.Set([]byte("empty"), []byte{})
+	assertNoError(t, err)
+	_, existed, err = store.SetAndGetPrevious([]byte("empty"), []byte("v"))
+	assertNoError(t, err)
+	assert(t, existed, "want empty value reported as existing")
+}
+
+func TestIncrementUint64(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	val, err := store.IncrementUint64([]byte("counter"), 5)
+	assertNoError(t, err)
+	assert(t, val == 5, fmt.Sprintf("want 5, got: %d", val))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(delta uint64) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := store.IncrementUint64([]byte("counter"), delta); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(uint64(i + 1))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assertNoError(t, err)
+	}
+
+	// 5 + 20 * (1 + 2 + ... + 10)
+	val, err = store.GetUint64([]byte("counter"))
+	assertNoError(t, err)
+	assert(t, val == 1105, fmt.Sprintf("want 1105, got: %d", val))
+
+	err = store.Set([]byte("text"), []byte("not a number"))
+	assertNoError(t, err)
+	_, err = store.IncrementUint64([]byte("text"), 1)
+	assert(t, err != nil, "want error incrementing a non uint64 value")
+}
+
+func TestScanPrefix(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	keys := []string{"app", "app/a", "app/b", "app/c", "app0", "apq", "ap", "bpp/a"}
+	for _, k := range keys {
+		err := store.Set([]byte(k), []byte("val-"+k))
+		assertNoError(t, err)
+	}
+
+	values, err := store.ScanPrefix([]byte("app/"))
+	assertNoError(t, err)
+	assert(t, len(values) == 3, fmt.Sprintf("want 3 values, got: %d", len(values)))
+	for _, k := range []string{"app/a", "app/b", "app/c"} {
+		assert(t, string(values[k]) == "val-"+k, fmt.Sprintf("want val-%s, got: %s", k, values[k]))
+	}
+
+	var visited []string
+	err = store.IteratePrefix([]byte("app"), func(k, v []byte) error {
+		visited = append(visited, string(k))
+		return nil
+	})
+	assertNoError(t, err)
+	want := []string{"app", "app/a", "app/b", "app/c", "app0"}
+	assert(t, fmt.Sprint(visited) == fmt.Sprint(want), fmt.Sprintf("want %v, got: %v", want, visited))
+
+	// an empty prefix matches everything
+	values, err = store.ScanPrefix(nil)
+	assertNoError(t, err)
+	assert(t, len(values) == len(keys), fmt.Sprintf("want %d values, got: %d", len(keys), len(values)))
+}
+
+func TestDeletePrefix(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	keys := []string{"app/a", "app/b", "app/c", "app0", "ap", "bpp/a", "bpp/b"}
+	for _, k := range keys {
+		err := store.Set([]byte(k), []byte("val-"+k))
+		assertNoError(t, err)
+	}
+
+	deleted, err := store.DeletePrefix([]byte("app/"))
+	assertNoError(t, err)
+	assert(t, deleted == 3, fmt.Sprintf("want 3 deleted, got: %d", deleted))
+
+	remaining, err := store.Keys()
+	assertNoError(t, err)
+	want := []string{"ap", "app0", "bpp/a", "bpp/b"}
+	got := make([]string, 0, len(remaining))
+	for _, k := range remaining {
+		got = append(got, string(k))
+	}
+	assert(t, fmt.Sprint(got) == fmt.Sprint(want), fmt.Sprintf("want %v, got: %v", want, got))
+
+	// deleting again finds nothing
+	deleted, err = store.DeletePrefix([]byte("app/"))
+	assertNoError(t, err)
+	assert(t, deleted == 0, fmt.Sprintf("want 0 deleted, got: %d", deleted))
+
+	// an empty prefix deletes everything
+	deleted, err = store.DeletePrefix(nil)
+	assertNoError(t, err)
+	assert(t, deleted == int64(len(want)), fmt.Sprintf("want %d deleted, got: %d", len(want), deleted))
+}
+
+func TestPrefixUpperBound(t *testing.T) {
+	tests := []struct {
+		prefix, want []byte
+	}{
+		{[]byte("abc"), []byte("abd")},
+		{[]byte{'a', 0xff}, []byte{'b'}},
+		{[]byte{0xff, 0xff}, nil},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		got := prefixUpperBound(tt.prefix)
+		assert(t, string(got) == string(tt.want) && (got == nil) == (tt.want == nil), fmt.Sprintf("prefixUpperBound(%q): want %q, got: %q", tt.prefix, tt.want, got))
+	}
+}
@@ -0,0 +1,148 @@
+package raftsqlite
+
+import (
+	"sync"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+	"github.com/hashicorp/raft"
+)
+
+// logCache is an LRU cache of decoded logs keyed by index. A nil
+// *logCache caches nothing.
+//
+// The logs are invalidated once the writes replacing or deleting them
+// commit. A read racing with such a write may load the log as it was
+// before the write and only add it to the cache after the invalidation,
+// so every invalidation bumps a generation, and a log is only added if
+// no invalidation happened since its read started.
+type logCache struct {
+	mu  sync.Mutex
+	lru *simplelru.LRU[uint64, *raft.Log]
+	gen uint64
+
+	hits, misses uint64
+}
+
+// newLogCache returns a cache holding up to size logs, or nil if size is
+// 0.
+func newLogCache(size int) *logCache {
+	if size == 0 {
+		return nil
+	}
+	// only fails for a size that validate rejects
+	lru, _ := simplelru.NewLRU[uint64, *raft.Log](size, nil)
+	return &logCache{lru: lru}
+}
+
+// get returns the cached log at idx. The log must not be modified.
+func (c *logCache) get(idx uint64) (*raft.Log, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	log, ok := c.lru.Get(idx)
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	return log, ok
+}
+
+// generation returns the current generation, to be taken before reading
+// the logs given to add.
+func (c *logCache) generation() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// add caches copies of logs, read since generation gen, unless they may
+// have been invalidated since.
+func (c *logCache) add(gen uint64, logs ...*raft.Log) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		return
+	}
+	for _, log := range logs {
+		cached := *log
+		c.lru.Add(log.Index, &cached)
+	}
+}
+
+// remove invalidates the logs at the given indexes.
+func (c *logCache) remove(idxs ...uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for _, idx := range idxs {
+		c.lru.Remove(idx)
+	}
+}
+
+// removeLogs invalidates the logs at the indexes of logs.
+func (c *logCache) removeLogs(logs []*raft.Log) {
+	if c == nil {
+		return
+	}
+
+	idxs := make([]uint64, len(logs))
+	for i, log := range logs {
+		idxs[i] = log.Index
+	}
+	c.remove(idxs...)
+}
+
+// removeRange invalidates the logs between min and max inclusively.
+func (c *logCache) removeRange(min, max uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for _, idx := range c.lru.Keys() {
+		if idx >= min && idx <= max {
+			c.lru.Remove(idx)
+		}
+	}
+}
+
+// purge invalidates every log.
+func (c *logCache) purge() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.lru.Purge()
+}
+
+// stats returns the number of cache hits and misses.
+func (c *logCache) stats() (hits, misses uint64) {
+	if c == nil {
+		return 0, 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
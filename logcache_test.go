@@ -0,0 +1,92 @@
+package raftsqlite
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestWithLogCache(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithLogCache(100))
+	assertNoError(t, err)
+	defer store.Close()
+
+	storeLogRange(t, store, 1, 10, "log")
+
+	log := new(raft.Log)
+	err = store.GetLog(5, log)
+	assertNoError(t, err)
+	err = store.GetLog(5, log)
+	assertNoError(t, err)
+	assert(t, log.Index == 5 && string(log.Data) == "log", fmt.Sprintf("want log 5, got: %d %q", log.Index, log.Data))
+	stats, err := store.Stats()
+	assertNoError(t, err)
+	assert(t, stats.LogCacheHits == 1 && stats.LogCacheMisses == 1, fmt.Sprintf("want 1 hit and 1 miss, got: %d and %d", stats.LogCacheHits, stats.LogCacheMisses))
+
+	// the cached logs are served without querying, even once deleted
+	// behind the back of the store
+	_, err = store.db.Exec("DELETE FROM logs WHERE idx IN (2, 5)")
+	assertNoError(t, err)
+	err = store.GetLog(5, log)
+	assertNoError(t, err)
+	assert(t, log.Index == 5, fmt.Sprintf("want log 5, got: %d", log.Index))
+	err = store.GetLog(2, log)
+	assert(t, errors.Is(err, raft.ErrLogNotFound), fmt.Sprintf("want log not found err, got: %v", err))
+
+	// GetLogs fills the cache as well
+	logs, err := store.GetLogs(6, 8)
+	assertNoError(t, err)
+	assert(t, len(logs) == 3, fmt.Sprintf("want 3 logs, got: %d", len(logs)))
+	_, err = store.db.Exec("DELETE FROM logs WHERE idx = 7")
+	assertNoError(t, err)
+	err = store.GetLog(7, log)
+	assertNoError(t, err)
+	logs, err = store.GetLogs(6, 8)
+	assertNoError(t, err)
+	assert(t, len(logs) == 3 && logs[1].Index == 7, fmt.Sprintf("want logs 6 to 8, got: %v", logs))
+
+	// deleting the logs invalidates them
+	err = store.DeleteRange(5, 7)
+	assertNoError(t, err)
+	for _, idx := range []uint64{5, 6, 7} {
+		err = store.GetLog(idx, log)
+		assert(t, errors.Is(err, raft.ErrLogNotFound), fmt.Sprintf("want log %d not found err, got: %v", idx, err))
+	}
+	err = store.GetLog(8, log)
+	assertNoError(t, err)
+}
+
+func TestWithLogCacheUpsert(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithLogCache(10), WithUpsertLogs(true))
+	assertNoError(t, err)
+	defer store.Close()
+
+	storeLogRange(t, store, 1, 3, "old")
+
+	log := new(raft.Log)
+	err = store.GetLog(2, log)
+	assertNoError(t, err)
+	assert(t, string(log.Data) == "old", fmt.Sprintf("want old, got: %q", log.Data))
+
+	// overwriting a log invalidates it
+	err = store.StoreLog(createRaftLog(2, "new"))
+	assertNoError(t, err)
+	err = store.GetLog(2, log)
+	assertNoError(t, err)
+	assert(t, string(log.Data) == "new", fmt.Sprintf("want new, got: %q", log.Data))
+
+	err = store.StoreLogs([]*raft.Log{createRaftLog(1, "newer"), createRaftLog(2, "newer")})
+	assertNoError(t, err)
+	logs, err := store.GetLogs(1, 3)
+	assertNoError(t, err)
+	assert(t, string(logs[0].Data) == "newer" && string(logs[1].Data) == "newer" && string(logs[2].Data) == "old",
+		fmt.Sprintf("want the overwritten logs, got: %q %q %q", logs[0].Data, logs[1].Data, logs[2].Data))
+
+	// the cached logs are copies of the ones given
+	logs[2].Data = []byte("changed")
+	err = store.GetLog(3, log)
+	assertNoError(t, err)
+	assert(t, string(log.Data) == "old", fmt.Sprintf("want old, got: %q", log.Data))
+}
@@ -0,0 +1,97 @@
+package raftsqlite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// migrateBatchSize is the number of logs MigrateFromLogStore copies per
+// transaction.
+const migrateBatchSize = 1000
+
+// MigrateFromLogStore copies the logs of src, from its first to its last
+// index, and the given keys of srcStable into the store, such as when
+// moving a node from raft-boltdb. As a StableStore can't list its keys,
+// they must be given explicitly, defaulting to the keys raft itself uses
+// when none are. Keys missing from srcStable are skipped, and srcStable
+// may be nil to only copy the logs. The logs are copied in batches of
+// separate transactions, so a failed migration may leave some of them
+// behind, it is meant to target an empty store.
+func (s *SqliteStore) MigrateFromLogStore(src raft.LogStore, srcStable raft.StableStore, keys ...[]byte) error {
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+
+	first, err := src.FirstIndex()
+	if err != nil {
+		return fmt.Errorf("reading source first index: %w", err)
+	}
+	last, err := src.LastIndex()
+	if err != nil {
+		return fmt.Errorf("reading source last index: %w", err)
+	}
+
+	batch := make([]*raft.Log, 0, migrateBatchSize)
+	for idx := first; idx != 0 && idx <= last; idx++ {
+		log := new(raft.Log)
+		if err := src.GetLog(idx, log); err != nil {
+			if errors.Is(err, raft.ErrLogNotFound) {
+				continue
+			}
+			return fmt.Errorf("reading source log %d: %w", idx, err)
+		}
+
+		batch = append(batch, log)
+		if len(batch) == migrateBatchSize {
+			if err := s.StoreLogs(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := s.StoreLogs(batch); err != nil {
+			return err
+		}
+	}
+
+	if srcStable == nil {
+		return nil
+	}
+	if len(keys) == 0 {
+		keys = [][]byte{keyCurrentTerm, keyLastVoteTerm, keyLastVoteCand}
+	}
+
+	pairs := make(map[string][]byte, len(keys))
+	for _, k := range keys {
+		v, err := getStable(srcStable, k)
+		if err != nil {
+			// the error raft stores return for missing keys, which raft
+			// itself matches by message
+			if err.Error() == ErrKeyNotFound.Error() {
+				continue
+			}
+			return fmt.Errorf("reading source key %q: %w", k, err)
+		}
+		pairs[string(k)] = v
+	}
+	return s.SetMany(pairs)
+}
+
+// getStable returns the value of k in stable. The keys raft stores as
+// uint64 are read with GetUint64, as some stores, like raft.InmemStore,
+// keep those apart from the other values.
+func getStable(stable raft.StableStore, k []byte) ([]byte, error) {
+	if !bytes.Equal(k, keyCurrentTerm) && !bytes.Equal(k, keyLastVoteTerm) {
+		return stable.Get(k)
+	}
+
+	v, err := stable.GetUint64(k)
+	if err != nil {
+		return nil, err
+	}
+	return uint64ToBytes(v), nil
+}
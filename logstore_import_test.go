@@ -0,0 +1,62 @@
+package raftsqlite
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestMigrateFromLogStore(t *testing.T) {
+	src := raft.NewInmemStore()
+	for i := uint64(10); i < 10+migrateBatchSize+5; i++ {
+		err := src.StoreLog(&raft.Log{Index: i, Term: i / 100, Type: raft.LogCommand, Data: []byte(fmt.Sprint(i))})
+		assertNoError(t, err)
+	}
+	err := src.SetUint64(keyCurrentTerm, 7)
+	assertNoError(t, err)
+	err = src.Set(keyLastVoteCand, []byte("node1"))
+	assertNoError(t, err)
+	err = src.Set([]byte("custom"), []byte("value"))
+	assertNoError(t, err)
+
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err = store.MigrateFromLogStore(src, src)
+	assertNoError(t, err)
+
+	first, err := store.FirstIndex()
+	assertNoError(t, err)
+	last, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, first == 10 && last == 10+migrateBatchSize+4, fmt.Sprintf("want range [10, %d], got: [%d, %d]", 10+migrateBatchSize+4, first, last))
+
+	for i := first; i <= last; i++ {
+		want, got := new(raft.Log), new(raft.Log)
+		assertNoError(t, src.GetLog(i, want))
+		assertNoError(t, store.GetLog(i, got))
+		assert(t, got.Index == want.Index && got.Term == want.Term && string(got.Data) == string(want.Data),
+			fmt.Sprintf("want log %+v, got: %+v", want, got))
+	}
+
+	term, err := store.GetUint64(keyCurrentTerm)
+	assertNoError(t, err)
+	assert(t, term == 7, fmt.Sprintf("want current term 7, got: %d", term))
+	cand, err := store.Get(keyLastVoteCand)
+	assertNoError(t, err)
+	assert(t, string(cand) == "node1", fmt.Sprintf("want last vote candidate node1, got: %s", cand))
+
+	// only the given keys are copied
+	_, err = store.Get([]byte("custom"))
+	assert(t, err == ErrKeyNotFound, fmt.Sprintf("want not found err, got: %v", err))
+
+	err = store.MigrateFromLogStore(raft.NewInmemStore(), src, []byte("custom"))
+	assertNoError(t, err)
+	custom, err := store.Get([]byte("custom"))
+	assertNoError(t, err)
+	assert(t, string(custom) == "value", fmt.Sprintf("want value, got: %s", custom))
+}
@@ -0,0 +1,155 @@
+package raftsqlite
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collector exposes the metrics of a SqliteStore to Prometheus.
+type collector struct {
+	s *SqliteStore
+
+	logs         *prometheus.Desc
+	firstIndex   *prometheus.Desc
+	lastIndex    *prometheus.Desc
+	dbSize       *prometheus.Desc
+	walSize      *prometheus.Desc
+	transactions *prometheus.Desc
+	retries      *prometheus.Desc
+}
+
+// Collector returns a prometheus.Collector exposing the number of logs,
+// the first and last indexes, the sizes of the database and WAL files,
+// and the number of committed and retried transactions. The values are
+// queried on each scrape. The file sizes are 0 for in-memory stores and
+// for stores created from an existing *sql.DB.
+func (s *SqliteStore) Collector() prometheus.Collector {
+	return &collector{
+		s:            s,
+		logs:         prometheus.NewDesc("raftsqlite_logs", "Number of logs stored.", nil, nil),
+		firstIndex:   prometheus.NewDesc("raftsqlite_first_index", "First stored log index, 0 if there are no logs.", nil, nil),
+		lastIndex:    prometheus.NewDesc("raftsqlite_last_index", "Last stored log index, 0 if there are no logs.", nil, nil),
+		dbSize:       prometheus.NewDesc("raftsqlite_db_size_bytes", "Size of the database file in bytes.", nil, nil),
+		walSize:      prometheus.NewDesc("raftsqlite_wal_size_bytes", "Size of the -wal file in bytes.", nil, nil),
+		transactions: prometheus.NewDesc("raftsqlite_transactions_total", "Number of committed transactions.", nil, nil),
+		retries:      prometheus.NewDesc("raftsqlite_transaction_retries_total", "Number of transaction attempts retried after a busy error.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.logs
+	ch <- c.firstIndex
+	ch <- c.lastIndex
+	ch <- c.dbSize
+	ch <- c.walSize
+	ch <- c.transactions
+	ch <- c.retries
+}
+
+// Collect implements prometheus.Collector. A failed query is reported as
+// an invalid metric rather than failing the whole scrape.
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.s
+
+	if count, err := s.CountLogs(); err != nil {
+		ch <- prometheus.NewInvalidMetric(c.logs, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.logs, prometheus.GaugeValue, float64(count))
+	}
+
+	// the bounds table holds a single row, unlike the logs table
+	var first, last uint64
+	err := s.withReconnect(func() (err error) {
+		first, last, err = s.bounds(context.Background(), s.readDB)
+		return err
+	})
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.firstIndex, err)
+		ch <- prometheus.NewInvalidMetric(c.lastIndex, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.firstIndex, prometheus.GaugeValue, float64(first))
+		ch <- prometheus.MustNewConstMetric(c.lastIndex, prometheus.GaugeValue, float64(last))
+	}
+
+	// stat the files rather than calling DiskUsage, which queries the
+	// database as well
+	sizes := []struct {
+		desc   *prometheus.Desc
+		suffix string
+	}{
+		{c.dbSize, ""},
+		{c.walSize, "-wal"},
+	}
+	file := dsnFilePath(s.path)
+	for _, sz := range sizes {
+		var n int64
+		if file != "" {
+			var err error
+			if n, err = fileSizeIfExists(file + sz.suffix); err != nil {
+				ch <- prometheus.NewInvalidMetric(sz.desc, err)
+				continue
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(sz.desc, prometheus.GaugeValue, float64(n))
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.transactions, prometheus.CounterValue, float64(s.txCount.Load()))
+	ch <- prometheus.MustNewConstMetric(c.retries, prometheus.CounterValue, float64(s.txRetries.Load()))
+}
+
+// expvarStats is an expvar.Var publishing the Stats of a store. The store
+// can be swapped, as expvar doesn't allow publishing a name twice.
+type expvarStats struct {
+	mu sync.Mutex
+	s  *SqliteStore
+}
+
+// String implements expvar.Var.
+func (v *expvarStats) String() string {
+	v.mu.Lock()
+	s := v.s
+	v.mu.Unlock()
+
+	var out any
+	stats, err := s.Stats()
+	if err != nil {
+		out = map[string]string{"error": err.Error()}
+	} else {
+		out = stats
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return "null"
+	}
+	return string(b)
+}
+
+// publishMu serializes PublishExpvar, so checking whether a name is
+// already published and publishing it are atomic.
+var publishMu sync.Mutex
+
+// PublishExpvar publishes the Stats of the store as JSON under name with
+// the expvar package, served at /debug/vars by the default HTTP mux. The
+// stats are gathered each time the variable is read. Publishing a name
+// already published by a store, this one or another, makes it report this
+// store instead. A name published by something else is left untouched.
+func (s *SqliteStore) PublishExpvar(name string) {
+	publishMu.Lock()
+	defer publishMu.Unlock()
+
+	switch v := expvar.Get(name).(type) {
+	case nil:
+		expvar.Publish(name, &expvarStats{s: s})
+	case *expvarStats:
+		v.mu.Lock()
+		v.s = s
+		v.mu.Unlock()
+	default:
+		s.opts.logger.Warn("expvar name is already in use", "name", name)
+	}
+}
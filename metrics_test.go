@@ -0,0 +1,105 @@
+package raftsqlite
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 3, 12, "log")
+
+	reg := prometheus.NewRegistry()
+	err := reg.Register(store.Collector())
+	assertNoError(t, err)
+
+	families, err := reg.Gather()
+	assertNoError(t, err)
+	names := make(map[string]bool)
+	for _, f := range families {
+		names[f.GetName()] = true
+	}
+	for _, name := range []string{
+		"raftsqlite_logs",
+		"raftsqlite_first_index",
+		"raftsqlite_last_index",
+		"raftsqlite_db_size_bytes",
+		"raftsqlite_wal_size_bytes",
+		"raftsqlite_transactions_total",
+		"raftsqlite_transaction_retries_total",
+	} {
+		assert(t, names[name], fmt.Sprintf("want metric family %s, got: %v", name, names))
+	}
+
+	expected := `
+# HELP raftsqlite_logs Number of logs stored.
+# TYPE raftsqlite_logs gauge
+raftsqlite_logs 10
+# HELP raftsqlite_first_index First stored log index, 0 if there are no logs.
+# TYPE raftsqlite_first_index gauge
+raftsqlite_first_index 3
+# HELP raftsqlite_last_index Last stored log index, 0 if there are no logs.
+# TYPE raftsqlite_last_index gauge
+raftsqlite_last_index 12
+`
+	err = testutil.GatherAndCompare(reg, strings.NewReader(expected), "raftsqlite_logs", "raftsqlite_first_index", "raftsqlite_last_index")
+	assertNoError(t, err)
+
+	families, err = reg.Gather()
+	assertNoError(t, err)
+	for _, f := range families {
+		switch f.GetName() {
+		case "raftsqlite_db_size_bytes":
+			v := f.GetMetric()[0].GetGauge().GetValue()
+			assert(t, v > 0, fmt.Sprintf("want a database size, got: %v", v))
+		case "raftsqlite_transactions_total":
+			v := f.GetMetric()[0].GetCounter().GetValue()
+			assert(t, v > 0, fmt.Sprintf("want committed transactions, got: %v", v))
+		}
+	}
+}
+
+func TestPublishExpvar(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 5, "log")
+
+	name := "raftsqlite_test_" + t.Name()
+	store.PublishExpvar(name)
+	// publishing again must not panic
+	store.PublishExpvar(name)
+
+	v := expvar.Get(name)
+	assert(t, v != nil, "want the var to be published")
+	var stats Stats
+	err := json.Unmarshal([]byte(v.String()), &stats)
+	assertNoError(t, err)
+	assert(t, stats.LogCount == 5, fmt.Sprintf("want 5 logs, got: %d", stats.LogCount))
+	assert(t, stats.FirstIndex == 1 && stats.LastIndex == 5, fmt.Sprintf("want range [1, 5], got: [%d, %d]", stats.FirstIndex, stats.LastIndex))
+
+	// a name published by another store reports the latest one
+	other := mustSqliteDiskStore(t)
+	defer func() {
+		other.Close()
+		other.deleteDB()
+	}()
+	other.PublishExpvar(name)
+	err = json.Unmarshal([]byte(expvar.Get(name).String()), &stats)
+	assertNoError(t, err)
+	assert(t, stats.LogCount == 0, fmt.Sprintf("want 0 logs, got: %d", stats.LogCount))
+}
@@ -0,0 +1,234 @@
+package raftsqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// ErrSchemaTooNew is returned when opening a database whose schema was
+// written by a newer version of this package.
+var ErrSchemaTooNew = errors.New("database schema is newer than supported")
+
+// ErrSchemaOutdated is returned when opening a database in read-only mode
+// whose schema needs to be migrated.
+var ErrSchemaOutdated = errors.New("database schema is outdated")
+
+// migration upgrades the schema of a store by one version.
+type migration func(tx *sql.Tx, s *SqliteStore) error
+
+// migrations holds the ordered schema upgrade steps, migrations[i]
+// upgrades the schema from version i to i+1. Version 0 is a database
+// without the store tables, or one created before schema versioning.
+// Steps must never be changed once released, only appended.
+var migrations = []migration{
+	// v1: logs and kv tables
+	func(tx *sql.Tx, s *SqliteStore) error {
+		_, err := tx.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (idx INTEGER PRIMARY KEY, data BLOB)", s.opts.logsTable))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (key TEXT PRIMARY KEY, value BLOB)", s.opts.kvTable))
+		return err
+	},
+	// v2: per log checksum, NULL for logs stored before or without it
+	func(tx *sql.Tx, s *SqliteStore) error {
+		_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN crc INTEGER", s.opts.logsTable))
+		return err
+	},
+	// v3: optional expiration of the kv entries, in unix nanoseconds
+	func(tx *sql.Tx, s *SqliteStore) error {
+		_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN expires_at INTEGER", s.opts.kvTable))
+		return err
+	},
+	// v4: indexed log term, backfilled from the existing logs
+	func(tx *sql.Tx, s *SqliteStore) error {
+		_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN term INTEGER NOT NULL DEFAULT 0", s.opts.logsTable))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_term ON %[1]s (term)", s.opts.logsTable))
+		if err != nil {
+			return err
+		}
+
+		// collect the terms first, as the table can't be safely updated
+		// while it is being read
+		rows, err := tx.Query(fmt.Sprintf("SELECT idx, data FROM %s", s.opts.logsTable))
+		if err != nil {
+			return err
+		}
+		terms := make(map[uint64]uint64)
+		for rows.Next() {
+			var idx uint64
+			var data []byte
+			if err := rows.Scan(&idx, &data); err != nil {
+				rows.Close()
+				return err
+			}
+
+			var log raft.Log
+			if err := s.decodeLog(data, nil, &log); err != nil {
+				rows.Close()
+				return fmt.Errorf("decoding log %d: %w", idx, err)
+			}
+			terms[idx] = log.Term
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for idx, term := range terms {
+			_, err := tx.Exec(fmt.Sprintf("UPDATE %s SET term = ? WHERE idx = ?", s.opts.logsTable), term, idx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// v5: persisted first and last log indexes
+	func(tx *sql.Tx, s *SqliteStore) error {
+		_, err := tx.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id INTEGER PRIMARY KEY CHECK (id = 0), first_index INTEGER, last_index INTEGER)", s.boundsTable()))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(fmt.Sprintf("INSERT INTO %[1]s (id, first_index, last_index) SELECT 0, MIN(idx), MAX(idx) FROM %[2]s", s.boundsTable(), s.opts.logsTable))
+		return err
+	},
+	// v6: snapshots, shared by the stores of a database and keyed by the
+	// logs table name
+	func(tx *sql.Tx, s *SqliteStore) error {
+		_, err := tx.Exec("CREATE TABLE IF NOT EXISTS snapshot_meta (store TEXT NOT NULL, id TEXT NOT NULL, version INTEGER NOT NULL, " +
+			"idx INTEGER NOT NULL, term INTEGER NOT NULL, configuration BLOB, configuration_index INTEGER NOT NULL, size INTEGER NOT NULL, " +
+			"PRIMARY KEY (store, id))")
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("CREATE TABLE IF NOT EXISTS snapshots (store TEXT NOT NULL, id TEXT NOT NULL, seq INTEGER NOT NULL, data BLOB, " +
+			"PRIMARY KEY (store, id, seq))")
+		return err
+	},
+	// v7: per store settings, starting with the log encoding. Logs stored
+	// before it were always encoded with msgpack.
+	func(tx *sql.Tx, s *SqliteStore) error {
+		_, err := tx.Exec("CREATE TABLE IF NOT EXISTS store_meta (store TEXT NOT NULL, key TEXT NOT NULL, value TEXT, PRIMARY KEY (store, key))")
+		if err != nil {
+			return err
+		}
+
+		var logs int
+		err = tx.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM (SELECT 1 FROM %s LIMIT 1)", s.opts.logsTable)).Scan(&logs)
+		if err != nil {
+			return err
+		}
+		encoding := s.opts.encoding.Name()
+		if logs > 0 {
+			encoding = NewMsgpackEncoding().Name()
+		}
+
+		_, err = tx.Exec("INSERT OR IGNORE INTO store_meta (store, key, value) VALUES (?, 'encoding', ?)", s.opts.logsTable, encoding)
+		return err
+	},
+	// v8: indexed time the logs were stored at, in unix nanoseconds, NULL
+	// for logs stored before it
+	func(tx *sql.Tx, s *SqliteStore) error {
+		_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN appended_at INTEGER", s.opts.logsTable))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_appended_at ON %[1]s (appended_at)", s.opts.logsTable))
+		return err
+	},
+	// v9: file of the blob directory holding the data of the log, NULL
+	// for logs stored inline
+	func(tx *sql.Tx, s *SqliteStore) error {
+		_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN blob_file TEXT", s.opts.logsTable))
+		return err
+	},
+	// v10: deduplicated log payloads, shared by the logs referencing them
+	// by hash
+	func(tx *sql.Tx, s *SqliteStore) error {
+		_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN payload_hash BLOB", s.opts.logsTable))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (hash BLOB PRIMARY KEY, payload BLOB NOT NULL, refs INTEGER NOT NULL) WITHOUT ROWID", s.payloadsTable()))
+		return err
+	},
+}
+
+// migrate upgrades the store schema to the latest version within a
+// single transaction. The version is tracked per store in the
+// schema_meta table, keyed by the logs table name, so stores sharing a
+// database are migrated independently.
+func (s *SqliteStore) migrate(ctx context.Context) error {
+	if s.opts.readOnly {
+		return s.checkSchema(ctx)
+	}
+
+	return s.transactionCtx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec("CREATE TABLE IF NOT EXISTS schema_meta (store TEXT PRIMARY KEY, version INTEGER NOT NULL)")
+		if err != nil {
+			return err
+		}
+
+		var version int
+		err = tx.QueryRow("SELECT version FROM schema_meta WHERE store = ?", s.opts.logsTable).Scan(&version)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		latest := len(migrations)
+		if version > latest {
+			return fmt.Errorf("%w: found version %d, want at most %d", ErrSchemaTooNew, version, latest)
+		}
+		if version == latest {
+			return nil
+		}
+
+		s.opts.logger.Debug("migrating schema", "logs", s.opts.logsTable, "kv", s.opts.kvTable, "from", version, "to", latest)
+		for v := version; v < latest; v++ {
+			if err := migrations[v](tx, s); err != nil {
+				return fmt.Errorf("migrating schema to version %d: %w", v+1, err)
+			}
+		}
+
+		_, err = tx.Exec("INSERT OR REPLACE INTO schema_meta (store, version) VALUES (?, ?)", s.opts.logsTable, latest)
+		return err
+	})
+}
+
+// checkSchema verifies that the store schema is at the latest version,
+// without migrating it.
+func (s *SqliteStore) checkSchema(ctx context.Context) error {
+	var version, tables int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_meta'").Scan(&tables)
+	if err != nil {
+		return err
+	}
+	if tables > 0 {
+		err := s.db.QueryRowContext(ctx, "SELECT version FROM schema_meta WHERE store = ?", s.opts.logsTable).Scan(&version)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+
+	latest := len(migrations)
+	if version > latest {
+		return fmt.Errorf("%w: found version %d, want at most %d", ErrSchemaTooNew, version, latest)
+	}
+	if version < latest {
+		return fmt.Errorf("%w: found version %d, want %d", ErrSchemaOutdated, version, latest)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package raftsqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func schemaVersion(t testing.TB, store *SqliteStore) int {
+	t.Helper()
+
+	var version int
+	err := store.db.QueryRow("SELECT version FROM schema_meta WHERE store = ?", store.opts.logsTable).Scan(&version)
+	assertNoError(t, err)
+	return version
+}
+
+// schemaDowngrades undo the migrations of the default store,
+// schemaDowngrades[v] reverting the schema from version v to v-1.
+var schemaDowngrades = map[int][]string{
+	4:  {"DROP INDEX logs_term", "ALTER TABLE logs DROP COLUMN term"},
+	5:  {"DROP TABLE logs_bounds"},
+	6:  {"DROP TABLE snapshot_meta", "DROP TABLE snapshots"},
+	7:  {"DROP TABLE store_meta"},
+	8:  {"DROP INDEX logs_appended_at", "ALTER TABLE logs DROP COLUMN appended_at"},
+	9:  {"ALTER TABLE logs DROP COLUMN blob_file"},
+	10: {"DROP TABLE logs_payloads", "ALTER TABLE logs DROP COLUMN payload_hash"},
+}
+
+// downgradeSchema reverts the schema of the default store to version,
+// as if the database was written by an older release.
+func downgradeSchema(t testing.TB, store *SqliteStore, version int) {
+	t.Helper()
+
+	for v := len(migrations); v > version; v-- {
+		stmts, ok := schemaDowngrades[v]
+		assert(t, ok, fmt.Sprintf("no downgrade from schema version %d", v))
+		for _, stmt := range stmts {
+			_, err := store.db.Exec(stmt)
+			assertNoError(t, err)
+		}
+	}
+
+	_, err := store.db.Exec("UPDATE schema_meta SET version = ? WHERE store = ?", version, store.opts.logsTable)
+	assertNoError(t, err)
+}
+
+func TestMigrate(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStore(path)
+	assertNoError(t, err)
+	err = store.StoreLog(createRaftLog(1, "log1"))
+	assertNoError(t, err)
+	assert(t, schemaVersion(t, store) == len(migrations), "want schema at the latest version")
+	store.Close()
+
+	// simulate a newer release with an extra migration
+	runs := 0
+	defer func(m []migration) { migrations = m }(migrations)
+	migrations = append(migrations[:len(migrations):len(migrations)], func(tx *sql.Tx, s *SqliteStore) error {
+		runs++
+		_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN extra INTEGER", s.opts.logsTable))
+		return err
+	})
+
+	for i := 0; i < 2; i++ {
+		store, err = NewStore(path)
+		assertNoError(t, err)
+		assert(t, schemaVersion(t, store) == len(migrations), "want schema at the latest version")
+
+		// existing data survives the migration
+		idx, err := store.LastIndex()
+		assertNoError(t, err)
+		assert(t, idx == 1, fmt.Sprintf("want last index 1, got: %d", idx))
+		store.Close()
+	}
+	assert(t, runs == 1, fmt.Sprintf("want migration to run once, ran %d times", runs))
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+
+	// a database created before schema versioning
+	db, err := sql.Open(driverName, path)
+	assertNoError(t, err)
+	_, err = db.Exec("CREATE TABLE logs (idx INTEGER PRIMARY KEY, data BLOB)")
+	assertNoError(t, err)
+	_, err = db.Exec("CREATE TABLE kv (key TEXT PRIMARY KEY, value BLOB)")
+	assertNoError(t, err)
+	db.Close()
+
+	store, err := NewStore(path)
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+	assert(t, schemaVersion(t, store) == len(migrations), "want schema at the latest version")
+}
+
+func TestMigrateSchemaTooNew(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStore(path)
+	assertNoError(t, err)
+	_, err = store.db.Exec("UPDATE schema_meta SET version = ?", len(migrations)+1)
+	assertNoError(t, err)
+	store.Close()
+
+	_, err = NewStore(path)
+	assert(t, errors.Is(err, ErrSchemaTooNew), fmt.Sprintf("want schema too new err, got: %v", err))
+}
+
+func TestMigrateLogTerm(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStore(path)
+	assertNoError(t, err)
+
+	logs := []*raft.Log{
+		{Index: 1, Term: 1, Data: []byte("log1")},
+		{Index: 2, Term: 1, Data: []byte("log2")},
+		{Index: 3, Term: 4, Data: []byte("log3")},
+	}
+	err = store.StoreLogs(logs)
+	assertNoError(t, err)
+
+	// downgrade the database to the schema before the term column
+	downgradeSchema(t, store, 3)
+	store.Close()
+
+	store, err = NewStore(path)
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	for _, log := range logs {
+		term, err := store.GetLogTerm(log.Index)
+		assertNoError(t, err)
+		assert(t, term == log.Term, fmt.Sprintf("want term %d for index %d, got: %d", log.Term, log.Index, term))
+	}
+}
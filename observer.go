@@ -0,0 +1,20 @@
+package raftsqlite
+
+import "time"
+
+// Observer is notified about the operations performed by a SqliteStore,
+// e.g. to export metrics. Its methods are called after the operation's
+// transaction commits and must not block.
+type Observer interface {
+	// ObserveStoreLogs is called after count logs were stored in d.
+	ObserveStoreLogs(count int, d time.Duration)
+
+	// ObserveDeleteRange is called after deleted logs were removed in d.
+	ObserveDeleteRange(deleted int64, d time.Duration)
+}
+
+// noopObserver is the default Observer and does nothing.
+type noopObserver struct{}
+
+func (noopObserver) ObserveStoreLogs(int, time.Duration)     {}
+func (noopObserver) ObserveDeleteRange(int64, time.Duration) {}
@@ -0,0 +1,61 @@
+package raftsqlite
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+type capturingObserver struct {
+	mu        sync.Mutex
+	stored    []int
+	deleted   []int64
+	durations []time.Duration
+}
+
+func (o *capturingObserver) ObserveStoreLogs(count int, d time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stored = append(o.stored, count)
+	o.durations = append(o.durations, d)
+}
+
+func (o *capturingObserver) ObserveDeleteRange(deleted int64, d time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.deleted = append(o.deleted, deleted)
+	o.durations = append(o.durations, d)
+}
+
+func TestObserver(t *testing.T) {
+	obs := &capturingObserver{}
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithObserver(obs))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	logs := []*raft.Log{
+		createRaftLog(1, "log1"),
+		createRaftLog(2, "log2"),
+		createRaftLog(3, "log3"),
+	}
+	err = store.StoreLogs(logs)
+	assertNoError(t, err)
+	assert(t, len(obs.stored) == 1, fmt.Sprintf("want 1 store observation, got: %d", len(obs.stored)))
+	assert(t, obs.stored[0] == 3, fmt.Sprintf("want 3 stored logs, got: %d", obs.stored[0]))
+
+	err = store.DeleteRange(1, 2)
+	assertNoError(t, err)
+	assert(t, len(obs.deleted) == 1, fmt.Sprintf("want 1 delete observation, got: %d", len(obs.deleted)))
+	assert(t, obs.deleted[0] == 2, fmt.Sprintf("want 2 deleted logs, got: %d", obs.deleted[0]))
+
+	// failed operations are not observed
+	err = store.StoreLogs([]*raft.Log{createRaftLog(3, "log3")})
+	assert(t, err != nil, "want error storing a duplicate index, got nil")
+	assert(t, len(obs.stored) == 1, fmt.Sprintf("want 1 store observation, got: %d", len(obs.stored)))
+}
@@ -0,0 +1,844 @@
+package raftsqlite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// identifierRe matches the names that can safely be interpolated as
+// identifiers in the store queries.
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Option configures a SqliteStore created with NewStoreWithOptions.
+type Option func(*options)
+
+// options holds the configurable settings of a SqliteStore.
+type options struct {
+	// synchronous is the value for PRAGMA synchronous.
+	synchronous string
+
+	// journalMode is the value for PRAGMA journal_mode.
+	journalMode string
+
+	// busyTimeout is how long sqlite waits on a locked database before
+	// returning SQLITE_BUSY.
+	busyTimeout time.Duration
+
+	// maxRetries is how many times a transaction is retried when the
+	// database is busy or locked.
+	maxRetries int
+
+	// observer is notified about the store operations.
+	observer Observer
+
+	// logger receives the store debug and error logs.
+	logger *slog.Logger
+
+	// logsTable is the name of the table holding the raft logs.
+	logsTable string
+
+	// kvTable is the name of the table holding the stable store keys.
+	kvTable string
+
+	// encoding serializes the logs.
+	encoding Encoding
+
+	// codec compresses the log blobs, nil disables compression.
+	codec Codec
+
+	// encryptor encrypts the log blobs and kv values, nil disables
+	// encryption.
+	encryptor Encryptor
+
+	// Connection pool settings, see the equivalent sql.DB methods.
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+
+	// pageSize is the value for PRAGMA page_size, 0 keeps the sqlite
+	// default.
+	pageSize int
+
+	// mmapSize is the value for PRAGMA mmap_size, 0 keeps the sqlite
+	// default.
+	mmapSize int64
+
+	// tempStore is the value for PRAGMA temp_store, empty keeps the
+	// sqlite default.
+	tempStore string
+
+	// autoVacuum is the value for PRAGMA auto_vacuum, empty keeps the
+	// sqlite default.
+	autoVacuum string
+
+	// cacheSize is the value for PRAGMA cache_size, in pages if positive
+	// or in KiB if negative. 0 keeps the sqlite default.
+	cacheSize int
+
+	// walAutocheckpoint is the value for PRAGMA wal_autocheckpoint, nil
+	// keeps the sqlite default.
+	walAutocheckpoint *int
+
+	// journalSizeLimit is the value for PRAGMA journal_size_limit, in
+	// bytes, nil keeps the sqlite default of no limit.
+	journalSizeLimit *int64
+
+	// blobDir is the directory the data of the logs over blobThreshold
+	// bytes is written to, empty keeps every log inline.
+	blobDir       string
+	blobThreshold int
+
+	// dedupPayloads shares the storage of identical log payloads.
+	dedupPayloads bool
+
+	// archive is the database file attached to hold the archived logs,
+	// empty disables archiving.
+	archive string
+
+	// logCacheSize is the number of decoded logs kept in memory, 0
+	// disables the cache.
+	logCacheSize int
+
+	// indexCache keeps the first and last log indexes in memory.
+	indexCache bool
+
+	// maxValueSize is the maximum size in bytes of an encoded log or k/v
+	// value, 0 disables the limit.
+	maxValueSize int
+
+	// secureDelete zeroes deleted content instead of leaving it in the
+	// free pages.
+	secureDelete bool
+
+	// foreignKeys enforces the foreign key constraints on every
+	// connection.
+	foreignKeys bool
+
+	// checksums enables storing and verifying a CRC32C of every log.
+	checksums bool
+
+	// readOnly opens the database in read-only mode.
+	readOnly bool
+
+	// ttlSweepInterval is how often the expired keys are deleted, 0
+	// disables the sweeper.
+	ttlSweepInterval time.Duration
+
+	// clock returns the current time.
+	clock Clock
+
+	// strictMonotonic rejects appends that don't follow the last index.
+	strictMonotonic bool
+
+	// upsertLogs replaces existing logs instead of failing on them.
+	upsertLogs bool
+
+	// checkpointOnClose truncates the WAL when the store is closed.
+	checkpointOnClose bool
+
+	// autoCheckpointInterval is how often the WAL is checkpointed in
+	// autoCheckpointMode, 0 disables it.
+	autoCheckpointInterval time.Duration
+	autoCheckpointMode     string
+
+	// integrityCheck is the check run when opening the store, one of
+	// off, quick or full.
+	integrityCheck string
+
+	// dirPerm is the permission of the parent directories created for
+	// the database file.
+	dirPerm os.FileMode
+
+	// fileMode is the permission of the database files created by the
+	// store.
+	fileMode os.FileMode
+
+	// autoReconnect reopens the database once it can no longer be used.
+	autoReconnect bool
+
+	// groupCommitBatch is the maximum number of StoreLogs calls committed
+	// in a single transaction, waiting at most groupCommitDelay for them
+	// to come in. 0 disables group commit.
+	groupCommitBatch int
+	groupCommitDelay time.Duration
+
+	// readPoolSize is the number of read-only connections the reads go
+	// through under WAL, 0 sends them through the write connection.
+	readPoolSize int
+}
+
+// defaultOptions returns the settings used by NewStore.
+func defaultOptions() options {
+	return options{
+		// Synchronous=full is the default, but normal when paired with
+		// WAL mode guarantees complete database integrity. Normal also
+		// issues less fsyncs.
+		synchronous: "normal",
+		journalMode: "wal",
+		busyTimeout: 5 * time.Second,
+		maxRetries:  3,
+		observer:    noopObserver{},
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		logsTable:   "logs",
+		kvTable:     "kv",
+		encoding:    NewMsgpackEncoding(),
+
+		// sqlite serializes writers anyway, a single connection avoids
+		// spurious SQLITE_BUSY errors between connections of the pool.
+		maxOpenConns: 1,
+		maxIdleConns: 1,
+
+		integrityCheck:    "off",
+		readPoolSize:      defaultReadPoolSize,
+		dirPerm:           0o700,
+		fileMode:          0o600,
+		checksums:         true,
+		checkpointOnClose: true,
+		clock:             realClock{},
+	}
+}
+
+// validate checks that the configured values are safe to be used in
+// the store queries.
+func (o *options) validate() error {
+	switch o.synchronous {
+	case "off", "normal", "full", "extra":
+	default:
+		return fmt.Errorf("invalid synchronous mode %q", o.synchronous)
+	}
+
+	switch o.journalMode {
+	case "delete", "truncate", "persist", "memory", "wal", "off":
+	default:
+		return fmt.Errorf("invalid journal mode %q", o.journalMode)
+	}
+
+	if o.busyTimeout < 0 {
+		return fmt.Errorf("invalid busy timeout %s", o.busyTimeout)
+	}
+
+	if o.maxRetries < 0 {
+		return fmt.Errorf("invalid max retries %d", o.maxRetries)
+	}
+
+	if o.maxOpenConns < 0 {
+		return fmt.Errorf("invalid max open connections %d", o.maxOpenConns)
+	}
+
+	if o.connMaxLifetime < 0 {
+		return fmt.Errorf("invalid connection max lifetime %s", o.connMaxLifetime)
+	}
+
+	if o.ttlSweepInterval < 0 {
+		return fmt.Errorf("invalid ttl sweeper interval %s", o.ttlSweepInterval)
+	}
+
+	switch o.integrityCheck {
+	case "off", "quick", "full":
+	default:
+		return fmt.Errorf("invalid integrity check %q", o.integrityCheck)
+	}
+
+	if o.autoCheckpointInterval < 0 {
+		return fmt.Errorf("invalid auto checkpoint interval %s", o.autoCheckpointInterval)
+	}
+	if o.autoCheckpointInterval > 0 && !validCheckpointMode(o.autoCheckpointMode) {
+		return fmt.Errorf("invalid checkpoint mode %q", o.autoCheckpointMode)
+	}
+
+	if o.pageSize != 0 && (o.pageSize < 512 || o.pageSize > 65536 || o.pageSize&(o.pageSize-1) != 0) {
+		return fmt.Errorf("invalid page size %d, must be a power of two between 512 and 65536", o.pageSize)
+	}
+
+	if o.mmapSize < 0 {
+		return fmt.Errorf("invalid mmap size %d", o.mmapSize)
+	}
+
+	switch o.tempStore {
+	case "", "default", "file", "memory":
+	default:
+		return fmt.Errorf("invalid temp store %q", o.tempStore)
+	}
+
+	switch o.autoVacuum {
+	case "", "none", "full", "incremental":
+	default:
+		return fmt.Errorf("invalid auto vacuum mode %q", o.autoVacuum)
+	}
+
+	if o.walAutocheckpoint != nil && (*o.walAutocheckpoint < 0 || *o.walAutocheckpoint > math.MaxInt32) {
+		return fmt.Errorf("invalid wal autocheckpoint %d", *o.walAutocheckpoint)
+	}
+	if o.journalSizeLimit != nil && *o.journalSizeLimit < 0 {
+		return fmt.Errorf("invalid journal size limit %d", *o.journalSizeLimit)
+	}
+
+	if o.blobDir != "" && o.blobThreshold < 0 {
+		return fmt.Errorf("invalid external blob threshold %d", o.blobThreshold)
+	}
+
+	if o.maxValueSize < 0 {
+		return fmt.Errorf("invalid max value size %d", o.maxValueSize)
+	}
+
+	// the payloads are keyed by the plain hash of their data, which would
+	// reveal the equal and the guessed ones of an encrypted store
+	if o.dedupPayloads && o.encryptor != nil {
+		return errors.New("payload dedup can't be combined with an encryptor")
+	}
+
+	if o.logCacheSize < 0 {
+		return fmt.Errorf("invalid log cache size %d", o.logCacheSize)
+	}
+
+	if o.archive != "" && isInMemoryDSN(o.archive) {
+		return fmt.Errorf("archive must be a database file, got %q", o.archive)
+	}
+
+	// sqlite keeps the cache size in a 32-bit integer
+	if o.cacheSize < math.MinInt32 || o.cacheSize > math.MaxInt32 {
+		return fmt.Errorf("invalid cache size %d", o.cacheSize)
+	}
+
+	if o.groupCommitBatch < 0 {
+		return fmt.Errorf("invalid group commit batch size %d", o.groupCommitBatch)
+	}
+	if o.groupCommitDelay < 0 {
+		return fmt.Errorf("invalid group commit delay %s", o.groupCommitDelay)
+	}
+
+	if o.dirPerm&^os.ModePerm != 0 {
+		return fmt.Errorf("invalid directory permission %s", o.dirPerm)
+	}
+
+	if o.fileMode&^os.ModePerm != 0 {
+		return fmt.Errorf("invalid file mode %s", o.fileMode)
+	}
+
+	if o.observer == nil {
+		return fmt.Errorf("observer must not be nil")
+	}
+
+	if o.logger == nil {
+		return fmt.Errorf("logger must not be nil")
+	}
+
+	if !identifierRe.MatchString(o.logsTable) {
+		return fmt.Errorf("invalid logs table name %q", o.logsTable)
+	}
+
+	if !identifierRe.MatchString(o.kvTable) {
+		return fmt.Errorf("invalid kv table name %q", o.kvTable)
+	}
+
+	if o.clock == nil {
+		return errors.New("clock must not be nil")
+	}
+
+	if o.encoding == nil {
+		return errors.New("encoding must not be nil")
+	}
+
+	if o.logsTable == o.kvTable {
+		return fmt.Errorf("logs and kv tables must have different names, got %q", o.logsTable)
+	}
+	return nil
+}
+
+// pragmas returns the pragma statements, without the PRAGMA keyword,
+// to apply to every connection of the store.
+func (o *options) pragmas() []string {
+	var pragmas []string
+	// Set first, so applying the others to a new connection waits for
+	// the connections holding a lock.
+	pragmas = append(pragmas, fmt.Sprintf("busy_timeout=%d", o.busyTimeout.Milliseconds()))
+	// The page size, auto vacuum and journal modes are persisted in the
+	// database file, so they can't be changed in read-only mode. The page
+	// size is fixed once the file is initialized, which switching to WAL
+	// does, so it must come first. The auto vacuum mode must be set
+	// before the tables are created.
+	if o.pageSize != 0 && !o.readOnly {
+		pragmas = append(pragmas, fmt.Sprintf("page_size=%d", o.pageSize))
+	}
+	if o.autoVacuum != "" && !o.readOnly {
+		pragmas = append(pragmas, "auto_vacuum="+o.autoVacuum)
+	}
+	pragmas = append(pragmas, "synchronous="+o.synchronous)
+	if !o.readOnly {
+		pragmas = append(pragmas, "journal_mode="+o.journalMode)
+	}
+	if o.mmapSize != 0 {
+		pragmas = append(pragmas, fmt.Sprintf("mmap_size=%d", o.mmapSize))
+	}
+	if o.tempStore != "" {
+		pragmas = append(pragmas, "temp_store="+o.tempStore)
+	}
+	if o.cacheSize != 0 {
+		pragmas = append(pragmas, fmt.Sprintf("cache_size=%d", o.cacheSize))
+	}
+	if o.walAutocheckpoint != nil {
+		pragmas = append(pragmas, fmt.Sprintf("wal_autocheckpoint=%d", *o.walAutocheckpoint))
+	}
+	if o.journalSizeLimit != nil {
+		pragmas = append(pragmas, fmt.Sprintf("journal_size_limit=%d", *o.journalSizeLimit))
+	}
+	if o.secureDelete {
+		pragmas = append(pragmas, "secure_delete=on")
+	}
+	if o.foreignKeys {
+		pragmas = append(pragmas, "foreign_keys=on")
+	}
+	return pragmas
+}
+
+// WithSynchronous sets the sqlite synchronous mode, one of "off",
+// "normal", "full" or "extra". Defaults to "normal".
+func WithSynchronous(mode string) Option {
+	return func(o *options) {
+		o.synchronous = strings.ToLower(mode)
+	}
+}
+
+// WithJournalMode sets the sqlite journal mode, one of "delete",
+// "truncate", "persist", "memory", "wal" or "off". Defaults to "wal".
+func WithJournalMode(mode string) Option {
+	return func(o *options) {
+		o.journalMode = strings.ToLower(mode)
+	}
+}
+
+// WithBusyTimeout sets how long sqlite waits for a lock to be released
+// before failing with SQLITE_BUSY. Defaults to 5 seconds.
+func WithBusyTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.busyTimeout = d
+	}
+}
+
+// WithMaxRetries sets how many times a transaction is retried, with an
+// exponential backoff, when sqlite reports the database as busy or
+// locked. Zero disables retries. Defaults to 3.
+func WithMaxRetries(n int) Option {
+	return func(o *options) {
+		o.maxRetries = n
+	}
+}
+
+// WithObserver sets an Observer to be notified about the store
+// operations. Defaults to an observer that does nothing.
+func WithObserver(obs Observer) Option {
+	return func(o *options) {
+		o.observer = obs
+	}
+}
+
+// WithLogger sets the logger used to report what the store is doing.
+// Defaults to a logger that discards everything.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithLogsTable sets the name of the table holding the raft logs. The
+// name may only contain letters, digits and underscores and must not
+// start with a digit. Defaults to "logs".
+func WithLogsTable(name string) Option {
+	return func(o *options) {
+		o.logsTable = name
+	}
+}
+
+// WithKVTable sets the name of the table holding the stable store keys.
+// The name may only contain letters, digits and underscores and must not
+// start with a digit. Defaults to "kv".
+func WithKVTable(name string) Option {
+	return func(o *options) {
+		o.kvTable = name
+	}
+}
+
+// WithEncoding sets the Encoding used to serialize the logs. The encoding
+// is recorded when the database is created, opening it with a different
+// one fails with ErrEncodingMismatch. The logs encoded with an Encoding
+// other than the ones of this package are stored prefixed by a marker
+// byte, so their output may start with any byte. Defaults to msgpack.
+func WithEncoding(e Encoding) Option {
+	return func(o *options) {
+		o.encoding = e
+	}
+}
+
+// WithCompression sets a Codec used to compress the logs before storing
+// them. Logs stored without compression remain readable. Disabled by
+// default.
+func WithCompression(c Codec) Option {
+	return func(o *options) {
+		o.codec = c
+	}
+}
+
+// WithEncryptor sets an Encryptor used to encrypt the logs and the kv
+// values at rest. Keys are stored in plaintext. Encryption must be
+// enabled when the store is created, as existing plaintext rows are not
+// readable through an Encryptor. It can't be combined with
+// WithPayloadDedup. Disabled by default.
+func WithEncryptor(e Encryptor) Option {
+	return func(o *options) {
+		o.encryptor = e
+	}
+}
+
+// WithMaxOpenConns sets the maximum number of open connections to the
+// database, zero means unlimited. The pragmas set with the options are
+// applied to every pooled connection. Those changed at runtime with
+// SetPragma only apply to a single connection, and are lost once it is
+// recycled, such as with WithConnMaxLifetime. Defaults to 1.
+func WithMaxOpenConns(n int) Option {
+	return func(o *options) {
+		o.maxOpenConns = n
+	}
+}
+
+// WithMaxIdleConns sets the maximum number of idle connections kept in
+// the pool. In-memory stores always keep at least one, as the database
+// is dropped along with its last connection. Defaults to 1.
+func WithMaxIdleConns(n int) Option {
+	return func(o *options) {
+		o.maxIdleConns = n
+	}
+}
+
+// WithConnMaxLifetime sets the maximum amount of time a connection may
+// be reused, zero means forever. It is ignored for in-memory stores.
+// Defaults to 0.
+func WithConnMaxLifetime(d time.Duration) Option {
+	return func(o *options) {
+		o.connMaxLifetime = d
+	}
+}
+
+// WithPageSize sets the database page size in bytes, a power of two
+// between 512 and 65536. It only takes effect when the database is
+// created, or after a Vacuum if the journal mode is not WAL. Defaults to
+// the sqlite default.
+func WithPageSize(bytes int) Option {
+	return func(o *options) {
+		o.pageSize = bytes
+	}
+}
+
+// WithMmapSize sets the maximum number of bytes of the database file
+// accessed through memory-mapped I/O, which can speed up reads. Mapped
+// pages live in the OS page cache rather than in the sqlite cache, and
+// the setting only applies to the connection it was issued on. sqlite
+// caps it at a compile time maximum. Defaults to the sqlite default,
+// which disables memory mapping.
+func WithMmapSize(bytes int64) Option {
+	return func(o *options) {
+		o.mmapSize = bytes
+	}
+}
+
+// WithTempStore sets where sqlite keeps the temporary tables and indexes
+// built by some queries, one of "default", which follows the compile time
+// setting, "file" or "memory". Keeping them in memory is faster but
+// counts against the memory budget. Defaults to the sqlite default.
+func WithTempStore(mode string) Option {
+	return func(o *options) {
+		o.tempStore = strings.ToLower(mode)
+	}
+}
+
+// WithAutoVacuum sets the sqlite auto vacuum mode, one of "none", "full",
+// which shrinks the database file at every commit, or "incremental",
+// which only does when IncrementalVacuum is called. The mode is stored in
+// the database file and only applies to new databases, switching an
+// existing database from or to "none" takes effect after Vacuum.
+// Defaults to the sqlite default, "none".
+func WithAutoVacuum(mode string) Option {
+	return func(o *options) {
+		o.autoVacuum = strings.ToLower(mode)
+	}
+}
+
+// WithCacheSize sets the maximum size of the sqlite page cache of a
+// connection. A positive value is a number of pages, a negative one a
+// number of KiB, so -65536 is a 64MiB cache regardless of the page size.
+// Defaults to the sqlite default, which is 2MiB.
+func WithCacheSize(pages int) Option {
+	return func(o *options) {
+		o.cacheSize = pages
+	}
+}
+
+// WithWalAutocheckpoint sets the number of pages the WAL may grow to
+// before a commit checkpoints it, zero disabling the automatic
+// checkpoints. A lower threshold keeps the WAL and reads faster at the
+// cost of more frequent checkpoints on the write path. With automatic
+// checkpoints disabled the WAL grows unbounded unless checkpointed by
+// other means, such as WithAutoCheckpoint, which does so in the
+// background instead, Checkpoint or Sync. Defaults to the sqlite default
+// of 1000 pages.
+func WithWalAutocheckpoint(pages int) Option {
+	return func(o *options) {
+		o.walAutocheckpoint = &pages
+	}
+}
+
+// WithJournalSizeLimit sets the size in bytes the WAL is truncated back
+// to when it is reset after a checkpoint. Without a limit the WAL keeps
+// the size of its largest burst of writes, which is reused rather than
+// given back to the file system. Defaults to no limit.
+func WithJournalSizeLimit(bytes int64) Option {
+	return func(o *options) {
+		o.journalSizeLimit = &bytes
+	}
+}
+
+// WithSecureDelete overwrites deleted logs and values with zeros, so
+// their content can't be recovered from the database file. It costs
+// extra writes, as every deletion rewrites the pages it frees, and
+// truncating the log is no longer a cheap operation. Old copies may still
+// be found in the WAL until it is checkpointed. Defaults to false.
+func WithSecureDelete(enabled bool) Option {
+	return func(o *options) {
+		o.secureDelete = enabled
+	}
+}
+
+// WithForeignKeys enforces the foreign key constraints, which sqlite
+// leaves off. The setting is per connection, so it is applied to every
+// connection the store opens, for the tables of applications sharing the
+// database through RunInTransaction. Stores created with NewStoreFromDB
+// use the connections of the caller, which must enable it themselves,
+// such as with the _foreign_keys=1 DSN parameter. Defaults to false.
+func WithForeignKeys(enabled bool) Option {
+	return func(o *options) {
+		o.foreignKeys = enabled
+	}
+}
+
+// WithExternalBlobDir stores the data of the logs larger than threshold
+// bytes in files of dir, one per log, instead of inline in the database,
+// keeping the database small and quick to vacuum. The files are read back
+// and removed along with their logs transparently, and are encrypted and
+// checksummed like the logs themselves. A write that fails, or whose
+// transaction is rolled back by the caller of StoreLogsTx, may leave its
+// files behind, as does a log replaced with WithUpsertLogs through
+// StoreLogsTx. The directory must be kept along with the database, logs
+// stored externally can't be read without it, so Backup and VacuumInto
+// refuse to copy the database alone. Disabled by default.
+func WithExternalBlobDir(dir string, threshold int) Option {
+	return func(o *options) {
+		o.blobDir = dir
+		o.blobThreshold = threshold
+	}
+}
+
+// WithPayloadDedup stores each distinct log payload once, in a table
+// keyed by its SHA-256 and shared by every log carrying it, such as
+// repeated heartbeats or no-op commands. It trades hashing every payload
+// and an extra write per log for less disk usage when payloads repeat.
+// The payloads stored externally with WithExternalBlobDir are not
+// deduplicated. The hashes are stored in plaintext, so it can't be
+// combined with WithEncryptor. Disabled by default.
+func WithPayloadDedup(enabled bool) Option {
+	return func(o *options) {
+		o.dedupPayloads = enabled
+	}
+}
+
+// WithArchive attaches the database file at path, created if missing, to
+// hold the logs moved out of the store with ArchiveLogsBefore. GetLog
+// reads a log from the archive when it is missing from the store, the
+// other reads only see the logs still in the store. The archive is only
+// supported by the stores opening their own database. Disabled by
+// default.
+func WithArchive(path string) Option {
+	return func(o *options) {
+		o.archive = path
+	}
+}
+
+// WithLogCache keeps up to size decoded logs in memory, the most recently
+// used ones, so GetLog doesn't query and decode the hot logs again, such
+// as the ones replicated to several followers. GetLog and GetLogs fill
+// the cache, and the logs are invalidated once they are deleted or
+// replaced. Logs replaced through StoreLogsTx are invalidated by
+// EndStoreLogsTx, once the caller commits. The cached logs are shared
+// with the callers, which must not modify them. Disabled by default.
+func WithLogCache(size int) Option {
+	return func(o *options) {
+		o.logCacheSize = size
+	}
+}
+
+// WithIndexCache keeps the first and last log indexes in memory, so
+// FirstIndex and LastIndex don't query the database while no write
+// happens in between. Every write transaction invalidates them, even the
+// ones not touching the logs. Logs stored through StoreLogsTx keep them
+// from being cached until EndStoreLogsTx. Disabled by default.
+func WithIndexCache(enabled bool) Option {
+	return func(o *options) {
+		o.indexCache = enabled
+	}
+}
+
+// WithMaxValueSize limits the size in bytes of the logs, once encoded,
+// and of the k/v values. Writing a larger one fails with
+// ErrValueTooLarge before anything is written. The limit applies before
+// compression and encryption. Defaults to 0, no limit.
+func WithMaxValueSize(bytes int) Option {
+	return func(o *options) {
+		o.maxValueSize = bytes
+	}
+}
+
+// WithChecksums enables storing a CRC32C checksum of every log and
+// verifying it when the log is read, returning ErrLogCorrupted on a
+// mismatch. Logs stored without a checksum are never verified. Enabled
+// by default.
+func WithChecksums(enabled bool) Option {
+	return func(o *options) {
+		o.checksums = enabled
+	}
+}
+
+// WithReadOnly opens the database in read-only mode. Every method that
+// writes to the store returns ErrReadOnly, and the schema is expected to
+// be up to date as it can't be migrated. This is useful for tooling
+// inspecting the database of a live node. Disabled by default.
+func WithReadOnly(readOnly bool) Option {
+	return func(o *options) {
+		o.readOnly = readOnly
+	}
+}
+
+// WithTTLSweeper starts a background goroutine deleting the expired keys
+// every interval. Expired keys are never returned, the sweeper only
+// reclaims their space. Disabled by default.
+func WithTTLSweeper(interval time.Duration) Option {
+	return func(o *options) {
+		o.ttlSweepInterval = interval
+	}
+}
+
+// WithStrictMonotonic makes StoreLogs reject, with ErrNonMonotonic, any
+// batch whose indexes are not strictly increasing past the current last
+// index. Gaps are allowed, and the first append to an empty log may
+// start at any index. This catches accidental overwrites and out of
+// order batches. Disabled by default.
+func WithStrictMonotonic(enabled bool) Option {
+	return func(o *options) {
+		o.strictMonotonic = enabled
+	}
+}
+
+// WithUpsertLogs makes StoreLogs overwrite logs already stored at the
+// same index instead of failing with a constraint error, so overlapping
+// batches, such as the ones a follower may receive while recovering, can
+// be stored again. Disabled by default.
+func WithUpsertLogs(enabled bool) Option {
+	return func(o *options) {
+		o.upsertLogs = enabled
+	}
+}
+
+// WithCheckpointOnClose makes Close checkpoint and truncate the WAL
+// before closing the database, leaving a single self-contained file
+// behind. It has no effect on in-memory and read-only stores, nor on
+// stores created from an existing *sql.DB. Enabled by default.
+func WithCheckpointOnClose(enabled bool) Option {
+	return func(o *options) {
+		o.checkpointOnClose = enabled
+	}
+}
+
+// WithAutoCheckpoint starts a background goroutine checkpointing the WAL
+// in the given mode every interval, see Checkpoint, keeping it from
+// growing unbounded between the sqlite automatic checkpoints on write
+// heavy nodes. Disabled by default.
+func WithAutoCheckpoint(interval time.Duration, mode string) Option {
+	return func(o *options) {
+		o.autoCheckpointInterval = interval
+		o.autoCheckpointMode = mode
+	}
+}
+
+// WithIntegrityCheck verifies the database when the store is opened,
+// failing with ErrCorrupt and the reported problems if it is damaged, so
+// a node refuses to start rather than serve bad data. The mode is one of
+// "off", "quick" for PRAGMA quick_check, or "full" for PRAGMA
+// integrity_check, which also verifies the indexes against the tables but
+// reads the whole database. Defaults to "off".
+func WithIntegrityCheck(mode string) Option {
+	return func(o *options) {
+		o.integrityCheck = mode
+	}
+}
+
+// WithClock sets the Clock the store gets the current time from, which
+// decides when keys expire and the time logs are stored at. It is mainly
+// useful to control time in tests. Defaults to the system clock.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithDirPerm sets the permission of the missing parent directories of
+// the database file, which are created when the store is opened. Only
+// the permission bits are allowed, and the process umask still applies.
+// Defaults to 0700.
+func WithDirPerm(perm os.FileMode) Option {
+	return func(o *options) {
+		o.dirPerm = perm
+	}
+}
+
+// WithFileMode sets the permission of the database file, along with its
+// -wal and -shm files, when the store creates it. Existing databases keep
+// their permission. It has no effect on in-memory stores. Only the
+// permission bits are allowed. Defaults to 0600.
+func WithFileMode(mode os.FileMode) Option {
+	return func(o *options) {
+		o.fileMode = mode
+	}
+}
+
+// WithAutoReconnect makes the store reopen the database when an operation
+// fails because the database handle was closed or its connection lost,
+// such as after the file was replaced by a restore, and retry the
+// operation once. Any other error is returned as is. It covers the
+// raft.LogStore and raft.StableStore methods and every write, and has no
+// effect on in-memory stores, whose data would be lost, nor on stores
+// created from an existing *sql.DB. Disabled by default.
+func WithAutoReconnect(enabled bool) Option {
+	return func(o *options) {
+		o.autoReconnect = enabled
+	}
+}
+
+// WithGroupCommit makes StoreLogs hand the logs over to a single writer
+// goroutine, which commits the calls made concurrently within a single
+// transaction, amortizing the cost of syncing to disk across them. Once
+// a call comes in, the writer waits up to maxDelay for more, committing
+// at most maxBatch calls at once. Each call still blocks until its logs
+// are committed and fails on its own, the other calls of the transaction
+// are not affected. A call's context is only checked until its logs join
+// a transaction. Zero maxBatch disables group commit, which is the
+// default.
+func WithGroupCommit(maxBatch int, maxDelay time.Duration) Option {
+	return func(o *options) {
+		o.groupCommitBatch = maxBatch
+		o.groupCommitDelay = maxDelay
+	}
+}
@@ -0,0 +1,1021 @@
+package raftsqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestWithSynchronous(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithSynchronous("full"))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	var synchronous string
+	err = store.db.QueryRow("PRAGMA synchronous").Scan(&synchronous)
+	assertNoError(t, err)
+	// 2 == FULL
+	assert(t, synchronous == "2", fmt.Sprintf("want synchronous 2, got: %s", synchronous))
+}
+
+func TestWithJournalMode(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithJournalMode("TRUNCATE"))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	var journalMode string
+	err = store.db.QueryRow("PRAGMA journal_mode").Scan(&journalMode)
+	assertNoError(t, err)
+	assert(t, journalMode == "truncate", fmt.Sprintf("want journal_mode truncate, got: %s", journalMode))
+}
+
+func TestWithBusyTimeout(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithBusyTimeout(1500*time.Millisecond))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	var timeout int
+	err = store.db.QueryRow("PRAGMA busy_timeout").Scan(&timeout)
+	assertNoError(t, err)
+	assert(t, timeout == 1500, fmt.Sprintf("want busy_timeout 1500, got: %d", timeout))
+}
+
+// lockDB opens a separate connection to the database at path and holds
+// its write lock until the returned function is called.
+func lockDB(t testing.TB, path string) func() {
+	t.Helper()
+
+	db, err := sql.Open(driverName, path)
+	assertNoError(t, err)
+
+	conn, err := db.Conn(context.Background())
+	assertNoError(t, err)
+
+	_, err = conn.ExecContext(context.Background(), "BEGIN IMMEDIATE")
+	assertNoError(t, err)
+
+	return func() {
+		conn.ExecContext(context.Background(), "COMMIT")
+		conn.Close()
+		db.Close()
+	}
+}
+
+func TestWithMaxRetries(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStoreWithOptions(path, WithBusyTimeout(0), WithMaxRetries(10))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	unlock := lockDB(t, path)
+	time.AfterFunc(50*time.Millisecond, unlock)
+
+	err = store.StoreLog(createRaftLog(1, "log1"))
+	assertNoError(t, err)
+
+	idx, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, idx == 1, fmt.Sprintf("want last index 1, got: %d", idx))
+}
+
+func TestWithMaxRetriesDisabled(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStoreWithOptions(path, WithBusyTimeout(0), WithMaxRetries(0))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	unlock := lockDB(t, path)
+	defer unlock()
+
+	err = store.StoreLog(createRaftLog(1, "log1"))
+	assert(t, isBusyError(err), fmt.Sprintf("want busy error, got: %v", err))
+}
+
+type capturingHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *capturingHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *capturingHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *capturingHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *capturingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *capturingHandler) has(level slog.Level, msg string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range h.records {
+		if r.Level == level && r.Message == msg {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWithLogger(t *testing.T) {
+	h := &capturingHandler{}
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithLogger(slog.New(h)))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	assert(t, h.has(slog.LevelDebug, "opened store"), "want store open to be logged")
+
+	err = store.StoreLog(createRaftLog(1, "log1"))
+	assertNoError(t, err)
+	err = store.StoreLog(createRaftLog(1, "log1"))
+	assert(t, err != nil, "want error storing a duplicate index, got nil")
+	assert(t, h.has(slog.LevelError, "transaction rolled back"), "want rollback to be logged")
+}
+
+func TestWithTableNames(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithLogsTable("raft_logs"), WithKVTable("raft_kv"))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	tables := map[string]int{"raft_logs": 1, "raft_kv": 1, "logs": 0, "kv": 0}
+	for name, want := range tables {
+		var count int
+		err := store.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?", name).Scan(&count)
+		assertNoError(t, err)
+		assert(t, count == want, fmt.Sprintf("want %d tables named %s, got: %d", want, name, count))
+	}
+
+	err = store.StoreLog(createRaftLog(1, "log1"))
+	assertNoError(t, err)
+	idx, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, idx == 1, fmt.Sprintf("want last index 1, got: %d", idx))
+
+	err = store.Set([]byte("key1"), []byte("val1"))
+	assertNoError(t, err)
+	val, err := store.Get([]byte("key1"))
+	assertNoError(t, err)
+	assert(t, string(val) == "val1", fmt.Sprintf("want val1, got: %s", val))
+}
+
+func TestWithMaxOpenConns(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithMaxOpenConns(4), WithConnMaxLifetime(time.Minute))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	stats := store.db.Stats()
+	assert(t, stats.MaxOpenConnections == 4, fmt.Sprintf("want 4 max open connections, got: %d", stats.MaxOpenConnections))
+}
+
+func TestPragmasAppliedToNewConnections(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithSecureDelete(true), WithBusyTimeout(7*time.Second),
+		WithCacheSize(-4096), WithMaxOpenConns(2), WithConnMaxLifetime(50*time.Millisecond))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	check := func(conn *sql.Conn) {
+		t.Helper()
+		for pragma, want := range map[string]int{"secure_delete": 1, "busy_timeout": 7000, "cache_size": -4096} {
+			var got int
+			err := conn.QueryRowContext(context.Background(), "PRAGMA "+pragma).Scan(&got)
+			assertNoError(t, err)
+			assert(t, got == want, fmt.Sprintf("want %s %d, got: %d", pragma, want, got))
+		}
+	}
+
+	// a second connection, opened while the first one is in use
+	conn1, err := store.db.Conn(context.Background())
+	assertNoError(t, err)
+	defer conn1.Close()
+	conn2, err := store.db.Conn(context.Background())
+	assertNoError(t, err)
+	defer conn2.Close()
+	check(conn1)
+	check(conn2)
+	conn1.Close()
+	conn2.Close()
+
+	// a connection replaced once its lifetime is over
+	time.Sleep(100 * time.Millisecond)
+	conn, err := store.db.Conn(context.Background())
+	assertNoError(t, err)
+	defer conn.Close()
+	check(conn)
+	assert(t, store.db.Stats().MaxLifetimeClosed > 0, "want the connections to be recycled")
+}
+
+func TestInMemoryKeepsConnection(t *testing.T) {
+	store, err := NewStoreWithOptions("file:keepalive?mode=memory&cache=shared", WithMaxIdleConns(0))
+	assertNoError(t, err)
+	defer store.Close()
+
+	// without an idle connection the database would be dropped between
+	// the operations
+	err = store.StoreLog(createRaftLog(1, "log1"))
+	assertNoError(t, err)
+
+	idx, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, idx == 1, fmt.Sprintf("want last index 1, got: %d", idx))
+}
+
+func TestInMemoryConcurrency(t *testing.T) {
+	store, err := NewStoreWithOptions("file:concurrency?mode=memory&cache=shared", WithMaxOpenConns(8), WithConnMaxLifetime(time.Millisecond))
+	assertNoError(t, err)
+	defer store.Close()
+
+	const workers, perWorker = 8, 50
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				idx := uint64(w*perWorker + i + 1)
+				key := []byte(fmt.Sprint(idx))
+				if err := store.StoreLog(createRaftLog(idx, "log")); err != nil {
+					errs <- err
+					return
+				}
+				if err := store.Set(key, key); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := store.Get(key); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assertNoError(t, err)
+	}
+
+	count, err := store.CountLogs()
+	assertNoError(t, err)
+	assert(t, count == workers*perWorker, fmt.Sprintf("want %d logs, got: %d", workers*perWorker, count))
+
+	keys, err := store.Keys()
+	assertNoError(t, err)
+	assert(t, len(keys) == workers*perWorker, fmt.Sprintf("want %d keys, got: %d", workers*perWorker, len(keys)))
+}
+
+func TestWithPageSize(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithPageSize(16384))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	var pageSize int
+	err = store.db.QueryRow("PRAGMA page_size").Scan(&pageSize)
+	assertNoError(t, err)
+	assert(t, pageSize == 16384, fmt.Sprintf("want page_size 16384, got: %d", pageSize))
+}
+
+func TestWithMmapSize(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithMmapSize(64<<20))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	var mmapSize int64
+	err = store.db.QueryRow("PRAGMA mmap_size").Scan(&mmapSize)
+	assertNoError(t, err)
+	assert(t, mmapSize == 64<<20, fmt.Sprintf("want mmap_size %d, got: %d", 64<<20, mmapSize))
+}
+
+func TestWithTempStore(t *testing.T) {
+	// PRAGMA temp_store reports the mode as a number
+	for mode, want := range map[string]int{"default": 0, "file": 1, "memory": 2} {
+		store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithTempStore(mode))
+		assertNoError(t, err)
+
+		var tempStore int
+		err = store.db.QueryRow("PRAGMA temp_store").Scan(&tempStore)
+		assertNoError(t, err)
+		assert(t, tempStore == want, fmt.Sprintf("want temp_store %d for %s, got: %d", want, mode, tempStore))
+
+		store.Close()
+		store.deleteDB()
+	}
+}
+
+func TestWithCacheSize(t *testing.T) {
+	for _, size := range []int{500, -8192} {
+		store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithCacheSize(size))
+		assertNoError(t, err)
+
+		var cacheSize int
+		err = store.db.QueryRow("PRAGMA cache_size").Scan(&cacheSize)
+		assertNoError(t, err)
+		assert(t, cacheSize == size, fmt.Sprintf("want cache_size %d, got: %d", size, cacheSize))
+
+		store.Close()
+		store.deleteDB()
+	}
+}
+
+func TestWithDirPerm(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStoreWithOptions(dir+"/a/b/raft.db", WithDirPerm(0o750))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	for _, d := range []string{dir + "/a", dir + "/a/b"} {
+		info, err := os.Stat(d)
+		assertNoError(t, err)
+		// the umask may only clear bits
+		assert(t, info.IsDir() && info.Mode().Perm()&^0o750 == 0, fmt.Sprintf("want %s created with at most 0750, got: %s", d, info.Mode()))
+	}
+}
+
+func TestWithFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on windows")
+	}
+
+	for _, tc := range []struct {
+		opts []Option
+		want os.FileMode
+	}{
+		{nil, 0o600},
+		{[]Option{WithFileMode(0o640)}, 0o640},
+	} {
+		path := t.TempDir() + "/raft.db"
+		store, err := NewStoreWithOptions(path, tc.opts...)
+		assertNoError(t, err)
+		storeLogRange(t, store, 1, 3, "log")
+
+		for _, name := range []string{path, path + "-wal", path + "-shm"} {
+			info, err := os.Stat(name)
+			assertNoError(t, err)
+			assert(t, info.Mode().Perm() == tc.want, fmt.Sprintf("want %s mode %s, got: %s", name, tc.want, info.Mode().Perm()))
+		}
+
+		store.Close()
+		store.deleteDB()
+	}
+}
+
+func TestWithAutoReconnect(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStoreWithOptions(path, WithAutoReconnect(true))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 3, "log")
+	err = store.Set([]byte("key1"), []byte("val1"))
+	assertNoError(t, err)
+
+	// close the database out from under the store
+	err = store.closeDB()
+	assertNoError(t, err)
+
+	log := new(raft.Log)
+	err = store.GetLog(2, log)
+	assertNoError(t, err)
+	assert(t, log.Index == 2 && string(log.Data) == "log", fmt.Sprintf("want log 2, got: %+v", log))
+
+	store.closeDB()
+	val, err := store.Get([]byte("key1"))
+	assertNoError(t, err)
+	assert(t, string(val) == "val1", fmt.Sprintf("want val1, got: %s", val))
+
+	store.closeDB()
+	storeLogRange(t, store, 4, 5, "log")
+	assertBounds(t, store, 1, 5)
+
+	// other errors are returned as is
+	err = store.GetLog(10, log)
+	assert(t, err == raft.ErrLogNotFound, fmt.Sprintf("want log not found err, got: %v", err))
+
+	// a closed store is not reopened
+	store.Close()
+	_, err = store.LastIndex()
+	assert(t, err != nil, "want error on a closed store")
+
+	// disabled by default
+	store2, err := NewStore(path)
+	assertNoError(t, err)
+	defer store2.Close()
+	store2.closeDB()
+	_, err = store2.LastIndex()
+	assert(t, err != nil, "want error without auto reconnect")
+}
+
+func TestWithAutoReconnectReads(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithAutoReconnect(true))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 3, "log")
+	err = store.Set([]byte("key1"), []byte("val1"))
+	assertNoError(t, err)
+
+	reads := map[string]func() error{
+		"CountLogs": func() error {
+			count, err := store.CountLogs()
+			if err == nil && count != 3 {
+				err = fmt.Errorf("want 3 logs, got %d", count)
+			}
+			return err
+		},
+		"GetLogRange": func() error {
+			logs, err := store.GetLogRange(1, 10)
+			if err == nil && len(logs) != 3 {
+				err = fmt.Errorf("want 3 logs, got %d", len(logs))
+			}
+			return err
+		},
+		"IterateLogs": func() error {
+			return store.IterateLogs(context.Background(), func(*raft.Log) error { return nil })
+		},
+		"ExistsLog": func() error {
+			_, err := store.ExistsLog(2)
+			return err
+		},
+		"GetLogTerm": func() error {
+			_, err := store.GetLogTerm(2)
+			return err
+		},
+		"VerifyContiguous": func() error {
+			_, err := store.VerifyContiguous()
+			return err
+		},
+		"Keys": func() error {
+			_, err := store.Keys()
+			return err
+		},
+		"GetMany": func() error {
+			_, err := store.GetMany([][]byte{[]byte("key1")})
+			return err
+		},
+		"ReadSnapshot": func() error {
+			return store.ReadSnapshot(func(r Reader) error {
+				return r.GetLog(2, new(raft.Log))
+			})
+		},
+		"Ping": func() error {
+			return store.Ping(context.Background())
+		},
+	}
+	for name, read := range reads {
+		// close the read pool only, the write connection stays usable
+		err := store.readDB.Close()
+		assertNoError(t, err)
+		if err := read(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestWithGroupCommit(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithGroupCommit(8, time.Millisecond))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	const writers, perWriter = 10, 20
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				idx := uint64(w*perWriter + i + 1)
+				errs <- store.StoreLogs([]*raft.Log{createRaftLog(idx, "log")})
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assertNoError(t, err)
+	}
+
+	assertBounds(t, store, 1, writers*perWriter)
+	count, err := store.CountLogs()
+	assertNoError(t, err)
+	assert(t, count == writers*perWriter, fmt.Sprintf("want %d logs, got: %d", writers*perWriter, count))
+}
+
+func TestWithGroupCommitErrors(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStore(path)
+	assertNoError(t, err)
+	storeLogRange(t, store, 1, 3, "log")
+	store.Close()
+
+	// a long delay so the calls below end up in the same transaction
+	store, err = NewStoreWithOptions(path, WithGroupCommit(3, time.Minute))
+	assertNoError(t, err)
+	defer store.deleteDB()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i, idx := range []uint64{10, 2, 11} {
+		wg.Add(1)
+		go func(i int, idx uint64) {
+			defer wg.Done()
+			errs[i] = store.StoreLog(createRaftLog(idx, "log"))
+		}(i, idx)
+	}
+	wg.Wait()
+
+	// only the duplicate index fails
+	assertNoError(t, errs[0])
+	assert(t, errs[1] != nil, "want error for the duplicate index")
+	assertNoError(t, errs[2])
+	assertBounds(t, store, 1, 11)
+
+	// canceled calls are not queued
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = store.StoreLogsCtx(ctx, []*raft.Log{createRaftLog(20, "log")})
+	assert(t, errors.Is(err, context.Canceled), fmt.Sprintf("want context canceled err, got: %v", err))
+
+	// closing commits the queued calls without waiting for the delay
+	done := make(chan error, 1)
+	go func() {
+		done <- store.StoreLog(createRaftLog(12, "log"))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	store.stopGroupCommit()
+	assertNoError(t, <-done)
+	assertBounds(t, store, 1, 12)
+
+	store.Close()
+	err = store.StoreLog(createRaftLog(13, "log"))
+	assert(t, err == ErrClosed, fmt.Sprintf("want closed err, got: %v", err))
+}
+
+func TestWithWalAutocheckpoint(t *testing.T) {
+	for _, pages := range []int{0, 100, 5000} {
+		store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithWalAutocheckpoint(pages))
+		assertNoError(t, err)
+
+		var got int
+		err = store.db.QueryRow("PRAGMA wal_autocheckpoint").Scan(&got)
+		assertNoError(t, err)
+		assert(t, got == pages, fmt.Sprintf("want wal_autocheckpoint %d, got: %d", pages, got))
+
+		store.Close()
+		store.deleteDB()
+	}
+}
+
+func TestWithJournalSizeLimit(t *testing.T) {
+	const limit = 64 << 10
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStoreWithOptions(path, WithJournalSizeLimit(limit), WithWalAutocheckpoint(0))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	var got int64
+	err = store.db.QueryRow("PRAGMA journal_size_limit").Scan(&got)
+	assertNoError(t, err)
+	assert(t, got == limit, fmt.Sprintf("want journal_size_limit %d, got: %d", limit, got))
+
+	// a burst well over the limit
+	logs := make([]*raft.Log, 0, 256)
+	for i := uint64(1); i <= 256; i++ {
+		logs = append(logs, &raft.Log{Index: i, Term: 1, Data: make([]byte, 4096)})
+	}
+	err = store.StoreLogs(logs)
+	assertNoError(t, err)
+	peak := fileSize(t, path+"-wal")
+	assert(t, peak > limit, fmt.Sprintf("want wal over %d bytes after the burst, got: %d", limit, peak))
+
+	// the WAL is truncated to the limit when it is reset after the
+	// checkpoint
+	err = store.Checkpoint("restart")
+	assertNoError(t, err)
+	err = store.StoreLog(&raft.Log{Index: 257, Term: 1})
+	assertNoError(t, err)
+
+	size := fileSize(t, path+"-wal")
+	assert(t, size <= limit, fmt.Sprintf("want wal under %d bytes, got: %d", limit, size))
+}
+
+func TestWithMaxValueSize(t *testing.T) {
+	// the limit applies to the encoded log, so use the size of a log
+	// right at it
+	borderline := &raft.Log{Index: 1, Term: 1, Data: make([]byte, 900)}
+	encoded, err := NewMsgpackEncoding().Encode(borderline)
+	assertNoError(t, err)
+	limit := len(encoded)
+
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithMaxValueSize(limit))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err = store.StoreLog(borderline)
+	assertNoError(t, err)
+
+	// a single oversized log fails the whole batch
+	err = store.StoreLogs([]*raft.Log{
+		{Index: 2, Term: 1, Data: make([]byte, 10)},
+		{Index: 3, Term: 1, Data: make([]byte, 901)},
+	})
+	assert(t, errors.Is(err, ErrValueTooLarge), fmt.Sprintf("want value too large err, got: %v", err))
+	last, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 1, fmt.Sprintf("want last index 1, got: %d", last))
+
+	err = store.Set([]byte("key"), make([]byte, limit))
+	assertNoError(t, err)
+	err = store.Set([]byte("key"), make([]byte, limit+1))
+	assert(t, errors.Is(err, ErrValueTooLarge), fmt.Sprintf("want value too large err, got: %v", err))
+	err = store.SetMany(map[string][]byte{"a": nil, "b": make([]byte, limit+1)})
+	assert(t, errors.Is(err, ErrValueTooLarge), fmt.Sprintf("want value too large err, got: %v", err))
+	err = store.SetWithTTL([]byte("key"), make([]byte, limit+1), time.Minute)
+	assert(t, errors.Is(err, ErrValueTooLarge), fmt.Sprintf("want value too large err, got: %v", err))
+
+	val, err := store.Get([]byte("key"))
+	assertNoError(t, err)
+	assert(t, len(val) == limit, fmt.Sprintf("want value of %d bytes, got: %d", limit, len(val)))
+	_, err = store.Get([]byte("a"))
+	assert(t, err == ErrKeyNotFound, fmt.Sprintf("want not found err, got: %v", err))
+}
+
+func TestWithForeignKeys(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithForeignKeys(enabled), WithMaxOpenConns(2))
+		assertNoError(t, err)
+
+		// cycle the pools, so the pragma is read from new connections
+		for _, db := range []*sql.DB{store.db, store.readDB} {
+			db.SetMaxIdleConns(0)
+			var got bool
+			err = db.QueryRow("PRAGMA foreign_keys").Scan(&got)
+			assertNoError(t, err)
+			assert(t, got == enabled, fmt.Sprintf("want foreign_keys %v, got: %v", enabled, got))
+		}
+
+		if enabled {
+			err = store.RunInTransaction(context.Background(), func(tx *sql.Tx) error {
+				_, err := tx.Exec("CREATE TABLE parent (id INTEGER PRIMARY KEY)")
+				if err == nil {
+					_, err = tx.Exec("CREATE TABLE child (parent_id INTEGER REFERENCES parent(id))")
+				}
+				return err
+			})
+			assertNoError(t, err)
+			err = store.RunInTransaction(context.Background(), func(tx *sql.Tx) error {
+				_, err := tx.Exec("INSERT INTO child (parent_id) VALUES (1)")
+				return err
+			})
+			assert(t, err != nil, "want the foreign key constraint enforced")
+		}
+
+		store.Close()
+		store.deleteDB()
+	}
+}
+
+func TestWithSecureDelete(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithSecureDelete(enabled))
+		assertNoError(t, err)
+
+		var got bool
+		err = store.db.QueryRow("PRAGMA secure_delete").Scan(&got)
+		assertNoError(t, err)
+		assert(t, got == enabled, fmt.Sprintf("want secure_delete %v, got: %v", enabled, got))
+
+		store.Close()
+		store.deleteDB()
+	}
+
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStoreWithOptions(path, WithSecureDelete(true))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	secret := []byte("secure delete payload")
+	err = store.StoreLogs([]*raft.Log{
+		{Index: 1, Term: 1, Data: secret},
+		{Index: 2, Term: 1, Data: []byte("kept")},
+	})
+	assertNoError(t, err)
+	err = store.Set([]byte("secret"), secret)
+	assertNoError(t, err)
+	err = store.Checkpoint("truncate")
+	assertNoError(t, err)
+
+	err = store.DeleteRange(1, 1)
+	assertNoError(t, err)
+	err = store.Delete([]byte("secret"))
+	assertNoError(t, err)
+	err = store.Checkpoint("truncate")
+	assertNoError(t, err)
+
+	data, err := os.ReadFile(path)
+	assertNoError(t, err)
+	assert(t, !bytes.Contains(data, secret), "want deleted payload zeroed in the database file")
+}
+
+func TestWithReadOnly(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStore(path)
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 3, "log")
+	err = store.Set([]byte("key1"), []byte("val1"))
+	assertNoError(t, err)
+
+	ro, err := NewStoreWithOptions(path, WithReadOnly(true))
+	assertNoError(t, err)
+	defer ro.Close()
+
+	idx, err := ro.LastIndex()
+	assertNoError(t, err)
+	assert(t, idx == 3, fmt.Sprintf("want last index 3, got: %d", idx))
+	err = ro.GetLog(2, new(raft.Log))
+	assertNoError(t, err)
+	val, err := ro.Get([]byte("key1"))
+	assertNoError(t, err)
+	assert(t, string(val) == "val1", fmt.Sprintf("want val1, got: %s", val))
+
+	errs := []error{
+		ro.StoreLog(createRaftLog(4, "log")),
+		ro.DeleteRange(1, 2),
+		ro.Set([]byte("key1"), []byte("val2")),
+		ro.SetUint64([]byte("key2"), 2),
+		ro.Delete([]byte("key1")),
+		ro.Vacuum(),
+	}
+	for i, err := range errs {
+		assert(t, err == ErrReadOnly, fmt.Sprintf("write %d: want read-only err, got: %v", i, err))
+	}
+
+	// the store itself is left untouched
+	count, err := store.CountLogs()
+	assertNoError(t, err)
+	assert(t, count == 3, fmt.Sprintf("want 3 logs, got: %d", count))
+}
+
+func TestWithReadOnlyOutdatedSchema(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	db, err := sql.Open(driverName, path)
+	assertNoError(t, err)
+	_, err = db.Exec("CREATE TABLE logs (idx INTEGER PRIMARY KEY, data BLOB)")
+	assertNoError(t, err)
+	db.Close()
+
+	_, err = NewStoreWithOptions(path, WithReadOnly(true))
+	assert(t, errors.Is(err, ErrSchemaOutdated), fmt.Sprintf("want schema outdated err, got: %v", err))
+}
+
+func TestWithStrictMonotonic(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithStrictMonotonic(true))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	// the first append may start anywhere
+	storeLogRange(t, store, 5, 7, "log")
+	storeLogRange(t, store, 8, 10, "log")
+
+	// gaps are allowed
+	storeLogRange(t, store, 20, 21, "log")
+
+	err = store.StoreLog(createRaftLog(15, "log"))
+	assert(t, errors.Is(err, ErrNonMonotonic), fmt.Sprintf("want non monotonic err, got: %v", err))
+
+	err = store.StoreLog(createRaftLog(21, "log"))
+	assert(t, errors.Is(err, ErrNonMonotonic), fmt.Sprintf("want non monotonic err, got: %v", err))
+
+	err = store.StoreLogs([]*raft.Log{createRaftLog(23, "log"), createRaftLog(22, "log")})
+	assert(t, errors.Is(err, ErrNonMonotonic), fmt.Sprintf("want non monotonic err, got: %v", err))
+
+	last, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 21, fmt.Sprintf("want last index 21, got: %d", last))
+
+	count, err := store.CountLogs()
+	assertNoError(t, err)
+	assert(t, count == 8, fmt.Sprintf("want 8 logs, got: %d", count))
+}
+
+func TestWithUpsertLogs(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithUpsertLogs(true))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 10, "old")
+	storeLogRange(t, store, 5, 15, "new")
+	err = store.StoreLog(createRaftLog(15, "newest"))
+	assertNoError(t, err)
+
+	count, err := store.CountLogs()
+	assertNoError(t, err)
+	assert(t, count == 15, fmt.Sprintf("want 15 logs, got: %d", count))
+
+	for idx, want := range map[uint64]string{1: "old", 4: "old", 5: "new", 14: "new", 15: "newest"} {
+		log := new(raft.Log)
+		err = store.GetLog(idx, log)
+		assertNoError(t, err)
+		assert(t, string(log.Data) == want, fmt.Sprintf("want data %s for index %d, got: %s", want, idx, log.Data))
+	}
+
+	last, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 15, fmt.Sprintf("want last index 15, got: %d", last))
+}
+
+func TestWithCheckpointOnClose(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprint(enabled), func(t *testing.T) {
+			path := t.TempDir() + "/raft.db"
+			store, err := NewStoreWithOptions(path, WithCheckpointOnClose(enabled))
+			assertNoError(t, err)
+			defer store.deleteDB()
+
+			// another connection keeps sqlite from removing the WAL when
+			// the store closes
+			other, err := NewStoreWithOptions(path, WithCheckpointOnClose(false))
+			assertNoError(t, err)
+			defer other.Close()
+
+			storeLogRange(t, store, 1, 100, "log")
+			err = store.Close()
+			assertNoError(t, err)
+
+			var walSize int64
+			if fi, err := os.Stat(path + "-wal"); err == nil {
+				walSize = fi.Size()
+			}
+			if enabled {
+				assert(t, walSize == 0, fmt.Sprintf("want empty wal, got: %d bytes", walSize))
+			} else {
+				assert(t, walSize > 0, "want wal left behind")
+			}
+		})
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	_, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithSynchronous("sometimes"))
+	assert(t, err != nil, "want error for invalid synchronous mode")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithJournalMode("wal; DROP TABLE logs"))
+	assert(t, err != nil, "want error for invalid journal mode")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithBusyTimeout(-time.Second))
+	assert(t, err != nil, "want error for negative busy timeout")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithMaxRetries(-1))
+	assert(t, err != nil, "want error for negative max retries")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithMaxOpenConns(-1))
+	assert(t, err != nil, "want error for negative max open connections")
+
+	for _, size := range []int{256, 1000, 131072} {
+		_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithPageSize(size))
+		assert(t, err != nil, fmt.Sprintf("want error for page size %d", size))
+	}
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithMmapSize(-1))
+	assert(t, err != nil, "want error for negative mmap size")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithAutoVacuum("partial"))
+	assert(t, err != nil, "want error for invalid auto vacuum mode")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithTempStore("disk"))
+	assert(t, err != nil, "want error for invalid temp store")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithCacheSize(math.MaxInt32+1))
+	assert(t, err != nil, "want error for out of range cache size")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithDirPerm(os.ModeDir|0o700))
+	assert(t, err != nil, "want error for non permission bits in the directory mode")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithFileMode(os.ModeSetuid|0o600))
+	assert(t, err != nil, "want error for non permission bits in the file mode")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithWalAutocheckpoint(-1))
+	assert(t, err != nil, "want error for negative wal autocheckpoint")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithJournalSizeLimit(-1))
+	assert(t, err != nil, "want error for negative journal size limit")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithExternalBlobDir(t.TempDir(), -1))
+	assert(t, err != nil, "want error for negative external blob threshold")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithMaxValueSize(-1))
+	assert(t, err != nil, "want error for negative max value size")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithLogCache(-1))
+	assert(t, err != nil, "want error for negative log cache size")
+
+	enc, err := NewAESGCMEncryptor(make([]byte, 32))
+	assertNoError(t, err)
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithPayloadDedup(true), WithEncryptor(enc))
+	assert(t, err != nil, "want error for payload dedup with an encryptor")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithArchive(":memory:"))
+	assert(t, err != nil, "want error for in-memory archive")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithLogsTable("logs; DROP TABLE kv"))
+	assert(t, err != nil, "want error for invalid logs table name")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithKVTable("1kv"))
+	assert(t, err != nil, "want error for invalid kv table name")
+
+	_, err = NewStoreWithOptions(t.TempDir()+"/raft.db", WithLogsTable("raft"), WithKVTable("raft"))
+	assert(t, err != nil, "want error for clashing table names")
+}
+
+func TestWithAutoVacuum(t *testing.T) {
+	// PRAGMA auto_vacuum reports the mode as a number
+	for mode, want := range map[string]int{"none": 0, "full": 1, "incremental": 2} {
+		store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithAutoVacuum(mode))
+		assertNoError(t, err)
+
+		var autoVacuum int
+		err = store.db.QueryRow("PRAGMA auto_vacuum").Scan(&autoVacuum)
+		assertNoError(t, err)
+		assert(t, autoVacuum == want, fmt.Sprintf("want auto_vacuum %d for %s, got: %d", want, mode, autoVacuum))
+
+		store.Close()
+		store.deleteDB()
+	}
+}
@@ -0,0 +1,127 @@
+package raftsqlite
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// runtimePragmas are the pragmas that can be read and changed on an open
+// store. They only tune the connection, none of them can break the store
+// invariants or change the schema.
+var runtimePragmas = map[string]bool{
+	"automatic_index":    true,
+	"busy_timeout":       true,
+	"cache_size":         true,
+	"cache_spill":        true,
+	"journal_size_limit": true,
+	"mmap_size":          true,
+	"secure_delete":      true,
+	"synchronous":        true,
+	"temp_store":         true,
+	"wal_autocheckpoint": true,
+}
+
+// pragmaValueRe matches the values that can safely be interpolated in a
+// pragma statement, keywords and integers.
+var pragmaValueRe = regexp.MustCompile(`^-?[A-Za-z0-9_]+$`)
+
+// runtimePragma returns the normalized name of a pragma that can be used
+// at runtime.
+func runtimePragma(name string) (string, error) {
+	name = strings.ToLower(name)
+	if !runtimePragmas[name] {
+		return "", fmt.Errorf("unsupported pragma %q", name)
+	}
+	return name, nil
+}
+
+// SetPragma sets the value of a pragma on the store connection, such as
+// relaxing synchronous during a bulk load. Only a few pragmas tuning the
+// connection are allowed: automatic_index, busy_timeout, cache_size,
+// cache_spill, journal_size_limit, mmap_size, secure_delete, synchronous,
+// temp_store and wal_autocheckpoint. The value must be a keyword or an
+// integer. Pragmas only apply to the connection they are issued on, so
+// with more than one open connection, see WithMaxOpenConns, the others
+// keep their settings.
+func (s *SqliteStore) SetPragma(name, value string) error {
+	name, err := runtimePragma(name)
+	if err != nil {
+		return err
+	}
+	if !pragmaValueRe.MatchString(value) {
+		return fmt.Errorf("invalid value %q for pragma %s", value, name)
+	}
+
+	return s.withReconnect(func() error {
+		_, err := s.db.Exec(fmt.Sprintf("PRAGMA %s=%s", name, value))
+		return err
+	})
+}
+
+// GetPragma returns the value of a pragma on the store connection. The
+// allowed pragmas are the same as for SetPragma. sqlite reports the
+// enumerated settings by their number, synchronous=full reads as "2".
+func (s *SqliteStore) GetPragma(name string) (string, error) {
+	name, err := runtimePragma(name)
+	if err != nil {
+		return "", err
+	}
+
+	var value string
+	err = s.withReconnect(func() error {
+		return s.db.QueryRow("PRAGMA " + name).Scan(&value)
+	})
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// bulkLoadPragmas are the pragmas BulkLoad relaxes for its duration.
+var bulkLoadPragmas = []struct{ name, value string }{
+	{"synchronous", "off"},
+	{"wal_autocheckpoint", "0"},
+}
+
+// BulkLoad runs fn with synchronous=off and the WAL automatic checkpoints
+// disabled, speeding up one-time bulk inserts such as restoring a node
+// from a snapshot. The previous settings are restored once fn returns,
+// even if it fails, and a final checkpoint makes the loaded data durable
+// and truncates the WAL. A crash during fn may corrupt the database, so
+// it is only meant for data that can be loaded again from scratch. As
+// with SetPragma, only the store connection is relaxed when there is
+// more than one, see WithMaxOpenConns.
+func (s *SqliteStore) BulkLoad(fn func() error) (err error) {
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+
+	previous := make([]string, len(bulkLoadPragmas))
+	for i, p := range bulkLoadPragmas {
+		if previous[i], err = s.GetPragma(p.name); err != nil {
+			return err
+		}
+	}
+
+	defer func() {
+		for i, p := range bulkLoadPragmas {
+			if rerr := s.SetPragma(p.name, previous[i]); rerr != nil {
+				err = errors.Join(err, fmt.Errorf("restoring pragma %s: %w", p.name, rerr))
+			}
+		}
+		if !s.inMemory {
+			if cerr := s.checkpoint("truncate"); cerr != nil {
+				err = errors.Join(err, cerr)
+			}
+		}
+	}()
+
+	for _, p := range bulkLoadPragmas {
+		if err := s.SetPragma(p.name, p.value); err != nil {
+			return err
+		}
+	}
+	return fn()
+}
@@ -0,0 +1,108 @@
+package raftsqlite
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSetPragma(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	// 1 == NORMAL
+	value, err := store.GetPragma("synchronous")
+	assertNoError(t, err)
+	assert(t, value == "1", fmt.Sprintf("want synchronous 1, got: %s", value))
+
+	// 2 == FULL
+	err = store.SetPragma("synchronous", "full")
+	assertNoError(t, err)
+	value, err = store.GetPragma("SYNCHRONOUS")
+	assertNoError(t, err)
+	assert(t, value == "2", fmt.Sprintf("want synchronous 2, got: %s", value))
+
+	err = store.SetPragma("synchronous", "normal")
+	assertNoError(t, err)
+	value, err = store.GetPragma("synchronous")
+	assertNoError(t, err)
+	assert(t, value == "1", fmt.Sprintf("want synchronous 1, got: %s", value))
+
+	err = store.SetPragma("cache_size", "-4096")
+	assertNoError(t, err)
+	value, err = store.GetPragma("cache_size")
+	assertNoError(t, err)
+	assert(t, value == "-4096", fmt.Sprintf("want cache_size -4096, got: %s", value))
+
+	for _, name := range []string{"journal_mode", "writable_schema", "synchronous=off; DROP TABLE logs", "table_info(logs)"} {
+		err = store.SetPragma(name, "off")
+		assert(t, err != nil, fmt.Sprintf("want error setting pragma %q", name))
+		_, err = store.GetPragma(name)
+		assert(t, err != nil, fmt.Sprintf("want error getting pragma %q", name))
+	}
+
+	for _, value := range []string{"", "off; DROP TABLE logs", "'full'", "1 OR 1"} {
+		err = store.SetPragma("synchronous", value)
+		assert(t, err != nil, fmt.Sprintf("want error for value %q", value))
+	}
+
+	// the rejected statements must not have run
+	value, err = store.GetPragma("synchronous")
+	assertNoError(t, err)
+	assert(t, value == "1", fmt.Sprintf("want synchronous 1, got: %s", value))
+	_, err = store.LastIndex()
+	assertNoError(t, err)
+}
+
+func TestBulkLoad(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+	store, err := NewStoreWithOptions(path, WithWalAutocheckpoint(500))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err = store.BulkLoad(func() error {
+		// 0 == OFF
+		value, err := store.GetPragma("synchronous")
+		assertNoError(t, err)
+		assert(t, value == "0", fmt.Sprintf("want synchronous 0 during bulk load, got: %s", value))
+		value, err = store.GetPragma("wal_autocheckpoint")
+		assertNoError(t, err)
+		assert(t, value == "0", fmt.Sprintf("want wal_autocheckpoint 0 during bulk load, got: %s", value))
+
+		storeLogRange(t, store, 1, 100, "data")
+		return nil
+	})
+	assertNoError(t, err)
+
+	assertPragmas := func() {
+		t.Helper()
+		value, err := store.GetPragma("synchronous")
+		assertNoError(t, err)
+		assert(t, value == "1", fmt.Sprintf("want synchronous 1, got: %s", value))
+		value, err = store.GetPragma("wal_autocheckpoint")
+		assertNoError(t, err)
+		assert(t, value == "500", fmt.Sprintf("want wal_autocheckpoint 500, got: %s", value))
+	}
+	assertPragmas()
+
+	// the final checkpoint truncates the WAL
+	size := fileSize(t, path+"-wal")
+	assert(t, size == 0, fmt.Sprintf("want empty wal after bulk load, got: %d", size))
+	last, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 100, fmt.Sprintf("want last index 100, got: %d", last))
+
+	// the pragmas are restored when fn fails too
+	errLoad := errors.New("load failed")
+	err = store.BulkLoad(func() error {
+		return errLoad
+	})
+	assert(t, errors.Is(err, errLoad), fmt.Sprintf("want load err, got: %v", err))
+	assertPragmas()
+}
@@ -0,0 +1,114 @@
+package raftsqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// Reader exposes the read methods of a SqliteStore, see ReadSnapshot.
+type Reader interface {
+	FirstIndex() (uint64, error)
+	LastIndex() (uint64, error)
+	CountLogs() (uint64, error)
+	GetLog(idx uint64, log *raft.Log) error
+	Get(k []byte) ([]byte, error)
+	GetUint64(k []byte) (uint64, error)
+}
+
+var _ Reader = (*SqliteStore)(nil)
+
+// txReader is a Reader running its queries within a read transaction.
+type txReader struct {
+	s   *SqliteStore
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+// ReadSnapshot calls fn with a Reader whose reads all observe the same
+// point in time view of the store, unaffected by concurrent writes, such
+// as to read the first and last indexes along with the number of logs
+// without them drifting apart. The view is the one of a single read
+// transaction, which is held until fn returns, so fn should be short
+// lived. The Reader must not be used after fn returns. In-memory stores
+// and stores not in WAL mode read through their single write connection,
+// which the transaction holds, so there fn must not call the store
+// methods.
+func (s *SqliteStore) ReadSnapshot(fn func(r Reader) error) error {
+	ctx := context.Background()
+	tx, err := s.beginRead(ctx)
+	if err != nil {
+		return err
+	}
+	// nothing to commit, the transaction only provides a stable view
+	defer tx.Rollback()
+
+	return fn(&txReader{s: s, ctx: ctx, tx: tx})
+}
+
+// FirstIndex returns the first index as of the snapshot.
+func (r *txReader) FirstIndex() (uint64, error) {
+	first, _, err := r.s.bounds(r.ctx, r.tx)
+	return first, err
+}
+
+// LastIndex returns the last index as of the snapshot.
+func (r *txReader) LastIndex() (uint64, error) {
+	_, last, err := r.s.bounds(r.ctx, r.tx)
+	return last, err
+}
+
+// CountLogs returns the number of logs as of the snapshot.
+func (r *txReader) CountLogs() (uint64, error) {
+	var count uint64
+	err := r.tx.QueryRowContext(r.ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", r.s.opts.logsTable)).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetLog reads the log at idx as of the snapshot.
+func (r *txReader) GetLog(idx uint64, log *raft.Log) error {
+	var data, shared []byte
+	var crc sql.NullInt64
+	// the prepared statement may belong to a newer handle than the
+	// transaction, after a reconnection
+	err := r.tx.QueryRowContext(r.ctx, r.s.getLogQuery(), idx).Scan(&data, &crc, &shared)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// the archive is read within the same transaction, so the
+			// logs moved there since the snapshot aren't missed
+			if r.s.opts.archive != "" {
+				return r.s.getArchivedLog(r.ctx, r.tx, idx, log)
+			}
+			return raft.ErrLogNotFound
+		}
+		return err
+	}
+	return r.s.loadLog(idx, data, crc, shared, log)
+}
+
+// Get returns the value of k as of the snapshot.
+func (r *txReader) Get(k []byte) ([]byte, error) {
+	v, ok, err := r.s.getTx(r.tx, k)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return v, nil
+}
+
+// GetUint64 is like Get, but handles uint64 values.
+func (r *txReader) GetUint64(k []byte) (uint64, error) {
+	v, err := r.Get(k)
+	if err != nil {
+		return 0, err
+	}
+	return bytesToUint64(v), nil
+}
@@ -0,0 +1,71 @@
+package raftsqlite
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestReadSnapshot(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 10, "log")
+	err := store.SetUint64([]byte("key1"), 1)
+	assertNoError(t, err)
+
+	err = store.ReadSnapshot(func(r Reader) error {
+		last, err := r.LastIndex()
+		assertNoError(t, err)
+		assert(t, last == 10, fmt.Sprintf("want last index 10, got: %d", last))
+
+		// a concurrent writer commits between the reads
+		done := make(chan error)
+		go func() {
+			if err := store.DeleteRange(1, 5); err != nil {
+				done <- err
+				return
+			}
+			if err := store.StoreLogs([]*raft.Log{createRaftLog(11, "log"), createRaftLog(12, "log")}); err != nil {
+				done <- err
+				return
+			}
+			done <- store.SetUint64([]byte("key1"), 2)
+		}()
+		assertNoError(t, <-done)
+
+		first, err := r.FirstIndex()
+		assertNoError(t, err)
+		last, err = r.LastIndex()
+		assertNoError(t, err)
+		count, err := r.CountLogs()
+		assertNoError(t, err)
+		assert(t, first == 1 && last == 10 && count == 10,
+			fmt.Sprintf("want range [1, 10] with 10 logs, got: [%d, %d] with %d logs", first, last, count))
+
+		log := new(raft.Log)
+		err = r.GetLog(3, log)
+		assertNoError(t, err)
+		assert(t, log.Index == 3, fmt.Sprintf("want log 3, got: %d", log.Index))
+		err = r.GetLog(11, log)
+		assert(t, err == raft.ErrLogNotFound, fmt.Sprintf("want log not found err, got: %v", err))
+
+		v, err := r.GetUint64([]byte("key1"))
+		assertNoError(t, err)
+		assert(t, v == 1, fmt.Sprintf("want key1 1, got: %d", v))
+		_, err = r.Get([]byte("missing"))
+		assert(t, err == ErrKeyNotFound, fmt.Sprintf("want not found err, got: %v", err))
+		return nil
+	})
+	assertNoError(t, err)
+
+	// outside of the snapshot, the writes are visible
+	assertBounds(t, store, 6, 12)
+	v, err := store.GetUint64([]byte("key1"))
+	assertNoError(t, err)
+	assert(t, v == 2, fmt.Sprintf("want key1 2, got: %d", v))
+}
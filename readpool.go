@@ -0,0 +1,57 @@
+package raftsqlite
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+// defaultReadPoolSize is the number of connections of the read pool.
+var defaultReadPoolSize = max(4, runtime.NumCPU())
+
+// useReadPool reports whether the reads go through a pool of read-only
+// connections. Under WAL, readers don't block the writer nor each other,
+// so they can run concurrently with the single write connection. Other
+// journal modes lock readers out while writing, and in-memory databases
+// are not shared with read-only connections.
+func (s *SqliteStore) useReadPool() bool {
+	return s.opts.readPoolSize > 0 && s.ownsDB && !s.inMemory && !s.opts.readOnly && s.opts.journalMode == "wal"
+}
+
+// openReadPool opens the read pool if enabled, otherwise the reads go
+// through the write connection. It must be called once the schema is
+// up to date.
+func (s *SqliteStore) openReadPool(ctx context.Context) error {
+	s.readDB = s.db
+	if !s.useReadPool() {
+		return nil
+	}
+
+	ro := s.opts
+	ro.readOnly = true
+	db := s.openStoreDB(readOnlyDSN(s.connDSN), ro.pragmas()...)
+	db.SetMaxOpenConns(s.opts.readPoolSize)
+	db.SetMaxIdleConns(s.opts.readPoolSize)
+	db.SetConnMaxLifetime(s.opts.connMaxLifetime)
+
+	// both handles must refer to the same file, sharing the WAL, or the
+	// reads would miss the writes
+	var writeFile, readFile, journalMode string
+	err := s.db.QueryRowContext(ctx, "SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&writeFile)
+	if err == nil {
+		err = db.QueryRowContext(ctx, "SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&readFile)
+	}
+	if err == nil {
+		err = db.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&journalMode)
+	}
+	if err == nil && (readFile != writeFile || journalMode != "wal") {
+		err = fmt.Errorf("read pool opened %s in %s mode, want %s in wal mode", readFile, journalMode, writeFile)
+	}
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("opening read pool: %w", err)
+	}
+
+	s.readDB = db
+	return nil
+}
@@ -0,0 +1,68 @@
+package raftsqlite
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestReadPool(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	assert(t, store.readDB != store.db, "want a separate read pool")
+	stats := store.readDB.Stats()
+	assert(t, stats.MaxOpenConnections == defaultReadPoolSize, fmt.Sprintf("want %d max open read connections, got: %d", defaultReadPoolSize, stats.MaxOpenConnections))
+
+	// the reads see every committed write
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 1; i <= 50; i++ {
+				idx := uint64(w*50 + i)
+				if err := store.StoreLog(createRaftLog(idx, "log")); err != nil {
+					t.Error(err)
+					return
+				}
+				log := new(raft.Log)
+				if err := store.GetLog(idx, log); err != nil {
+					t.Errorf("reading log %d after storing it: %v", idx, err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	assertBounds(t, store, 1, 200)
+
+	err := store.Set([]byte("key1"), []byte("val1"))
+	assertNoError(t, err)
+	val, err := store.Get([]byte("key1"))
+	assertNoError(t, err)
+	assert(t, string(val) == "val1", fmt.Sprintf("want val1, got: %s", val))
+
+	// read connections can't write
+	_, err = store.readDB.Exec("DELETE FROM logs")
+	assert(t, err != nil, "want error writing through the read pool")
+}
+
+func TestReadPoolDisabled(t *testing.T) {
+	inmem := mustSqliteInMemoryStore(t)
+	defer inmem.Close()
+	assert(t, inmem.readDB == inmem.db, "want in-memory stores to read through the write connection")
+
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithJournalMode("delete"))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+	assert(t, store.readDB == store.db, "want stores not in wal mode to read through the write connection")
+}
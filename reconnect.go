@@ -0,0 +1,110 @@
+package raftsqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// isClosedError reports whether err means the database handle or its
+// connection can no longer be used. database/sql does not export the
+// error of a closed handle, so it is matched by message.
+func isClosedError(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, sql.ErrConnDone) || errors.Is(err, driver.ErrBadConn) ||
+		strings.Contains(err.Error(), "sql: database is closed")
+}
+
+// withReconnect runs fn, holding the store connection steady. If
+// WithAutoReconnect is enabled and fn fails because the database handle
+// is no longer usable, the database is reopened and fn is run once more.
+// Any other error is returned as is.
+func (s *SqliteStore) withReconnect(fn func() error) error {
+	if !s.opts.autoReconnect || !s.ownsDB || s.inMemory {
+		return fn()
+	}
+
+	s.connMu.RLock()
+	gen := s.connGen
+	err := fn()
+	s.connMu.RUnlock()
+	if !isClosedError(err) {
+		return err
+	}
+
+	if rerr := s.reconnect(gen); rerr != nil {
+		return errors.Join(err, fmt.Errorf("reconnecting: %w", rerr))
+	}
+
+	s.connMu.RLock()
+	defer s.connMu.RUnlock()
+	return fn()
+}
+
+// beginRead starts a read transaction on the read pool, reconnecting as
+// withReconnect does. Only starting it holds the connection steady, so
+// callers may iterate over the transaction while calling back into the
+// store: a transaction outlives the handle it was started from.
+func (s *SqliteStore) beginRead(ctx context.Context) (tx *sql.Tx, err error) {
+	err = s.withReconnect(func() error {
+		tx, err = s.readDB.BeginTx(ctx, nil)
+		return err
+	})
+	return tx, err
+}
+
+// reconnect reopens the database and prepares the statements again,
+// unless it was already done since the connection generation gen, such
+// as by a concurrent call, or the store is closed.
+func (s *SqliteStore) reconnect(gen uint64) error {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if s.connGen != gen {
+		return nil
+	}
+
+	ctx := context.Background()
+	db, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the new handles are swapped in all at once, if any step fails the
+	// store keeps the old ones and a later call tries again
+	oldDB, oldReadDB, oldStmts := s.db, s.readDB, s.statements()
+	s.db = db
+	if err := s.openReadPool(ctx); err != nil {
+		s.db, s.readDB = oldDB, oldReadDB
+		db.Close()
+		return err
+	}
+	if err := s.prepareStatements(ctx); err != nil {
+		if s.readDB != db {
+			s.readDB.Close()
+		}
+		s.db, s.readDB = oldDB, oldReadDB
+		db.Close()
+		return err
+	}
+
+	// the old handles are unusable, their statements and connections
+	// are released on a best effort basis
+	closeStmts(oldStmts)
+	if oldReadDB != oldDB {
+		oldReadDB.Close()
+	}
+	oldDB.Close()
+	s.connGen++
+
+	s.opts.logger.Warn("reconnected to database", "path", s.path)
+	return nil
+}
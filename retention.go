@@ -0,0 +1,54 @@
+package raftsqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DeleteLogsOlderThan deletes the logs stored before t, returning how
+// many were deleted. Only logs up to maxIdx are considered, which should
+// be at most the last index known to be committed and snapshotted, so a
+// retention policy never removes logs raft still needs. Logs stored by
+// versions without the stored time are never deleted.
+func (s *SqliteStore) DeleteLogsOlderThan(t time.Time, maxIdx uint64) (int64, error) {
+	if s.opts.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	start := time.Now()
+	var deleted int64
+	var blobs []string
+	// the deleted logs are not known, as they are not a range
+	defer s.logCache.purge()
+	err := s.transaction(func(tx *sql.Tx) error {
+		var err error
+		blobs, err = s.releaseLogs(context.Background(), tx, "appended_at < ? AND idx <= ?", t.UnixNano(), maxIdx)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE appended_at < ? AND idx <= ?", s.opts.logsTable), t.UnixNano(), maxIdx)
+		if err != nil {
+			return err
+		}
+
+		deleted, err = res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return nil
+		}
+		// the deleted logs are not necessarily a range
+		return s.recomputeBounds(context.Background(), tx)
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.removeBlobs(blobs)
+
+	s.opts.observer.ObserveDeleteRange(deleted, time.Since(start))
+	return deleted, nil
+}
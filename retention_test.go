@@ -0,0 +1,42 @@
+package raftsqlite
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDeleteLogsOlderThan(t *testing.T) {
+	clock := newFakeClock()
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithClock(clock))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 5, "old")
+	clock.Advance(time.Hour)
+	storeLogRange(t, store, 6, 10, "new")
+	clock.Advance(time.Hour)
+
+	deleted, err := store.DeleteLogsOlderThan(clock.Now().Add(-90*time.Minute), 10)
+	assertNoError(t, err)
+	assert(t, deleted == 5, fmt.Sprintf("want 5 logs deleted, got: %d", deleted))
+
+	first, err := store.FirstIndex()
+	assertNoError(t, err)
+	assert(t, first == 6, fmt.Sprintf("want first index 6, got: %d", first))
+
+	// logs past maxIdx are kept regardless of their age
+	deleted, err = store.DeleteLogsOlderThan(clock.Now(), 7)
+	assertNoError(t, err)
+	assert(t, deleted == 2, fmt.Sprintf("want 2 logs deleted, got: %d", deleted))
+
+	first, err = store.FirstIndex()
+	assertNoError(t, err)
+	assert(t, first == 8, fmt.Sprintf("want first index 8, got: %d", first))
+	last, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 10, fmt.Sprintf("want last index 10, got: %d", last))
+}
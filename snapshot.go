@@ -0,0 +1,330 @@
+package raftsqlite
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/raft"
+)
+
+// snapshotChunkSize is the size of the blobs a snapshot is split into.
+const snapshotChunkSize = 1 << 20
+
+// SqliteSnapshotStore implements the raft.SnapshotStore interface,
+// keeping the snapshots in the database of a SqliteStore. The metadata
+// lives in the snapshot_meta table and the data in the snapshots table,
+// split in chunks, both keyed by the logs table name of the store so
+// stores sharing a database don't see each other snapshots.
+type SqliteSnapshotStore struct {
+	store  *SqliteStore
+	retain int
+}
+
+var _ raft.SnapshotStore = (*SqliteSnapshotStore)(nil)
+
+// NewSnapshotStore returns a snapshot store backed by the database of
+// store, retaining at most retain snapshots. The store must stay open for
+// as long as the snapshot store is in use. The data of snapshots that
+// were never completed, such as after a crash, is deleted.
+func NewSnapshotStore(store *SqliteStore, retain int) (*SqliteSnapshotStore, error) {
+	if retain < 1 {
+		return nil, fmt.Errorf("must retain at least one snapshot, got %d", retain)
+	}
+
+	ss := &SqliteSnapshotStore{store: store, retain: retain}
+	if !store.opts.readOnly {
+		err := store.transaction(func(tx *sql.Tx) error {
+			_, err := tx.Exec("DELETE FROM snapshots WHERE store = ? AND id NOT IN (SELECT id FROM snapshot_meta WHERE store = ?)",
+				store.opts.logsTable, store.opts.logsTable)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ss, nil
+}
+
+// Create is used to begin a snapshot at a given index and term, and with
+// the given committed configuration. The snapshot only becomes visible
+// once the returned sink is closed.
+func (ss *SqliteSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64,
+	configuration raft.Configuration, configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+	if version < raft.SnapshotVersionMin || version > raft.SnapshotVersionMax {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	if ss.store.opts.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	id := fmt.Sprintf("%d-%d-%d", term, index, ss.store.opts.clock.Now().UnixMilli())
+	ss.store.opts.logger.Debug("creating snapshot", "id", id)
+	return &sqliteSnapshotSink{
+		store: ss,
+		meta: raft.SnapshotMeta{
+			Version:            version,
+			ID:                 id,
+			Index:              index,
+			Term:               term,
+			Configuration:      configuration,
+			ConfigurationIndex: configurationIndex,
+		},
+	}, nil
+}
+
+// List returns the metadata of the available snapshots, newest first.
+func (ss *SqliteSnapshotStore) List() ([]*raft.SnapshotMeta, error) {
+	var metas []*raft.SnapshotMeta
+	err := ss.store.withReconnect(func() error {
+		metas = nil
+		rows, err := ss.store.readDB.Query("SELECT id, version, idx, term, configuration, configuration_index, size FROM snapshot_meta "+
+			"WHERE store = ? ORDER BY term DESC, idx DESC, id DESC", ss.store.opts.logsTable)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			meta, err := scanSnapshotMeta(rows)
+			if err != nil {
+				return err
+			}
+			metas = append(metas, meta)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return metas, nil
+}
+
+// Open takes a snapshot ID and returns its metadata and a ReadCloser
+// over its data. The data is read one chunk at a time, failing if the
+// snapshot is reaped before all of it is read.
+func (ss *SqliteSnapshotStore) Open(id string) (*raft.SnapshotMeta, io.ReadCloser, error) {
+	var meta *raft.SnapshotMeta
+	err := ss.store.withReconnect(func() (err error) {
+		row := ss.store.readDB.QueryRow("SELECT id, version, idx, term, configuration, configuration_index, size FROM snapshot_meta "+
+			"WHERE store = ? AND id = ?", ss.store.opts.logsTable, id)
+		meta, err = scanSnapshotMeta(row)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, fmt.Errorf("snapshot %q not found", id)
+		}
+		return nil, nil, err
+	}
+	return meta, &sqliteSnapshotReader{store: ss.store, id: id, size: meta.Size}, nil
+}
+
+func scanSnapshotMeta(row interface{ Scan(dest ...any) error }) (*raft.SnapshotMeta, error) {
+	var meta raft.SnapshotMeta
+	var configuration []byte
+	err := row.Scan(&meta.ID, &meta.Version, &meta.Index, &meta.Term, &configuration, &meta.ConfigurationIndex, &meta.Size)
+	if err != nil {
+		return nil, err
+	}
+	meta.Configuration = raft.DecodeConfiguration(configuration)
+	return &meta, nil
+}
+
+// sqliteSnapshotSink buffers the written data and stores it in chunks,
+// each in its own transaction so the store isn't blocked while the
+// snapshot is taken. The metadata is only stored on Close, which makes
+// the snapshot visible.
+type sqliteSnapshotSink struct {
+	store  *SqliteSnapshotStore
+	meta   raft.SnapshotMeta
+	buf    bytes.Buffer
+	seq    int
+	closed bool
+}
+
+// ID returns the ID of the snapshot being written.
+func (s *sqliteSnapshotSink) ID() string {
+	return s.meta.ID
+}
+
+// Write appends p to the snapshot, storing a chunk whenever enough data
+// is buffered.
+func (s *sqliteSnapshotSink) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errors.New("snapshot sink is closed")
+	}
+
+	n, _ := s.buf.Write(p)
+	s.meta.Size += int64(n)
+	for s.buf.Len() >= snapshotChunkSize {
+		if err := s.flush(s.buf.Next(snapshotChunkSize)); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// flush stores chunk as the next chunk of the snapshot.
+func (s *sqliteSnapshotSink) flush(chunk []byte) error {
+	store := s.store.store
+	chunk, err := store.seal(chunk)
+	if err != nil {
+		return err
+	}
+
+	err = store.transaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT INTO snapshots (store, id, seq, data) VALUES (?, ?, ?, ?)", store.opts.logsTable, s.meta.ID, s.seq, chunk)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.seq++
+	return nil
+}
+
+// Close stores the remaining data and the metadata of the snapshot,
+// then deletes the snapshots past the retain count.
+func (s *sqliteSnapshotSink) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	if s.buf.Len() > 0 {
+		if err := s.flush(s.buf.Bytes()); err != nil {
+			return errors.Join(err, s.cancel())
+		}
+	}
+
+	store := s.store.store
+	err := store.transaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT INTO snapshot_meta (store, id, version, idx, term, configuration, configuration_index, size) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?)", store.opts.logsTable, s.meta.ID, s.meta.Version, s.meta.Index, s.meta.Term,
+			raft.EncodeConfiguration(s.meta.Configuration), s.meta.ConfigurationIndex, s.meta.Size)
+		if err != nil {
+			return err
+		}
+		return s.store.reapTx(tx)
+	})
+	if err != nil {
+		return errors.Join(err, s.cancel())
+	}
+	return nil
+}
+
+// Cancel discards the snapshot.
+func (s *sqliteSnapshotSink) Cancel() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.cancel()
+}
+
+func (s *sqliteSnapshotSink) cancel() error {
+	store := s.store.store
+	return store.transaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM snapshots WHERE store = ? AND id = ?", store.opts.logsTable, s.meta.ID)
+		return err
+	})
+}
+
+// reapTx deletes the oldest snapshots past the retain count within tx.
+func (ss *SqliteSnapshotStore) reapTx(tx *sql.Tx) error {
+	store := ss.store.opts.logsTable
+	rows, err := tx.Query("SELECT id FROM snapshot_meta WHERE store = ? ORDER BY term DESC, idx DESC, id DESC LIMIT -1 OFFSET ?", store, ss.retain)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		ss.store.opts.logger.Debug("reaping snapshot", "id", id)
+		if _, err := tx.Exec("DELETE FROM snapshot_meta WHERE store = ? AND id = ?", store, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM snapshots WHERE store = ? AND id = ?", store, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteSnapshotReader reads the chunks of a snapshot in order. Each
+// chunk is read on its own, so the snapshot may be reaped meanwhile, which
+// is detected by comparing the data read to its size.
+type sqliteSnapshotReader struct {
+	store *SqliteStore
+	id    string
+	size  int64
+	read  int64
+	seq   int
+	buf   []byte
+	eof   bool
+}
+
+// Read reads from the current chunk, loading the next one once it is
+// exhausted.
+func (r *sqliteSnapshotReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *sqliteSnapshotReader) next() error {
+	var chunk []byte
+	err := r.store.withReconnect(func() error {
+		return r.store.readDB.QueryRow("SELECT data FROM snapshots WHERE store = ? AND id = ? AND seq = ?",
+			r.store.opts.logsTable, r.id, r.seq).Scan(&chunk)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			if r.read < r.size {
+				return fmt.Errorf("snapshot %q is missing chunk %d, read %d of %d bytes", r.id, r.seq, r.read, r.size)
+			}
+			r.eof = true
+			return nil
+		}
+		return err
+	}
+
+	r.buf, err = r.store.open(chunk)
+	if err != nil {
+		return err
+	}
+	r.read += int64(len(r.buf))
+	r.seq++
+	return nil
+}
+
+// Close releases the reader.
+func (r *sqliteSnapshotReader) Close() error {
+	r.buf = nil
+	r.eof = true
+	return nil
+}
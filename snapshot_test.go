@@ -0,0 +1,147 @@
+package raftsqlite
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func createSnapshot(t *testing.T, ss *SqliteSnapshotStore, index, term uint64, data []byte) string {
+	t.Helper()
+
+	configuration := raft.Configuration{Servers: []raft.Server{
+		{Suffrage: raft.Voter, ID: "node1", Address: "127.0.0.1:8300"},
+	}}
+	sink, err := ss.Create(raft.SnapshotVersionMax, index, term, configuration, 2, nil)
+	assertNoError(t, err)
+
+	_, err = sink.Write(data)
+	assertNoError(t, err)
+	err = sink.Close()
+	assertNoError(t, err)
+	return sink.ID()
+}
+
+func TestSnapshotStore(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	ss, err := NewSnapshotStore(store, 2)
+	assertNoError(t, err)
+
+	snapshots, err := ss.List()
+	assertNoError(t, err)
+	assert(t, len(snapshots) == 0, fmt.Sprintf("want no snapshots, got: %d", len(snapshots)))
+
+	// spans a few chunks
+	data := make([]byte, 2*snapshotChunkSize+100)
+	_, err = rand.Read(data)
+	assertNoError(t, err)
+	id := createSnapshot(t, ss, 10, 3, data)
+
+	snapshots, err = ss.List()
+	assertNoError(t, err)
+	assert(t, len(snapshots) == 1, fmt.Sprintf("want 1 snapshot, got: %d", len(snapshots)))
+	assert(t, snapshots[0].ID == id, fmt.Sprintf("want snapshot %s, got: %s", id, snapshots[0].ID))
+
+	meta, r, err := ss.Open(id)
+	assertNoError(t, err)
+	defer r.Close()
+	assert(t, meta.Index == 10, fmt.Sprintf("want index 10, got: %d", meta.Index))
+	assert(t, meta.Term == 3, fmt.Sprintf("want term 3, got: %d", meta.Term))
+	assert(t, meta.ConfigurationIndex == 2, fmt.Sprintf("want configuration index 2, got: %d", meta.ConfigurationIndex))
+	assert(t, meta.Size == int64(len(data)), fmt.Sprintf("want size %d, got: %d", len(data), meta.Size))
+	assert(t, len(meta.Configuration.Servers) == 1 && meta.Configuration.Servers[0].ID == "node1",
+		fmt.Sprintf("want configuration with node1, got: %v", meta.Configuration))
+
+	got, err := io.ReadAll(r)
+	assertNoError(t, err)
+	assert(t, bytes.Equal(got, data), "want snapshot data to round-trip")
+
+	_, _, err = ss.Open("missing")
+	assert(t, err != nil, "want error opening a missing snapshot")
+}
+
+func TestSnapshotStoreRetain(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	ss, err := NewSnapshotStore(store, 2)
+	assertNoError(t, err)
+
+	createSnapshot(t, ss, 10, 1, []byte("snap1"))
+	id2 := createSnapshot(t, ss, 20, 1, []byte("snap2"))
+	id3 := createSnapshot(t, ss, 30, 2, []byte("snap3"))
+
+	snapshots, err := ss.List()
+	assertNoError(t, err)
+	assert(t, len(snapshots) == 2, fmt.Sprintf("want 2 snapshots, got: %d", len(snapshots)))
+	assert(t, snapshots[0].ID == id3 && snapshots[1].ID == id2, fmt.Sprintf("want newest snapshots first, got: %s, %s", snapshots[0].ID, snapshots[1].ID))
+
+	var chunks int
+	err = store.db.QueryRow("SELECT COUNT(*) FROM snapshots").Scan(&chunks)
+	assertNoError(t, err)
+	assert(t, chunks == 2, fmt.Sprintf("want 2 chunks, got: %d", chunks))
+}
+
+func TestSnapshotStoreCancel(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	ss, err := NewSnapshotStore(store, 1)
+	assertNoError(t, err)
+
+	sink, err := ss.Create(raft.SnapshotVersionMax, 10, 1, raft.Configuration{}, 1, nil)
+	assertNoError(t, err)
+	_, err = sink.Write(make([]byte, snapshotChunkSize+1))
+	assertNoError(t, err)
+	err = sink.Cancel()
+	assertNoError(t, err)
+
+	snapshots, err := ss.List()
+	assertNoError(t, err)
+	assert(t, len(snapshots) == 0, fmt.Sprintf("want no snapshots, got: %d", len(snapshots)))
+
+	var chunks int
+	err = store.db.QueryRow("SELECT COUNT(*) FROM snapshots").Scan(&chunks)
+	assertNoError(t, err)
+	assert(t, chunks == 0, fmt.Sprintf("want no chunks, got: %d", chunks))
+}
+
+func TestSnapshotStoreReapWhileReading(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	ss, err := NewSnapshotStore(store, 1)
+	assertNoError(t, err)
+
+	id := createSnapshot(t, ss, 10, 1, make([]byte, 3*snapshotChunkSize))
+	_, r, err := ss.Open(id)
+	assertNoError(t, err)
+	defer r.Close()
+
+	_, err = io.ReadFull(r, make([]byte, snapshotChunkSize))
+	assertNoError(t, err)
+
+	// reaps the snapshot being read
+	createSnapshot(t, ss, 20, 1, []byte("snap2"))
+
+	_, err = io.ReadAll(r)
+	assert(t, err != nil, "want error reading a reaped snapshot")
+}
@@ -1,19 +1,52 @@
 package raftsqlite
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/hashicorp/raft"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 var (
 	// An error indicating a given key does not exist
 	ErrKeyNotFound = errors.New("not found")
+
+	// An error indicating a write was attempted on a read-only store
+	ErrReadOnly = errors.New("store is read-only")
+
+	// An error indicating the store was used after being closed
+	ErrClosed = errors.New("store is closed")
+
+	// An error indicating a log or value is over the configured maximum
+	// size
+	ErrValueTooLarge = errors.New("value too large")
+)
+
+const (
+	// retryBaseBackoff is the wait before the first retry of a busy
+	// transaction. It doubles on each subsequent attempt.
+	retryBaseBackoff = 10 * time.Millisecond
+
+	// retryMaxBackoff caps the wait between retries of a busy transaction.
+	retryMaxBackoff = time.Second
+
+	// maxInClauseKeys bounds the number of keys queried at once, to stay
+	// well within the sqlite limit of bound parameters per statement.
+	maxInClauseKeys = 500
+
+	// maxInsertLogRows bounds the number of logs inserted by a single
+	// statement, each taking 7 parameters, to stay within the limit of
+	// 999 bound parameters of older sqlite versions.
+	maxInsertLogRows = 142
 )
 
 // SqliteStore provides a raft.LogStore to store and retrieve Raft log
@@ -23,73 +56,521 @@ type SqliteStore struct {
 	// db is the underlying handle to the sql.DB
 	db *sql.DB
 
+	// readDB is the handle the reads go through, either a separate pool
+	// of read-only connections or db itself.
+	readDB *sql.DB
+
 	// The path to the database file. This may contain :memory: if the
 	// database is in-memory.
 	path string
+
+	// connDSN is path without the parameters setting the pragmas managed
+	// by the store, the connections are opened with it.
+	connDSN string
+
+	// opts holds the settings the store was created with.
+	opts options
+
+	// ownsDB reports whether db was opened by the store, in which case
+	// it is closed along with the store.
+	ownsDB bool
+
+	// inMemory reports whether the database is in-memory. Its
+	// transactions are serialized by writeMu, and keepAlive holds a
+	// connection outside of the pool so the database is not dropped
+	// while the store is open.
+	inMemory  bool
+	writeMu   sync.Mutex
+	keepAlive *sql.DB
+
+	// connMu guards swapping db and the statements when reconnecting,
+	// connGen counts the reconnections and closed is set once the store
+	// is closed, after which it never reconnects.
+	connMu  sync.RWMutex
+	connGen uint64
+	closed  bool
+
+	// txCount counts the committed transactions and txRetries the
+	// attempts retried after a busy error.
+	txCount   atomic.Uint64
+	txRetries atomic.Uint64
+
+	// logCache holds the recently read logs, nil if disabled.
+	logCache *logCache
+
+	// indexCache holds the first and last log indexes, nil if disabled.
+	indexCache *indexCache
+
+	// Prepared statements for the hot path queries.
+	stmtGetLog    *sql.Stmt
+	stmtInsertLog *sql.Stmt
+	stmtGetKV     *sql.Stmt
+	stmtSetKV     *sql.Stmt
+
+	// commits queues the StoreLogs calls for the group commit writer.
+	// commitMu guards closing it, after which commitsClosed is set.
+	commits       chan *commitRequest
+	commitMu      sync.RWMutex
+	commitsClosed bool
+
+	// stop is closed to signal the background goroutines to exit, wg
+	// tracks them.
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
 }
 
 // NewStore takes a file path and returns a connected Raft backend.
 func NewStore(path string) (*SqliteStore, error) {
-	db, err := sql.Open("sqlite3", path)
+	return NewStoreWithOptions(path)
+}
+
+// NewStoreWithOptions takes a file path and a set of options and returns
+// a connected Raft backend.
+//
+// The path may be a URI whose parameters are passed on to the driver,
+// such as _busy_timeout or _foreign_keys, except for those setting the
+// journal_mode and synchronous pragmas. The store sets these from its
+// options, see WithJournalMode and WithSynchronous, so the conflicting
+// parameters are dropped with a warning.
+func NewStoreWithOptions(path string, opts ...Option) (*SqliteStore, error) {
+	return NewStoreContext(context.Background(), path, opts...)
+}
+
+// NewStoreContext is like NewStoreWithOptions, but opening the database
+// and bringing its schema up to date is aborted if ctx is done first,
+// such as while waiting for a lock held by another process. ctx is not
+// used after the store is returned.
+func NewStoreContext(ctx context.Context, path string, opts ...Option) (*SqliteStore, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	// A read-only database must already exist, there is no point in
+	// creating its directory.
+	file := dsnFilePath(path)
+	created := false
+	if file != "" && !o.readOnly {
+		if err := os.MkdirAll(filepath.Dir(file), o.dirPerm); err != nil {
+			return nil, fmt.Errorf("creating database directory: %w", err)
+		}
+		_, err := os.Stat(file)
+		created = errors.Is(err, fs.ErrNotExist)
+	}
+
+	connDSN, dropped := stripManagedParams(path)
+	for _, param := range dropped {
+		o.logger.Warn("ignoring DSN parameter of a pragma managed by the store", "param", param)
+	}
+
+	store := &SqliteStore{
+		path:       path,
+		connDSN:    connDSN,
+		opts:       o,
+		ownsDB:     true,
+		inMemory:   isInMemoryDSN(path),
+		logCache:   newLogCache(o.logCacheSize),
+		indexCache: newIndexCache(o.indexCache),
+	}
+
+	db, err := store.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	store.db = db
+
+	if store.inMemory {
+		// A shared in-memory database is dropped as soon as its last
+		// connection closes, so pin one for the lifetime of the store,
+		// regardless of the pool settings.
+		keepAlive := openDB(store.dsn())
+		keepAlive.SetMaxOpenConns(1)
+		keepAlive.SetMaxIdleConns(1)
+		if err := keepAlive.PingContext(ctx); err != nil {
+			keepAlive.Close()
+			db.Close()
+			return nil, err
+		}
+		store.keepAlive = keepAlive
+	}
+
+	err = store.initialize(ctx)
 	if err != nil {
+		store.closeDB()
+		return nil, err
+	}
+
+	if created {
+		if err := chmodDB(file, o.fileMode); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+
+	o.logger.Debug("opened store", "path", path)
+	return store, nil
+}
+
+// dsn returns the DSN the store database is opened with.
+func (s *SqliteStore) dsn() string {
+	if s.opts.readOnly {
+		return readOnlyDSN(s.connDSN)
+	}
+	return s.connDSN
+}
+
+// connect opens a handle to the store database, with the configured pool
+// settings and pragmas.
+func (s *SqliteStore) connect(ctx context.Context) (*sql.DB, error) {
+	// Pragmas are per-connection and cannot be changed from within a
+	// transaction, so the connector applies them to every connection it
+	// opens, before the pool hands it out. This guarantees that every
+	// operation runs on a connection with these settings, including once
+	// a connection is replaced after WithConnMaxLifetime or when the pool
+	// grows past one connection.
+	db := s.openStoreDB(s.dsn(), s.opts.pragmas()...)
+	db.SetMaxOpenConns(s.opts.maxOpenConns)
+	db.SetMaxIdleConns(s.opts.maxIdleConns)
+	db.SetConnMaxLifetime(s.opts.connMaxLifetime)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, err
+	}
+	return db, nil
+}
+
+// NewStoreFromDB returns a Raft backend on top of an existing database
+// handle. Only the store tables are created, the pragmas and pool
+// settings are left to the caller, as are the pragma related options.
+// Closing the store does not close db.
+func NewStoreFromDB(db *sql.DB, opts ...Option) (*SqliteStore, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
 
+	if o.archive != "" {
+		return nil, errors.New("archive is not supported on an existing database handle")
 	}
 
 	store := &SqliteStore{
-		db:   db,
-		path: path,
+		db:         db,
+		readDB:     db,
+		opts:       o,
+		logCache:   newLogCache(o.logCacheSize),
+		indexCache: newIndexCache(o.indexCache),
+	}
+	if err := store.initialize(context.Background()); err != nil {
+		return nil, err
 	}
+	return store, nil
+}
 
-	// database initialization
-	err = store.transaction(func(tx *sql.Tx) error {
-		// Synchronous=full is the default, but normal when paired with
-		// WAL mode guarantees complete database integrity. Normal also
-		// issues less fsyncs.
-		_, err := db.Exec("PRAGMA synchronous=normal")
-		if err != nil {
-			return err
+// NewNamespacedStore returns a Raft backend on top of an existing
+// database handle, storing its data in tables prefixed by namespace.
+// This allows several raft groups to share a single database file and
+// connection pool, each one only seeing its own logs and keys. The
+// namespace may only contain letters, digits and underscores.
+//
+// As with NewStoreFromDB, closing the store does not close db.
+func NewNamespacedStore(db *sql.DB, namespace string) (*SqliteStore, error) {
+	store, err := NewStoreFromDB(db, WithLogsTable(namespace+"_logs"), WithKVTable(namespace+"_kv"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespace %q: %w", namespace, err)
+	}
+	return store, nil
+}
+
+// initialize brings the schema up to date and prepares the statements.
+func (s *SqliteStore) initialize(ctx context.Context) error {
+	if err := s.checkIntegrity(ctx); err != nil {
+		return err
+	}
+	if err := s.migrate(ctx); err != nil {
+		return err
+	}
+	if err := s.createArchive(ctx); err != nil {
+		return err
+	}
+	if err := s.checkEncoding(ctx); err != nil {
+		return err
+	}
+	if err := s.openReadPool(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareStatements(ctx); err != nil {
+		s.closeStatements()
+		return err
+	}
+
+	s.startBackground()
+	return nil
+}
+
+// startBackground starts the background goroutines enabled by the
+// options.
+func (s *SqliteStore) startBackground() {
+	s.stop = make(chan struct{})
+	if s.opts.ttlSweepInterval > 0 && !s.opts.readOnly {
+		s.runEvery(s.opts.ttlSweepInterval, func() {
+			if _, err := s.deleteExpired(); err != nil {
+				s.opts.logger.Error("failed to delete expired keys", "error", err)
+			}
+		})
+	}
+	if s.opts.groupCommitBatch > 0 && !s.opts.readOnly {
+		s.startGroupCommit()
+	}
+	if s.opts.autoCheckpointInterval > 0 && !s.opts.readOnly {
+		s.runEvery(s.opts.autoCheckpointInterval, func() {
+			if err := s.checkpoint(s.opts.autoCheckpointMode); err != nil {
+				s.opts.logger.Error("failed to checkpoint wal", "error", err)
+			}
+		})
+	}
+}
+
+// runEvery calls fn on every tick of interval in a background goroutine
+// until the store is closed.
+func (s *SqliteStore) runEvery(interval time.Duration, fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				fn()
+			}
 		}
+	}()
+}
 
-		_, err = db.Exec("PRAGMA journal_mode=WAL")
-		if err != nil {
-			return err
+// stopBackground stops the background goroutines and waits for them to
+// exit. It is safe to call more than once.
+func (s *SqliteStore) stopBackground() {
+	s.stopOnce.Do(func() {
+		if s.stop != nil {
+			close(s.stop)
 		}
+	})
+	s.wg.Wait()
+}
 
-		_, err = db.Exec("CREATE TABLE IF NOT EXISTS logs (idx INTEGER PRIMARY KEY, data BLOB)")
+// prepareStatements prepares the hot path queries.
+func (s *SqliteStore) prepareStatements(ctx context.Context) error {
+	stmts := []struct {
+		stmt  **sql.Stmt
+		db    *sql.DB
+		query string
+	}{
+		{&s.stmtGetLog, s.readDB, s.getLogQuery()},
+		{&s.stmtInsertLog, s.db, fmt.Sprintf("%s INTO %s (idx, term, data, crc, appended_at, blob_file, payload_hash) VALUES (?, ?, ?, ?, ?, ?, ?)", s.insertLogVerb(), s.opts.logsTable)},
+		{&s.stmtGetKV, s.readDB, s.getKVQuery()},
+		{&s.stmtSetKV, s.db, fmt.Sprintf("INSERT OR REPLACE INTO %s (key, value) VALUES (?, ?)", s.opts.kvTable)},
+	}
+	// the statements are only swapped in once all of them are prepared,
+	// so a failure leaves the current ones in place
+	prepared := make([]*sql.Stmt, 0, len(stmts))
+	for _, st := range stmts {
+		stmt, err := st.db.PrepareContext(ctx, st.query)
 		if err != nil {
+			closeStmts(prepared)
 			return err
 		}
+		prepared = append(prepared, stmt)
+	}
+	for i, st := range stmts {
+		*st.stmt = prepared[i]
+	}
+	return nil
+}
 
-		_, err = db.Exec("CREATE TABLE IF NOT EXISTS kv (key TEXT PRIMARY KEY, value BLOB)")
-		if err != nil {
-			return err
+// getLogQuery returns the query reading the logColumns columns of a log.
+func (s *SqliteStore) getLogQuery() string {
+	return fmt.Sprintf("SELECT %s FROM %s WHERE idx = ?", s.logColumns(), s.opts.logsTable)
+}
+
+// getKVQuery returns the query reading a key that has not expired.
+func (s *SqliteStore) getKVQuery() string {
+	return fmt.Sprintf("SELECT value FROM %s WHERE key = ? AND (expires_at IS NULL OR expires_at > ?)", s.opts.kvTable)
+}
+
+// closeStatements releases the prepared statements.
+func (s *SqliteStore) closeStatements() error {
+	return closeStmts(s.statements())
+}
+
+// statements returns the prepared statements.
+func (s *SqliteStore) statements() []*sql.Stmt {
+	return []*sql.Stmt{s.stmtGetLog, s.stmtInsertLog, s.stmtGetKV, s.stmtSetKV}
+}
+
+// closeStmts closes the given statements, skipping the nil ones.
+func closeStmts(stmts []*sql.Stmt) error {
+	var errs []error
+	for _, stmt := range stmts {
+		if stmt == nil {
+			continue
 		}
-		return nil
+		if err := stmt.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readOnlyDSN returns dsn as a URI opening the database in read-only
+// mode.
+func readOnlyDSN(dsn string) string {
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&mode=ro"
+	}
+	return dsn + "?mode=ro"
+}
+
+// chmodDB changes the mode of the database file at path, along with its
+// -wal and -shm files if they exist.
+func chmodDB(path string, mode os.FileMode) error {
+	for _, name := range []string{path, path + "-wal", path + "-shm"} {
+		err := os.Chmod(name, mode)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("setting database file mode: %w", err)
+		}
+	}
+	return nil
+}
+
+// dsnFilePath returns the path of the database file dsn refers to, or an
+// empty string if it has none, such as an in-memory or temporary
+// database.
+func dsnFilePath(dsn string) string {
+	if isInMemoryDSN(dsn) {
+		return ""
+	}
+	if strings.HasPrefix(dsn, "file:") {
+		dsn = strings.TrimPrefix(dsn, "file:")
+		if pos := strings.IndexAny(dsn, "?#"); pos >= 0 {
+			dsn = dsn[:pos]
+		}
+		// file:///path has an empty authority, any other host is left
+		// to the driver to reject
+		if strings.HasPrefix(dsn, "//") {
+			if !strings.HasPrefix(dsn, "///") {
+				return ""
+			}
+			dsn = dsn[2:]
+		}
+	}
+	return dsn
+}
+
+// isInMemoryDSN reports whether dsn refers to an in-memory database.
+func isInMemoryDSN(dsn string) bool {
+	return strings.Contains(dsn, ":memory:") || strings.Contains(dsn, "mode=memory")
+}
+
+// RunInTransaction runs fn within a transaction on the store database,
+// committing it if fn returns nil and rolling it back otherwise. This lets
+// FSM implementations update their own tables atomically with each other.
+// fn must only touch the caller's own tables, as writing to the store
+// tables behind its back can break its invariants, and must not call
+// other store methods, which would deadlock waiting for the connection
+// held by the transaction. fn may be run more than once when the
+// database is busy.
+func (s *SqliteStore) RunInTransaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return s.transactionCtx(ctx, fn)
+}
+
+func (s *SqliteStore) transaction(f func(*sql.Tx) error) error {
+	return s.transactionCtx(context.Background(), f)
+}
+
+// transactionCtx runs f within a transaction, retrying it with an
+// exponential backoff while sqlite reports the database as busy or locked.
+// The returned error is classified by wrapError.
+func (s *SqliteStore) transactionCtx(ctx context.Context, f func(*sql.Tx) error) error {
+	s.indexCache.beginWrite()
+	defer s.indexCache.endWrite()
+
+	err := s.withReconnect(func() error {
+		return s.retryTransaction(ctx, f)
 	})
-	if err != nil {
-		return nil, err
+	return wrapError(err)
+}
+
+func (s *SqliteStore) retryTransaction(ctx context.Context, f func(*sql.Tx) error) error {
+	if s.inMemory {
+		// concurrent writers of a shared in-memory database don't wait
+		// for each other the way they do on a file
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
 	}
 
-	return store, nil
+	backoff := retryBaseBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.runTransaction(ctx, f)
+		if err == nil || !isBusyError(err) || attempt >= s.opts.maxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		s.txRetries.Add(1)
+
+		backoff *= 2
+		if backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
 }
 
-func (s *SqliteStore) transaction(f func(*sql.Tx) error) (err error) {
-	tx, err := s.db.Begin()
+func (s *SqliteStore) runTransaction(ctx context.Context, f func(*sql.Tx) error) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
 	err = f(tx)
 	if err == nil {
-		return tx.Commit()
+		err = tx.Commit()
+		if err != nil && ctx.Err() != nil {
+			// database/sql rolls back the transaction once the context
+			// is done, report why instead of sql.ErrTxDone
+			return ctx.Err()
+		}
+		if err == nil {
+			s.txCount.Add(1)
+		}
+		return err
 	}
 
 	txerr := tx.Rollback()
 	if txerr == nil {
+		s.opts.logger.Error("transaction rolled back", "error", err)
 		return err
 	}
-	return errors.Join(err, fmt.Errorf("rollback failed: %w", txerr))
+	err = errors.Join(err, fmt.Errorf("rollback failed: %w", txerr))
+	s.opts.logger.Error("transaction rollback failed", "error", err)
+	return err
 }
 
 func (s *SqliteStore) deleteDB() error {
@@ -98,106 +579,1060 @@ func (s *SqliteStore) deleteDB() error {
 }
 
 // Close is used to gracefully close the DB connection.
+// The underlying database is only closed if it was opened by the store.
 func (s *SqliteStore) Close() error {
-	return s.db.Close()
-}
+	s.stopGroupCommit()
+	s.stopBackground()
 
-// FirstIndex returns the first known index from the Raft log.
-func (s *SqliteStore) FirstIndex() (uint64, error) {
-	var idx uint64
-	err := s.db.QueryRow("SELECT idx FROM logs ORDER BY idx ASC LIMIT 1").Scan(&idx)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return 0, nil
-		}
-		return 0, err
+	s.connMu.Lock()
+	s.closed = true
+	s.connMu.Unlock()
+
+	err := s.closeStatements()
+	if !s.ownsDB {
+		return err
 	}
-	return idx, nil
-}
 
-// LastIndex returns the last known index from the Raft log.
-func (s *SqliteStore) LastIndex() (uint64, error) {
-	var idx uint64
-	err := s.db.QueryRow("SELECT idx FROM logs ORDER BY idx DESC LIMIT 1").Scan(&idx)
-	if err != nil {
-		return 0, err
+	if s.opts.checkpointOnClose && !s.opts.readOnly && !s.inMemory {
+		// a failed checkpoint leaves the WAL around but loses nothing
+		if err := s.checkpoint("truncate"); err != nil {
+			s.opts.logger.Warn("checkpoint on close failed", "error", err)
+		}
 	}
-	return idx, nil
+	return errors.Join(err, s.closeDB())
 }
 
-// GetLog is used to retrieve a log at a given index.
-func (s *SqliteStore) GetLog(idx uint64, log *raft.Log) error {
-	var data []byte
-	err := s.db.QueryRow("SELECT data FROM logs WHERE idx = ?", idx).Scan(&data)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return raft.ErrLogNotFound
-		}
-		return err
+// closeDB closes the database along with the read pool and the
+// in-memory keep-alive connection, if any.
+func (s *SqliteStore) closeDB() error {
+	var err error
+	if s.readDB != nil && s.readDB != s.db {
+		// the read-only connections go first, leaving the last one to
+		// close able to clean up the WAL
+		err = s.readDB.Close()
+	}
+	err = errors.Join(err, s.db.Close())
+	if s.keepAlive != nil {
+		err = errors.Join(err, s.keepAlive.Close())
 	}
+	return err
+}
 
-	return decodeMsgPack(data, log)
+// DSN returns the path or URI the store was opened with, as given to
+// NewStore. It is empty for stores created from an existing *sql.DB.
+func (s *SqliteStore) DSN() string {
+	return s.path
 }
 
-// StoreLog is used to store a single raft log
-func (s *SqliteStore) StoreLog(log *raft.Log) error {
-	return s.StoreLogs([]*raft.Log{log})
+// Path returns the path of the database file, without the URI scheme and
+// parameters of the DSN. It is empty for in-memory stores and for stores
+// created from an existing *sql.DB.
+func (s *SqliteStore) Path() string {
+	return dsnFilePath(s.path)
 }
 
-// StoreLogs is used to store a set of raft logs
-func (s *SqliteStore) StoreLogs(logs []*raft.Log) error {
-	return s.transaction(func(tx *sql.Tx) error {
-		for _, log := range logs {
-			key := log.Index
-			val, err := encodeMsgPack(log)
-			if err != nil {
-				return err
-			}
+// InMemory reports whether the store database is in-memory. It is false
+// for stores created from an existing *sql.DB, whose DSN is unknown.
+func (s *SqliteStore) InMemory() bool {
+	return s.inMemory
+}
 
-			_, err = tx.Exec("INSERT INTO logs (idx, data) VALUES (?, ?)", key, val.Bytes())
-		}
-		return nil
+// Ping verifies the connection to the database is still alive.
+func (s *SqliteStore) Ping(ctx context.Context) error {
+	return s.withReconnect(func() error {
+		return s.db.PingContext(ctx)
 	})
 }
 
-// DeleteRange is used to delete logs within a given range inclusively.
-func (s *SqliteStore) DeleteRange(min, max uint64) error {
-	return s.transaction(func(tx *sql.Tx) error {
-		_, err := tx.Exec("DELETE FROM logs WHERE idx >= ? AND idx <= ?", min, max)
+// Healthy reports whether the database can be reached. It is a shortcut
+// for Ping with a one second timeout.
+func (s *SqliteStore) Healthy() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return s.Ping(ctx) == nil
+}
+
+// Vacuum rebuilds the database file, reclaiming the space left behind by
+// deleted logs. It needs exclusive access to the database, so writes are
+// blocked until it finishes.
+func (s *SqliteStore) Vacuum() error {
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+
+	if s.inMemory {
+		// VACUUM bypasses transactionCtx, which serializes the writers
+		// of in-memory databases
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
+	}
+
+	s.opts.logger.Debug("vacuuming database")
+	// VACUUM cannot run from within a transaction
+	return s.withReconnect(func() error {
+		_, err := s.db.Exec("VACUUM")
 		return err
 	})
 }
 
-// Set is used to set a key/value set outside of the raft log
-func (s *SqliteStore) Set(k, v []byte) error {
+// IncrementalVacuum returns up to pages unused pages of the database file
+// to the file system, or all of them if pages is 0 or less. It only
+// frees pages in the "incremental" auto vacuum mode, see WithAutoVacuum.
+// Unlike Vacuum, it doesn't rewrite the database, so it is cheap enough
+// to reclaim space gradually, such as after each compaction.
+func (s *SqliteStore) IncrementalVacuum(pages int) error {
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+
+	s.opts.logger.Debug("incrementally vacuuming database", "pages", pages)
 	return s.transaction(func(tx *sql.Tx) error {
-		_, err := tx.Exec("INSERT OR REPLACE INTO kv (key, value) VALUES (?, ?)", k, v)
-		return err
+		// each step frees a single page, Exec would only take the first
+		rows, err := tx.Query(fmt.Sprintf("PRAGMA incremental_vacuum(%d)", pages))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+		}
+		return rows.Err()
 	})
 }
 
-// Get is used to retrieve a value from the k/v store by key
-func (s *SqliteStore) Get(k []byte) ([]byte, error) {
-	var value []byte
-	err := s.db.QueryRow("SELECT value FROM kv WHERE key = ?", k).Scan(&value)
+// Shrink returns the space left behind by deleted logs to the file
+// system, such as after a large compaction. It truncates the WAL, vacuums
+// the database and truncates the WAL again, as under WAL the vacuumed
+// pages only reach the database file on a checkpoint. Like Vacuum, it
+// blocks the writers until it finishes. The file sizes before and after
+// are logged.
+func (s *SqliteStore) Shrink() error {
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+
+	file := dsnFilePath(s.path)
+	before, err := dbFilesSize(file)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrKeyNotFound
+		return err
+	}
+
+	if err := s.checkpoint("truncate"); err != nil {
+		return err
+	}
+	if err := s.Vacuum(); err != nil {
+		return err
+	}
+	if err := s.checkpoint("truncate"); err != nil {
+		return err
+	}
+
+	after, err := dbFilesSize(file)
+	if err != nil {
+		return err
+	}
+	s.opts.logger.Info("shrunk database", "path", file, "before", before, "after", after)
+	return nil
+}
+
+// dbFilesSize returns the combined size in bytes of the database file at
+// path and its WAL. It is 0 if path is empty, as for in-memory stores.
+func dbFilesSize(path string) (int64, error) {
+	if path == "" {
+		return 0, nil
+	}
+
+	var size int64
+	for _, name := range []string{path, path + "-wal"} {
+		n, err := fileSizeIfExists(name)
+		if err != nil {
+			return 0, err
 		}
-		return nil, err
+		size += n
+	}
+	return size, nil
+}
+
+// fileSizeIfExists returns the size in bytes of the file at path, or 0 if
+// it does not exist.
+func fileSizeIfExists(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// VacuumInto writes a compacted copy of the database to path, leaving
+// the current database untouched. The file at path must not exist. The
+// copy would miss the data of the logs stored in the blob directory, so
+// it fails for stores set with WithExternalBlobDir.
+func (s *SqliteStore) VacuumInto(path string) error {
+	if s.opts.blobDir != "" {
+		return errBlobDirCopy
 	}
 
-	return value, nil
+	s.opts.logger.Debug("vacuuming database", "into", path)
+	// VACUUM cannot run from within a transaction
+	return s.withReconnect(func() error {
+		_, err := s.db.Exec("VACUUM INTO ?", path)
+		return err
+	})
 }
 
-// SetUint64 is like Set, but handles uint64 values
-func (s *SqliteStore) SetUint64(key []byte, val uint64) error {
-	return s.Set(key, uint64ToBytes(val))
+// Backup writes a consistent snapshot of the database to destPath while
+// the store remains usable. Writes committed after the backup starts are
+// not included. The resulting file can be opened with NewStore. The file
+// at destPath must not exist. Like VacuumInto, it fails for stores set
+// with WithExternalBlobDir.
+func (s *SqliteStore) Backup(destPath string) error {
+	// VACUUM INTO reads the database within a single read transaction,
+	// so the copy is consistent without blocking writers under WAL.
+	return s.VacuumInto(destPath)
 }
 
-// GetUint64 is like Get, but handles uint64 values
-func (s *SqliteStore) GetUint64(key []byte) (uint64, error) {
-	val, err := s.Get(key)
+// FirstIndex returns the first known index from the Raft log.
+func (s *SqliteStore) FirstIndex() (uint64, error) {
+	return s.FirstIndexCtx(context.Background())
+}
+
+// FirstIndexCtx is like FirstIndex, but honors the given context.
+func (s *SqliteStore) FirstIndexCtx(ctx context.Context) (first uint64, err error) {
+	err = s.withReconnect(func() error {
+		first, _, err = s.indexBounds(ctx)
+		return err
+	})
+	return first, err
+}
+
+// LastIndex returns the last known index from the Raft log.
+func (s *SqliteStore) LastIndex() (uint64, error) {
+	return s.LastIndexCtx(context.Background())
+}
+
+// LastIndexCtx is like LastIndex, but honors the given context.
+func (s *SqliteStore) LastIndexCtx(ctx context.Context) (last uint64, err error) {
+	err = s.withReconnect(func() error {
+		_, last, err = s.indexBounds(ctx)
+		return err
+	})
+	return last, err
+}
+
+// CountLogs returns the number of logs stored.
+func (s *SqliteStore) CountLogs() (uint64, error) {
+	var count uint64
+	err := s.withReconnect(func() error {
+		return s.readDB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", s.opts.logsTable)).Scan(&count)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// CountLogsRange returns the number of logs stored between min and max
+// inclusively.
+func (s *SqliteStore) CountLogsRange(min, max uint64) (uint64, error) {
+	var count uint64
+	err := s.withReconnect(func() error {
+		return s.readDB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE idx >= ? AND idx <= ?", s.opts.logsTable), min, max).Scan(&count)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// FirstIndexAfter returns the lowest index stored after idx, or 0 if
+// there is none. Along with LastIndexBefore, it walks over the gaps of a
+// log.
+func (s *SqliteStore) FirstIndexAfter(idx uint64) (uint64, error) {
+	var next uint64
+	err := s.withReconnect(func() error {
+		return s.readDB.QueryRow(fmt.Sprintf("SELECT IFNULL(MIN(idx), 0) FROM %s WHERE idx > ?", s.opts.logsTable), idx).Scan(&next)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// LastIndexBefore returns the highest index stored before idx, or 0 if
+// there is none.
+func (s *SqliteStore) LastIndexBefore(idx uint64) (uint64, error) {
+	var prev uint64
+	err := s.withReconnect(func() error {
+		return s.readDB.QueryRow(fmt.Sprintf("SELECT IFNULL(MAX(idx), 0) FROM %s WHERE idx < ?", s.opts.logsTable), idx).Scan(&prev)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return prev, nil
+}
+
+// VerifyContiguous reports the ranges of missing indexes between the
+// first and last stored logs, each one as an inclusive [first, last]
+// pair. A contiguous log has no gaps.
+func (s *SqliteStore) VerifyContiguous() (gaps [][2]uint64, err error) {
+	err = s.withReconnect(func() error {
+		gaps = nil
+		rows, err := s.readDB.Query(fmt.Sprintf("SELECT idx + 1, next - 1 FROM (SELECT idx, LEAD(idx) OVER (ORDER BY idx) AS next FROM %s) "+
+			"WHERE next > idx + 1 ORDER BY idx", s.opts.logsTable))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var gap [2]uint64
+			if err := rows.Scan(&gap[0], &gap[1]); err != nil {
+				return err
+			}
+			gaps = append(gaps, gap)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gaps, nil
+}
+
+// GetLog is used to retrieve a log at a given index.
+func (s *SqliteStore) GetLog(idx uint64, log *raft.Log) error {
+	return s.GetLogCtx(context.Background(), idx, log)
+}
+
+// GetLogCtx is like GetLog, but honors the given context.
+func (s *SqliteStore) GetLogCtx(ctx context.Context, idx uint64, log *raft.Log) error {
+	if cached, ok := s.logCache.get(idx); ok {
+		*log = *cached
+		return nil
+	}
+	gen := s.logCache.generation()
+
+	var data, shared []byte
+	var crc sql.NullInt64
+	err := s.withReconnect(func() error {
+		return s.stmtGetLog.QueryRowContext(ctx, idx).Scan(&data, &crc, &shared)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			if s.opts.archive != "" {
+				return s.withReconnect(func() error {
+					return s.getArchivedLog(ctx, s.readDB, idx, log)
+				})
+			}
+			return raft.ErrLogNotFound
+		}
+		return err
+	}
+	if err := s.loadLog(idx, data, crc, shared, log); err != nil {
+		return err
+	}
+	s.logCache.add(gen, log)
+	return nil
+}
+
+// loadLog verifies and decodes into log the columns selected by
+// logColumns for the log at idx.
+func (s *SqliteStore) loadLog(idx uint64, data []byte, crc sql.NullInt64, shared []byte, log *raft.Log) error {
+	if err := s.verifyChecksum(idx, data, crc); err != nil {
+		return err
+	}
+	return s.decodeLog(data, shared, log)
+}
+
+// ExistsLog reports whether a log is stored at a given index, without
+// reading it.
+func (s *SqliteStore) ExistsLog(idx uint64) (bool, error) {
+	var exists int
+	err := s.withReconnect(func() error {
+		return s.readDB.QueryRow(fmt.Sprintf("SELECT 1 FROM %s WHERE idx = ? LIMIT 1", s.opts.logsTable), idx).Scan(&exists)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// GetLogTerm returns the term of the log at a given index, without
+// decoding the log.
+func (s *SqliteStore) GetLogTerm(idx uint64) (uint64, error) {
+	var term uint64
+	err := s.withReconnect(func() error {
+		return s.readDB.QueryRow(fmt.Sprintf("SELECT term FROM %s WHERE idx = ?", s.opts.logsTable), idx).Scan(&term)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, raft.ErrLogNotFound
+		}
+		return 0, err
+	}
+	return term, nil
+}
+
+// GetLogs is used to retrieve all the logs between min and max
+// inclusively. The logs are returned in ascending index order. If any
+// index within the range is missing, raft.ErrLogNotFound is returned.
+func (s *SqliteStore) GetLogs(min, max uint64) ([]*raft.Log, error) {
+	if min > max {
+		return nil, nil
+	}
+	if logs, ok := s.cachedLogs(min, max); ok {
+		return logs, nil
+	}
+	gen := s.logCache.generation()
+
+	logs, err := s.queryLogs(fmt.Sprintf("SELECT idx, %s FROM %s WHERE idx >= ? AND idx <= ? ORDER BY idx ASC", s.logColumns(), s.opts.logsTable), min, max)
+	if err != nil {
+		return nil, err
+	}
+
+	if uint64(len(logs)) != max-min+1 {
+		return nil, raft.ErrLogNotFound
+	}
+	s.logCache.add(gen, logs...)
+	return logs, nil
+}
+
+// cachedLogs returns the logs between min and max inclusively if they are
+// all cached.
+func (s *SqliteStore) cachedLogs(min, max uint64) ([]*raft.Log, bool) {
+	if s.logCache == nil || max-min >= uint64(s.opts.logCacheSize) {
+		return nil, false
+	}
+
+	logs := make([]*raft.Log, 0, max-min+1)
+	for idx := min; idx <= max; idx++ {
+		cached, ok := s.logCache.get(idx)
+		if !ok {
+			return nil, false
+		}
+		log := *cached
+		logs = append(logs, &log)
+	}
+	return logs, true
+}
+
+// GetLogRange is used to retrieve up to limit logs, starting at index
+// start, in ascending index order. Unlike GetLogs, missing indexes are
+// skipped rather than reported as an error, and an empty slice is
+// returned if no log matches.
+func (s *SqliteStore) GetLogRange(start uint64, limit int) ([]*raft.Log, error) {
+	if limit <= 0 {
+		return []*raft.Log{}, nil
+	}
+	return s.queryLogs(fmt.Sprintf("SELECT idx, %s FROM %s WHERE idx >= ? ORDER BY idx ASC LIMIT ?", s.logColumns(), s.opts.logsTable), start, limit)
+}
+
+// queryLogs runs a query selecting the idx and logColumns columns of the
+// logs table and decodes the resulting logs.
+func (s *SqliteStore) queryLogs(query string, args ...any) ([]*raft.Log, error) {
+	var logs []*raft.Log
+	err := s.withReconnect(func() error {
+		logs = []*raft.Log{}
+		rows, err := s.readDB.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		return s.forEachLog(rows, func(log *raft.Log) error {
+			logs = append(logs, log)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// IterateLogs calls fn for every stored log in ascending index order.
+// The logs are streamed from a single read transaction, so fn observes a
+// consistent view of the log without it being loaded in memory at once.
+// Iteration stops at the first error returned by fn, which is returned.
+// fn must not call other methods of the store, as the transaction may
+// hold the only connection available.
+func (s *SqliteStore) IterateLogs(ctx context.Context, fn func(*raft.Log) error) error {
+	return s.iterateLogs(ctx, fmt.Sprintf("SELECT idx, %s FROM %s ORDER BY idx ASC", s.logColumns(), s.opts.logsTable), fn)
+}
+
+// IterateLogsReverse is like IterateLogs, but calls fn in descending
+// index order, from the last log to the first one. It finds the most
+// recent logs matching a condition, such as the last configuration
+// change, without reading the older ones.
+func (s *SqliteStore) IterateLogsReverse(ctx context.Context, fn func(*raft.Log) error) error {
+	return s.iterateLogs(ctx, fmt.Sprintf("SELECT idx, %s FROM %s ORDER BY idx DESC", s.logColumns(), s.opts.logsTable), fn)
+}
+
+// iterateLogs runs a query selecting the idx and logColumns columns of
+// the logs table within a read transaction, calling fn for every log.
+func (s *SqliteStore) iterateLogs(ctx context.Context, query string, fn func(*raft.Log) error) error {
+	tx, err := s.beginRead(ctx)
+	if err != nil {
+		return err
+	}
+	// nothing to commit, the transaction only provides a stable view
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	return s.forEachLog(rows, fn)
+}
+
+// forEachLog decodes the logs from rows selecting the idx and logColumns
+// columns and calls fn for each of them, stopping at the first error.
+// rows is always closed.
+func (s *SqliteStore) forEachLog(rows *sql.Rows, fn func(*raft.Log) error) error {
+	defer rows.Close()
+
+	for rows.Next() {
+		var idx uint64
+		var data, shared []byte
+		var crc sql.NullInt64
+		if err := rows.Scan(&idx, &data, &crc, &shared); err != nil {
+			return err
+		}
+
+		log := new(raft.Log)
+		if err := s.loadLog(idx, data, crc, shared, log); err != nil {
+			return err
+		}
+		if err := fn(log); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// StoreLog is used to store a single raft log
+func (s *SqliteStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogCtx(context.Background(), log)
+}
+
+// StoreLogCtx is like StoreLog, but honors the given context.
+func (s *SqliteStore) StoreLogCtx(ctx context.Context, log *raft.Log) error {
+	return s.StoreLogsCtx(ctx, []*raft.Log{log})
+}
+
+// StoreLogs is used to store a set of raft logs
+func (s *SqliteStore) StoreLogs(logs []*raft.Log) error {
+	return s.StoreLogsCtx(context.Background(), logs)
+}
+
+// StoreLogsCtx is like StoreLogs, but honors the given context. If the
+// context is done before the transaction commits, no logs are stored.
+func (s *SqliteStore) StoreLogsCtx(ctx context.Context, logs []*raft.Log) error {
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+
+	// invalidated even on error, the commit may have gone through
+	defer s.logCache.removeLogs(logs)
+
+	if s.opts.groupCommitBatch > 0 {
+		return s.groupCommit(ctx, logs)
+	}
+
+	start := time.Now()
+	var replaced []string
+	err := s.transactionCtx(ctx, func(tx *sql.Tx) (err error) {
+		replaced, err = s.storeLogsTx(ctx, tx, logs)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.removeBlobs(replaced)
+
+	s.opts.observer.ObserveStoreLogs(len(logs), time.Since(start))
+	return nil
+}
+
+// StoreLogsTx stores logs within tx, a transaction the caller began on
+// the database of the store, such as the handle given to NewStoreFromDB.
+// This lets an application persist the logs along with the state derived
+// from them atomically. The caller owns tx and must commit or roll it
+// back, the logs are only visible to the store once tx commits. Unlike
+// StoreLogs, busy errors are not retried, and tx must not be held while
+// calling other methods of the store, which may need the same
+// connection. Every call, even a failing one, must be followed by a call
+// to EndStoreLogsTx with the same logs once tx is committed or rolled
+// back, or the caches set with WithLogCache and WithIndexCache may serve
+// the logs and indexes as they were before tx.
+func (s *SqliteStore) StoreLogsTx(tx *sql.Tx, logs []*raft.Log) error {
+	// the indexes are not cached until EndStoreLogsTx, the logs are
+	// invalidated again there, as reads until then see them as they were
+	s.indexCache.beginWrite()
+	s.logCache.removeLogs(logs)
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+	// the commit is not known here, so the files of the logs replaced
+	// with WithUpsertLogs are left behind
+	_, err := s.storeLogsTx(context.Background(), tx, logs)
+	return wrapError(err)
+}
+
+// EndStoreLogsTx invalidates the caches once the transaction given to
+// StoreLogsTx along with logs is committed or rolled back. It must be
+// called exactly once for every call to StoreLogsTx.
+func (s *SqliteStore) EndStoreLogsTx(logs []*raft.Log) {
+	s.logCache.removeLogs(logs)
+	s.indexCache.endWrite()
+}
+
+// storeLogsTx stores logs within tx, keeping the bounds up to date. It
+// returns the files of the blob directory of the logs replaced with
+// WithUpsertLogs, to remove once tx commits.
+func (s *SqliteStore) storeLogsTx(ctx context.Context, tx *sql.Tx, logs []*raft.Log) ([]string, error) {
+	if s.opts.strictMonotonic {
+		if err := s.checkMonotonic(ctx, tx, logs); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(logs) == 0 {
+		return nil, nil
+	}
+	var replaced []string
+	if s.opts.upsertLogs {
+		for _, log := range logs {
+			blobs, err := s.releaseLogs(ctx, tx, "idx = ?", log.Index)
+			if err != nil {
+				return nil, err
+			}
+			replaced = append(replaced, blobs...)
+		}
+	}
+	if len(logs) == 1 {
+		if err := s.insertLogsLoop(ctx, tx, logs); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := s.insertLogs(ctx, tx, logs, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	first, last := logs[0].Index, logs[0].Index
+	for _, log := range logs[1:] {
+		first = min(first, log.Index)
+		last = max(last, log.Index)
+	}
+	if err := s.extendBounds(ctx, tx, first, last); err != nil {
+		return nil, err
+	}
+	return replaced, nil
+}
+
+// insertLogVerb returns the statement used to insert logs, replacing
+// existing ones if upserts are enabled.
+func (s *SqliteStore) insertLogVerb() string {
+	if s.opts.upsertLogs {
+		return "INSERT OR REPLACE"
+	}
+	return "INSERT"
+}
+
+// insertLogsLoop inserts logs within tx with one statement per log.
+func (s *SqliteStore) insertLogsLoop(ctx context.Context, tx *sql.Tx, logs []*raft.Log) (err error) {
+	var blobs []string
+	defer func() {
+		if err != nil {
+			s.removeBlobs(blobs)
+		}
+	}()
+
+	stmt := tx.StmtContext(ctx, s.stmtInsertLog)
+	appendedAt := s.opts.clock.Now().UnixNano()
+	for _, log := range logs {
+		enc, err := s.encodeLog(log)
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, enc.blobFile)
+
+		_, err = stmt.ExecContext(ctx, log.Index, log.Term, enc.data, s.checksum(enc.data), appendedAt, blobRef(enc.blobFile), payloadRef(enc.payloadHash))
+		if err != nil {
+			return err
+		}
+		if enc.payloadHash != nil {
+			if err := s.retainPayload(ctx, tx, enc.payloadHash, enc.payload); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// insertLogs inserts logs within tx with multi-row statements of up to
+// maxInsertLogRows logs each. storedAt holds the time each log was
+// stored at in unix nanoseconds, such as when restoring a dump. The logs
+// without one, or all of them if storedAt is nil, are stamped with the
+// current time.
+func (s *SqliteStore) insertLogs(ctx context.Context, tx *sql.Tx, logs []*raft.Log, storedAt []int64) (err error) {
+	var blobs []string
+	defer func() {
+		if err != nil {
+			s.removeBlobs(blobs)
+		}
+	}()
+
+	now := s.opts.clock.Now().UnixNano()
+	for len(logs) > 0 {
+		n := min(len(logs), maxInsertLogRows)
+
+		var query strings.Builder
+		fmt.Fprintf(&query, "%s INTO %s (idx, term, data, crc, appended_at, blob_file, payload_hash) VALUES ", s.insertLogVerb(), s.opts.logsTable)
+		args := make([]any, 0, 7*n)
+		var shared []*encodedLog
+		for i, log := range logs[:n] {
+			enc, err := s.encodeLog(log)
+			if err != nil {
+				return err
+			}
+			blobs = append(blobs, enc.blobFile)
+			if enc.payloadHash != nil {
+				shared = append(shared, enc)
+			}
+
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			appendedAt := now
+			if storedAt != nil && storedAt[i] != 0 {
+				appendedAt = storedAt[i]
+			}
+			query.WriteString("(?, ?, ?, ?, ?, ?, ?)")
+			args = append(args, log.Index, log.Term, enc.data, s.checksum(enc.data), appendedAt, blobRef(enc.blobFile), payloadRef(enc.payloadHash))
+		}
+
+		if _, err := tx.ExecContext(ctx, query.String(), args...); err != nil {
+			return err
+		}
+		for _, enc := range shared {
+			if err := s.retainPayload(ctx, tx, enc.payloadHash, enc.payload); err != nil {
+				return err
+			}
+		}
+		logs = logs[n:]
+		if storedAt != nil {
+			storedAt = storedAt[n:]
+		}
+	}
+	return nil
+}
+
+// DeleteRange is used to delete logs within a given range inclusively.
+func (s *SqliteStore) DeleteRange(min, max uint64) error {
+	return s.DeleteRangeCtx(context.Background(), min, max)
+}
+
+// DeleteRangeCtx is like DeleteRange, but honors the given context.
+func (s *SqliteStore) DeleteRangeCtx(ctx context.Context, min, max uint64) error {
+	_, err := s.deleteRange(ctx, min, max)
+	return err
+}
+
+// DeleteRangeN is like DeleteRange, but also returns the number of logs
+// deleted.
+func (s *SqliteStore) DeleteRangeN(min, max uint64) (int64, error) {
+	return s.deleteRange(context.Background(), min, max)
+}
+
+// DeleteRangeChunked is like DeleteRange, but deletes the logs in
+// separately committed batches of at most chunk indexes, so other writers
+// are not blocked for the whole deletion of a large range. The deletion
+// is not atomic, on error the logs deleted by the previous batches stay
+// deleted.
+func (s *SqliteStore) DeleteRangeChunked(min, max, chunk uint64) error {
+	return s.DeleteRangeChunkedWithProgress(min, max, chunk, nil)
+}
+
+// DeleteRangeChunkedWithProgress is like DeleteRangeChunked, calling
+// progress, if not nil, after every batch with the last index of the
+// batch and the total number of logs deleted so far.
+func (s *SqliteStore) DeleteRangeChunkedWithProgress(min, max, chunk uint64, progress func(through uint64, deleted int64)) error {
+	if chunk == 0 {
+		return errors.New("chunk size must be positive")
+	}
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+
+	// there is nothing to delete outside of the stored logs
+	var first, last uint64
+	err := s.withReconnect(func() (err error) {
+		first, last, err = s.bounds(context.Background(), s.db)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if first == 0 && last == 0 {
+		return nil
+	}
+	if min < first {
+		min = first
+	}
+	if max > last {
+		max = last
+	}
+
+	var total int64
+	for lo := min; lo <= max; {
+		hi := max
+		if max-lo >= chunk {
+			hi = lo + chunk - 1
+		}
+
+		deleted, err := s.deleteRange(context.Background(), lo, hi)
+		if err != nil {
+			return err
+		}
+		total += deleted
+		if progress != nil {
+			progress(hi, total)
+		}
+
+		if hi == max {
+			break
+		}
+		lo = hi + 1
+	}
+	return nil
+}
+
+func (s *SqliteStore) deleteRange(ctx context.Context, min, max uint64) (int64, error) {
+	if s.opts.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	start := time.Now()
+	var deleted int64
+	var blobs []string
+	defer s.logCache.removeRange(min, max)
+	err := s.transactionCtx(ctx, func(tx *sql.Tx) error {
+		var err error
+		blobs, err = s.releaseLogs(ctx, tx, "idx >= ? AND idx <= ?", min, max)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE idx >= ? AND idx <= ?", s.opts.logsTable), min, max)
+		if err != nil {
+			return err
+		}
+
+		deleted, err = res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return nil
+		}
+		return s.shrinkBounds(ctx, tx, min, max)
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.removeBlobs(blobs)
+
+	s.opts.observer.ObserveDeleteRange(deleted, time.Since(start))
+	return deleted, nil
+}
+
+// Set is used to set a key/value set outside of the raft log
+func (s *SqliteStore) Set(k, v []byte) error {
+	return s.SetCtx(context.Background(), k, v)
+}
+
+// SetCtx is like Set, but honors the given context. If the context is
+// done before the transaction commits, the key is not set.
+func (s *SqliteStore) SetCtx(ctx context.Context, k, v []byte) error {
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+
+	v, err := s.sealValue(v)
+	if err != nil {
+		return err
+	}
+
+	return s.transactionCtx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.StmtContext(ctx, s.stmtSetKV).ExecContext(ctx, k, v)
+		return err
+	})
+}
+
+// Get is used to retrieve a value from the k/v store by key
+func (s *SqliteStore) Get(k []byte) ([]byte, error) {
+	return s.GetCtx(context.Background(), k)
+}
+
+// GetCtx is like Get, but honors the given context.
+func (s *SqliteStore) GetCtx(ctx context.Context, k []byte) ([]byte, error) {
+	var value []byte
+	err := s.withReconnect(func() error {
+		return s.stmtGetKV.QueryRowContext(ctx, k, s.opts.clock.Now().UnixNano()).Scan(&value)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, err
+	}
+
+	return s.open(value)
+}
+
+// SetMany is used to set several key/value pairs within a single
+// transaction, either all of them are stored or none is.
+func (s *SqliteStore) SetMany(pairs map[string][]byte) error {
+	return s.SetManyCtx(context.Background(), pairs)
+}
+
+// SetManyCtx is like SetMany, but honors the given context.
+func (s *SqliteStore) SetManyCtx(ctx context.Context, pairs map[string][]byte) error {
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+
+	sealed := make(map[string][]byte, len(pairs))
+	for k, v := range pairs {
+		v, err := s.sealValue(v)
+		if err != nil {
+			return err
+		}
+		sealed[k] = v
+	}
+
+	return s.transactionCtx(ctx, func(tx *sql.Tx) error {
+		stmt := tx.StmtContext(ctx, s.stmtSetKV)
+		for k, v := range sealed {
+			// keys are stored as blobs, the same as Set
+			if _, err := stmt.ExecContext(ctx, []byte(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetMany is used to retrieve the values of several keys at once. Keys
+// that do not exist are absent from the returned map.
+func (s *SqliteStore) GetMany(keys [][]byte) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(keys))
+	for len(keys) > 0 {
+		n := min(len(keys), maxInClauseKeys)
+		batch := keys[:n]
+		keys = keys[n:]
+
+		args := make([]any, 0, len(batch)+1)
+		for _, k := range batch {
+			args = append(args, k)
+		}
+		args = append(args, s.opts.clock.Now().UnixNano())
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+
+		// a retried batch sets the same values again
+		err := s.withReconnect(func() error {
+			rows, err := s.readDB.Query(fmt.Sprintf("SELECT key, value FROM %s WHERE key IN (%s) AND (expires_at IS NULL OR expires_at > ?)", s.opts.kvTable, placeholders), args...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var k, v []byte
+				if err := rows.Scan(&k, &v); err != nil {
+					return err
+				}
+				if v, err = s.open(v); err != nil {
+					return err
+				}
+				values[string(k)] = v
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// Delete is used to remove a key from the k/v store. Deleting a key that
+// does not exist is not an error.
+func (s *SqliteStore) Delete(k []byte) error {
+	return s.DeleteCtx(context.Background(), k)
+}
+
+// DeleteCtx is like Delete, but honors the given context.
+func (s *SqliteStore) DeleteCtx(ctx context.Context, k []byte) error {
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+
+	return s.transactionCtx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE key = ?", s.opts.kvTable), k)
+		return err
+	})
+}
+
+// Keys returns all the keys in the k/v store, in ascending order.
+func (s *SqliteStore) Keys() ([][]byte, error) {
+	var keys [][]byte
+	err := s.withReconnect(func() error {
+		keys = nil
+		rows, err := s.readDB.Query(fmt.Sprintf("SELECT key FROM %s WHERE expires_at IS NULL OR expires_at > ? ORDER BY key ASC", s.opts.kvTable), s.opts.clock.Now().UnixNano())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var key []byte
+			if err := rows.Scan(&key); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// SetUint64 is like Set, but handles uint64 values
+func (s *SqliteStore) SetUint64(key []byte, val uint64) error {
+	return s.SetUint64Ctx(context.Background(), key, val)
+}
+
+// SetUint64Ctx is like SetUint64, but honors the given context.
+func (s *SqliteStore) SetUint64Ctx(ctx context.Context, key []byte, val uint64) error {
+	return s.SetCtx(ctx, key, uint64ToBytes(val))
+}
+
+// GetUint64 is like Get, but handles uint64 values
+func (s *SqliteStore) GetUint64(key []byte) (uint64, error) {
+	return s.GetUint64Ctx(context.Background(), key)
+}
+
+// GetUint64Ctx is like GetUint64, but honors the given context.
+func (s *SqliteStore) GetUint64Ctx(ctx context.Context, key []byte) (uint64, error) {
+	val, err := s.GetCtx(ctx, key)
 	if err != nil {
 		return 0, err
 	}
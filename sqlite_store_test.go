@@ -1,8 +1,14 @@
 package raftsqlite
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/raft"
 )
@@ -32,7 +38,7 @@ func createRaftLog(idx uint64, data string) *raft.Log {
 func assert(t testing.TB, b bool, msg string) {
 	t.Helper()
 	if !b {
-		t.Fatalf(msg)
+		t.Fatal(msg)
 	}
 }
 
@@ -43,6 +49,22 @@ func assertNoError(t testing.TB, err error) {
 	}
 }
 
+func TestCloseReleasesStatements(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer store.deleteDB()
+
+	err := store.StoreLog(createRaftLog(1, "log1"))
+	assertNoError(t, err)
+	err = store.Set([]byte("key1"), []byte("val1"))
+	assertNoError(t, err)
+
+	err = store.Close()
+	assertNoError(t, err)
+
+	err = store.GetLog(1, new(raft.Log))
+	assert(t, err != nil, "want error using a closed statement")
+}
+
 func TestImplementsStoreInterface(t *testing.T) {
 	var store interface{} = &SqliteStore{}
 	_, ok := store.(raft.StableStore)
@@ -99,6 +121,119 @@ func TestSqliteDBIsInitialized(t *testing.T) {
 	}
 	// 1 == NORMAL
 	assert(t, synchronous == "1", "synchronous should be normal")
+
+	// PRAGMA busy_timeout=5000
+	var timeout int
+	err = store.db.QueryRow("PRAGMA busy_timeout").Scan(&timeout)
+	assertNoError(t, err)
+	assert(t, timeout == 5000, "busy_timeout should be 5s")
+}
+
+func TestNewStoreCreatesParentDir(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/a/b/c/raft.db"
+	store, err := NewStore(path)
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	_, err = os.Stat(path)
+	assertNoError(t, err)
+
+	// URIs refer to their path component
+	store2, err := NewStore("file:" + dir + "/d/raft.db?_busy_timeout=100")
+	assertNoError(t, err)
+	store2.Close()
+	_, err = os.Stat(dir + "/d/raft.db")
+	assertNoError(t, err)
+}
+
+func TestNewStoreContext(t *testing.T) {
+	path := t.TempDir() + "/raft.db"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := NewStoreContext(ctx, path)
+	assert(t, errors.Is(err, context.Canceled), fmt.Sprintf("want context canceled err, got: %v", err))
+
+	store, err := NewStoreContext(context.Background(), path)
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	// hold the write lock so that opening waits on it
+	conn, err := store.db.Conn(context.Background())
+	assertNoError(t, err)
+	defer conn.Close()
+	_, err = conn.ExecContext(context.Background(), "BEGIN EXCLUSIVE")
+	assertNoError(t, err)
+	defer conn.ExecContext(context.Background(), "ROLLBACK")
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = NewStoreContext(ctx, path, WithLogsTable("other_logs"), WithKVTable("other_kv"), WithMaxRetries(10))
+	assert(t, errors.Is(err, context.DeadlineExceeded), fmt.Sprintf("want deadline exceeded err, got: %v", err))
+	assert(t, time.Since(start) < 5*time.Second, fmt.Sprintf("want the open to be aborted, took: %s", time.Since(start)))
+}
+
+func TestAccessors(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		dsn      string
+		path     string
+		inMemory bool
+	}{
+		{dir + "/raft.db", dir + "/raft.db", false},
+		{"file:" + dir + "/uri.db?_busy_timeout=100", dir + "/uri.db", false},
+		{"file::memory:?cache=shared", "", true},
+		{"file:accessors?mode=memory&cache=shared", "", true},
+	}
+	for _, c := range cases {
+		store, err := NewStore(c.dsn)
+		assertNoError(t, err)
+		assert(t, store.DSN() == c.dsn, fmt.Sprintf("want dsn %q, got: %q", c.dsn, store.DSN()))
+		assert(t, store.Path() == c.path, fmt.Sprintf("want path %q, got: %q", c.path, store.Path()))
+		assert(t, store.InMemory() == c.inMemory, fmt.Sprintf("want in-memory %v for %q", c.inMemory, c.dsn))
+		assertNoError(t, store.Close())
+	}
+
+	db, err := sql.Open(driverName, dir+"/from_db.db")
+	assertNoError(t, err)
+	defer db.Close()
+	store, err := NewStoreFromDB(db)
+	assertNoError(t, err)
+	defer store.Close()
+	assert(t, store.DSN() == "" && store.Path() == "" && !store.InMemory(), "want no dsn for a store from a handle")
+}
+
+func TestSqlitePragmasAppliedToStoreConnection(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err := store.StoreLog(createRaftLog(1, "log1"))
+	assertNoError(t, err)
+
+	// Check the pragmas from within a transaction, the same way the store
+	// performs its writes.
+	var journalMode, synchronous string
+	err = store.transaction(func(tx *sql.Tx) error {
+		if err := tx.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil {
+			return err
+		}
+		return tx.QueryRow("PRAGMA synchronous").Scan(&synchronous)
+	})
+	assertNoError(t, err)
+	assert(t, journalMode == "wal", fmt.Sprintf("want journal_mode wal, got: %s", journalMode))
+	// 1 == NORMAL
+	assert(t, synchronous == "1", fmt.Sprintf("want synchronous 1, got: %s", synchronous))
 }
 
 func TestStoreLog(t *testing.T) {
@@ -117,6 +252,25 @@ func TestStoreLog(t *testing.T) {
 	assert(t, log.Index == 1, fmt.Sprintf("want index 1, got: %d", log.Index))
 }
 
+func TestStoreLogsDuplicateIndex(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err := store.StoreLogs([]*raft.Log{createRaftLog(1, "log1")})
+	assertNoError(t, err)
+
+	err = store.StoreLogs([]*raft.Log{createRaftLog(2, "log2"), createRaftLog(1, "log1")})
+	assert(t, err != nil, "want error storing a duplicate index, got nil")
+
+	// the whole batch should have been rolled back
+	log := new(raft.Log)
+	err = store.GetLog(2, log)
+	assert(t, err == raft.ErrLogNotFound, fmt.Sprintf("want log not found, got: %s", err))
+}
+
 func TestFirstIndex(t *testing.T) {
 	store := mustSqliteDiskStore(t)
 	defer func() {
@@ -148,15 +302,19 @@ func TestLastIndex(t *testing.T) {
 		store.deleteDB()
 	}()
 
+	idx, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, idx == 0, fmt.Sprintf("want 0, got: %d", idx))
+
 	logs := []*raft.Log{
 		createRaftLog(1, "log1"),
 		createRaftLog(2, "log2"),
 		createRaftLog(3, "log3"),
 	}
-	err := store.StoreLogs(logs)
+	err = store.StoreLogs(logs)
 	assertNoError(t, err)
 
-	idx, err := store.LastIndex()
+	idx, err = store.LastIndex()
 	assertNoError(t, err)
 	assert(t, idx == 3, fmt.Sprintf("want last index 3, got: %d", idx))
 }
@@ -186,6 +344,217 @@ func TestGetLog(t *testing.T) {
 	assert(t, log.Index == 2, fmt.Sprintf("want index 2, got: %d", log.Index))
 }
 
+func TestGetLogTerm(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	_, err := store.GetLogTerm(1)
+	assert(t, err == raft.ErrLogNotFound, fmt.Sprintf("want log not found, got: %v", err))
+
+	err = store.StoreLogs([]*raft.Log{
+		{Index: 1, Term: 2, Data: []byte("log1")},
+		{Index: 2, Term: 3, Data: []byte("log2")},
+	})
+	assertNoError(t, err)
+
+	for idx := uint64(1); idx <= 2; idx++ {
+		log := new(raft.Log)
+		err := store.GetLog(idx, log)
+		assertNoError(t, err)
+
+		term, err := store.GetLogTerm(idx)
+		assertNoError(t, err)
+		assert(t, term == log.Term, fmt.Sprintf("want term %d, got: %d", log.Term, term))
+	}
+}
+
+func TestGetLogs(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 100; i++ {
+		logs = append(logs, createRaftLog(i, fmt.Sprintf("log%d", i)))
+	}
+	err := store.StoreLogs(logs)
+	assertNoError(t, err)
+
+	got, err := store.GetLogs(10, 20)
+	assertNoError(t, err)
+	assert(t, len(got) == 11, fmt.Sprintf("want 11 logs, got: %d", len(got)))
+	for i, log := range got {
+		assert(t, log.Index == uint64(10+i), fmt.Sprintf("want index %d, got: %d", 10+i, log.Index))
+	}
+
+	err = store.DeleteRange(15, 15)
+	assertNoError(t, err)
+
+	_, err = store.GetLogs(10, 20)
+	assert(t, err == raft.ErrLogNotFound, fmt.Sprintf("want log not found, got: %s", err))
+}
+
+func TestGetLogRange(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 3, "log")
+	storeLogRange(t, store, 7, 10, "log")
+
+	indexes := func(logs []*raft.Log) []uint64 {
+		idxs := []uint64{}
+		for _, log := range logs {
+			idxs = append(idxs, log.Index)
+		}
+		return idxs
+	}
+
+	tests := []struct {
+		start uint64
+		limit int
+		want  []uint64
+	}{
+		// gaps are skipped
+		{2, 4, []uint64{2, 3, 7, 8}},
+		{4, 2, []uint64{7, 8}},
+		// limit smaller than the available rows
+		{1, 2, []uint64{1, 2}},
+		// limit larger than the available rows
+		{8, 10, []uint64{8, 9, 10}},
+		// start beyond the last index
+		{11, 10, []uint64{}},
+		{1, 0, []uint64{}},
+	}
+	for _, tt := range tests {
+		logs, err := store.GetLogRange(tt.start, tt.limit)
+		assertNoError(t, err)
+		got := indexes(logs)
+		assert(t, fmt.Sprint(got) == fmt.Sprint(tt.want), fmt.Sprintf("GetLogRange(%d, %d): want %v, got: %v", tt.start, tt.limit, tt.want, got))
+	}
+}
+
+func TestIterateLogs(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 1000, "log")
+
+	next := uint64(1)
+	err := store.IterateLogs(context.Background(), func(log *raft.Log) error {
+		if log.Index != next {
+			return fmt.Errorf("want index %d, got: %d", next, log.Index)
+		}
+		next++
+		return nil
+	})
+	assertNoError(t, err)
+	assert(t, next == 1001, fmt.Sprintf("want 1000 logs visited, got: %d", next-1))
+
+	// early termination
+	errStop := errors.New("stop")
+	visited := 0
+	err = store.IterateLogs(context.Background(), func(log *raft.Log) error {
+		visited++
+		if log.Index == 10 {
+			return errStop
+		}
+		return nil
+	})
+	assert(t, err == errStop, fmt.Sprintf("want stop err, got: %v", err))
+	assert(t, visited == 10, fmt.Sprintf("want 10 logs visited, got: %d", visited))
+
+	// the store is usable after the iteration
+	idx, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, idx == 1000, fmt.Sprintf("want last index 1000, got: %d", idx))
+}
+
+func TestIterateLogsReverse(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 1000, "log")
+
+	next := uint64(1000)
+	err := store.IterateLogsReverse(context.Background(), func(log *raft.Log) error {
+		if log.Index != next {
+			return fmt.Errorf("want index %d, got: %d", next, log.Index)
+		}
+		next--
+		return nil
+	})
+	assertNoError(t, err)
+	assert(t, next == 0, fmt.Sprintf("want 1000 logs visited, got: %d", 1000-next))
+
+	// early termination
+	errStop := errors.New("stop")
+	visited := 0
+	err = store.IterateLogsReverse(context.Background(), func(log *raft.Log) error {
+		visited++
+		if log.Index == 991 {
+			return errStop
+		}
+		return nil
+	})
+	assert(t, err == errStop, fmt.Sprintf("want stop err, got: %v", err))
+	assert(t, visited == 10, fmt.Sprintf("want 10 logs visited, got: %d", visited))
+
+	// the store is usable after the iteration
+	idx, err := store.FirstIndex()
+	assertNoError(t, err)
+	assert(t, idx == 1, fmt.Sprintf("want first index 1, got: %d", idx))
+}
+
+func TestStoreLogsMultiRow(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	// spans several statements
+	storeLogRange(t, store, 1, 3*maxInsertLogRows+10, "log")
+
+	count, err := store.CountLogs()
+	assertNoError(t, err)
+	assert(t, count == 3*maxInsertLogRows+10, fmt.Sprintf("want %d logs, got: %d", 3*maxInsertLogRows+10, count))
+
+	for _, idx := range []uint64{1, maxInsertLogRows, maxInsertLogRows + 1, 3*maxInsertLogRows + 10} {
+		log := new(raft.Log)
+		err = store.GetLog(idx, log)
+		assertNoError(t, err)
+		assert(t, log.Index == idx, fmt.Sprintf("want index %d, got: %d", idx, log.Index))
+		assert(t, string(log.Data) == "log", fmt.Sprintf("want data log, got: %s", log.Data))
+	}
+
+	// a duplicate in a later statement rolls back the whole batch
+	logs := make([]*raft.Log, 0, maxInsertLogRows+1)
+	for i := uint64(10000); i < 10000+maxInsertLogRows; i++ {
+		logs = append(logs, createRaftLog(i, "log"))
+	}
+	logs = append(logs, createRaftLog(1, "log"))
+	err = store.StoreLogs(logs)
+	assert(t, err != nil, "want error storing a duplicate index")
+
+	count, err = store.CountLogs()
+	assertNoError(t, err)
+	assert(t, count == 3*maxInsertLogRows+10, fmt.Sprintf("want %d logs, got: %d", 3*maxInsertLogRows+10, count))
+}
+
 func TestDeleteRange(t *testing.T) {
 	store := mustSqliteDiskStore(t)
 	defer func() {
@@ -215,35 +584,766 @@ func TestDeleteRange(t *testing.T) {
 	assert(t, log.Index == 3, fmt.Sprintf("want index 3, got: %d", log.Index))
 }
 
-func TestSetGet(t *testing.T) {
+func TestDeleteRangeN(t *testing.T) {
 	store := mustSqliteDiskStore(t)
 	defer func() {
 		store.Close()
 		store.deleteDB()
 	}()
 
-	err := store.Set([]byte("key1"), []byte("val1"))
+	storeLogRange(t, store, 1, 5, "log")
+	storeLogRange(t, store, 10, 12, "log")
+
+	deleted, err := store.DeleteRangeN(4, 10)
 	assertNoError(t, err)
+	assert(t, deleted == 3, fmt.Sprintf("want 3 logs deleted, got: %d", deleted))
 
-	val, err := store.Get([]byte("key1"))
+	deleted, err = store.DeleteRangeN(6, 9)
 	assertNoError(t, err)
-	assert(t, string(val) == "val1", fmt.Sprintf("want val1, got: %s", val))
+	assert(t, deleted == 0, fmt.Sprintf("want 0 logs deleted, got: %d", deleted))
+
+	count, err := store.CountLogs()
+	assertNoError(t, err)
+	assert(t, count == 5, fmt.Sprintf("want 5 logs, got: %d", count))
 }
 
-func TestSetGetUint64(t *testing.T) {
+func TestDeleteRangeChunked(t *testing.T) {
 	store := mustSqliteDiskStore(t)
 	defer func() {
 		store.Close()
 		store.deleteDB()
 	}()
 
-	err := store.SetUint64([]byte("key1"), 123)
+	storeLogRange(t, store, 1, 10000, "log")
+
+	reader, err := NewStore(store.path)
 	assertNoError(t, err)
+	defer reader.Close()
 
-	val, err := store.GetUint64([]byte("key1"))
+	var batches int
+	err = store.DeleteRangeChunkedWithProgress(1, 10000, 1000, func(through uint64, deleted int64) {
+		batches++
+		assert(t, deleted == int64(through), fmt.Sprintf("want %d logs deleted, got: %d", through, deleted))
+
+		// the logs past the batch are still readable from another connection
+		first, err := reader.FirstIndex()
+		assertNoError(t, err)
+		if through < 10000 {
+			assert(t, first == through+1, fmt.Sprintf("want first index %d, got: %d", through+1, first))
+			err = reader.GetLog(10000, new(raft.Log))
+			assertNoError(t, err)
+		}
+	})
 	assertNoError(t, err)
-	assert(t, val == 123, fmt.Sprintf("want 123, got: %d", val))
+	assert(t, batches == 10, fmt.Sprintf("want 10 batches, got: %d", batches))
 
-	_, err = store.GetUint64([]byte("404"))
-	assert(t, err == ErrKeyNotFound, fmt.Sprintf("want not found err, got: %s", err))
+	count, err := store.CountLogs()
+	assertNoError(t, err)
+	assert(t, count == 0, fmt.Sprintf("want 0 logs, got: %d", count))
+
+	err = store.DeleteRangeChunked(1, 10, 0)
+	assert(t, err != nil, "want error for zero chunk size")
+}
+
+func TestRunInTransaction(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	_, err := store.db.Exec("CREATE TABLE fsm (key TEXT PRIMARY KEY, value TEXT)")
+	assertNoError(t, err)
+
+	err = store.RunInTransaction(context.Background(), func(tx *sql.Tx) error {
+		if _, err := tx.Exec("INSERT INTO fsm (key, value) VALUES ('a', '1')"); err != nil {
+			return err
+		}
+		return store.setTx(tx, []byte("applied"), []byte("1"))
+	})
+	assertNoError(t, err)
+
+	errAbort := errors.New("abort")
+	err = store.RunInTransaction(context.Background(), func(tx *sql.Tx) error {
+		if _, err := tx.Exec("INSERT INTO fsm (key, value) VALUES ('b', '2')"); err != nil {
+			return err
+		}
+		if err := store.setTx(tx, []byte("applied"), []byte("2")); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	assert(t, errors.Is(err, errAbort), fmt.Sprintf("want abort err, got: %v", err))
+
+	var rows int
+	err = store.db.QueryRow("SELECT COUNT(*) FROM fsm").Scan(&rows)
+	assertNoError(t, err)
+	assert(t, rows == 1, fmt.Sprintf("want 1 fsm row, got: %d", rows))
+
+	applied, err := store.Get([]byte("applied"))
+	assertNoError(t, err)
+	assert(t, string(applied) == "1", fmt.Sprintf("want applied 1, got: %s", applied))
+}
+
+func TestCountLogs(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	count, err := store.CountLogs()
+	assertNoError(t, err)
+	assert(t, count == 0, fmt.Sprintf("want 0 logs, got: %d", count))
+
+	storeLogRange(t, store, 1, 5, "log")
+	err = store.DeleteRange(2, 3)
+	assertNoError(t, err)
+
+	count, err = store.CountLogs()
+	assertNoError(t, err)
+	assert(t, count == 3, fmt.Sprintf("want 3 logs, got: %d", count))
+
+	count, err = store.CountLogsRange(1, 3)
+	assertNoError(t, err)
+	assert(t, count == 1, fmt.Sprintf("want 1 log in [1, 3], got: %d", count))
+}
+
+func TestExistsLog(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 3, "log")
+
+	exists, err := store.ExistsLog(2)
+	assertNoError(t, err)
+	assert(t, exists, "want log 2 to exist")
+
+	exists, err = store.ExistsLog(4)
+	assertNoError(t, err)
+	assert(t, !exists, "want log 4 to not exist")
+}
+
+func TestVerifyContiguous(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	gaps, err := store.VerifyContiguous()
+	assertNoError(t, err)
+	assert(t, len(gaps) == 0, fmt.Sprintf("want no gaps, got: %v", gaps))
+
+	storeLogRange(t, store, 1, 3, "log")
+	storeLogRange(t, store, 7, 8, "log")
+
+	gaps, err = store.VerifyContiguous()
+	assertNoError(t, err)
+	assert(t, len(gaps) == 1 && gaps[0] == [2]uint64{4, 6}, fmt.Sprintf("want gap [4, 6], got: %v", gaps))
+
+	storeLogRange(t, store, 10, 10, "log")
+	storeLogRange(t, store, 4, 6, "log")
+
+	gaps, err = store.VerifyContiguous()
+	assertNoError(t, err)
+	assert(t, len(gaps) == 1 && gaps[0] == [2]uint64{9, 9}, fmt.Sprintf("want gap [9, 9], got: %v", gaps))
+}
+
+func TestNeighborIndexes(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	next, err := store.FirstIndexAfter(0)
+	assertNoError(t, err)
+	assert(t, next == 0, fmt.Sprintf("want no index in an empty log, got: %d", next))
+
+	storeLogRange(t, store, 3, 5, "log")
+	storeLogRange(t, store, 9, 10, "log")
+	storeLogRange(t, store, 20, 20, "log")
+
+	cases := []struct {
+		idx, after, before uint64
+	}{
+		{0, 3, 0},
+		{3, 4, 0},
+		{4, 5, 3},
+		{5, 9, 4},
+		{7, 9, 5},
+		{10, 20, 9},
+		{15, 20, 10},
+		{20, 0, 10},
+		{30, 0, 20},
+	}
+	for _, c := range cases {
+		next, err := store.FirstIndexAfter(c.idx)
+		assertNoError(t, err)
+		assert(t, next == c.after, fmt.Sprintf("want first index after %d to be %d, got: %d", c.idx, c.after, next))
+
+		prev, err := store.LastIndexBefore(c.idx)
+		assertNoError(t, err)
+		assert(t, prev == c.before, fmt.Sprintf("want last index before %d to be %d, got: %d", c.idx, c.before, prev))
+	}
+}
+
+func TestSetGet(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err := store.Set([]byte("key1"), []byte("val1"))
+	assertNoError(t, err)
+
+	val, err := store.Get([]byte("key1"))
+	assertNoError(t, err)
+	assert(t, string(val) == "val1", fmt.Sprintf("want val1, got: %s", val))
+}
+
+func TestKeys(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	keys, err := store.Keys()
+	assertNoError(t, err)
+	assert(t, len(keys) == 0, fmt.Sprintf("want no keys, got: %d", len(keys)))
+
+	for _, k := range []string{"key3", "key1", "key2"} {
+		err := store.Set([]byte(k), []byte("val"))
+		assertNoError(t, err)
+	}
+
+	keys, err = store.Keys()
+	assertNoError(t, err)
+	assert(t, len(keys) == 3, fmt.Sprintf("want 3 keys, got: %d", len(keys)))
+	for i, k := range keys {
+		want := fmt.Sprintf("key%d", i+1)
+		assert(t, string(k) == want, fmt.Sprintf("want %s, got: %s", want, k))
+	}
+}
+
+func TestDelete(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err := store.Set([]byte("key1"), []byte("val1"))
+	assertNoError(t, err)
+	err = store.Set([]byte("key2"), []byte("val2"))
+	assertNoError(t, err)
+
+	err = store.Delete([]byte("key1"))
+	assertNoError(t, err)
+
+	_, err = store.Get([]byte("key1"))
+	assert(t, err == ErrKeyNotFound, fmt.Sprintf("want not found err, got: %s", err))
+	val, err := store.Get([]byte("key2"))
+	assertNoError(t, err)
+	assert(t, string(val) == "val2", fmt.Sprintf("want val2, got: %s", val))
+
+	// deleting a missing key is a no-op
+	err = store.Delete([]byte("404"))
+	assertNoError(t, err)
+}
+
+func TestSetManyGetMany(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	pairs := map[string][]byte{}
+	for i := 0; i < 1200; i++ {
+		pairs[fmt.Sprintf("key%d", i)] = []byte(fmt.Sprintf("val%d", i))
+	}
+	err := store.SetMany(pairs)
+	assertNoError(t, err)
+
+	// keys set in bulk are visible to Get
+	val, err := store.Get([]byte("key42"))
+	assertNoError(t, err)
+	assert(t, string(val) == "val42", fmt.Sprintf("want val42, got: %s", val))
+
+	var keys [][]byte
+	for i := 0; i < 1200; i += 2 {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("missing%d", i)))
+	}
+	values, err := store.GetMany(keys)
+	assertNoError(t, err)
+	assert(t, len(values) == 600, fmt.Sprintf("want 600 values, got: %d", len(values)))
+	for k, v := range values {
+		assert(t, string(v) == string(pairs[k]), fmt.Sprintf("want %s for %s, got: %s", pairs[k], k, v))
+	}
+	_, ok := values["missing0"]
+	assert(t, !ok, "want missing keys to be absent")
+
+	values, err = store.GetMany(nil)
+	assertNoError(t, err)
+	assert(t, len(values) == 0, fmt.Sprintf("want no values, got: %d", len(values)))
+}
+
+func TestSetGetUint64(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err := store.SetUint64([]byte("key1"), 123)
+	assertNoError(t, err)
+
+	val, err := store.GetUint64([]byte("key1"))
+	assertNoError(t, err)
+	assert(t, val == 123, fmt.Sprintf("want 123, got: %d", val))
+
+	_, err = store.GetUint64([]byte("404"))
+	assert(t, err == ErrKeyNotFound, fmt.Sprintf("want not found err, got: %s", err))
+}
+
+func TestStoreLogsCtxCanceled(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	logs := []*raft.Log{
+		createRaftLog(1, "log1"),
+		createRaftLog(2, "log2"),
+	}
+	err := store.StoreLogsCtx(ctx, logs)
+	assert(t, errors.Is(err, context.Canceled), fmt.Sprintf("want context canceled, got: %v", err))
+
+	idx, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, idx == 0, fmt.Sprintf("want no logs committed, got last index: %d", idx))
+
+	log := new(raft.Log)
+	err = store.GetLogCtx(ctx, 1, log)
+	assert(t, errors.Is(err, context.Canceled), fmt.Sprintf("want context canceled, got: %v", err))
+
+	err = store.DeleteRangeCtx(ctx, 1, 2)
+	assert(t, errors.Is(err, context.Canceled), fmt.Sprintf("want context canceled, got: %v", err))
+}
+
+func TestCtxDeadlineExceeded(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+
+	err := store.SetCtx(ctx, []byte("key"), []byte("value"))
+	assert(t, errors.Is(err, context.DeadlineExceeded), fmt.Sprintf("want deadline exceeded, got: %v", err))
+	err = store.StoreLogCtx(ctx, createRaftLog(1, "log1"))
+	assert(t, errors.Is(err, context.DeadlineExceeded), fmt.Sprintf("want deadline exceeded, got: %v", err))
+
+	_, err = store.GetCtx(ctx, []byte("key"))
+	assert(t, errors.Is(err, context.DeadlineExceeded), fmt.Sprintf("want deadline exceeded, got: %v", err))
+	_, err = store.Get([]byte("key"))
+	assert(t, err == ErrKeyNotFound, fmt.Sprintf("want not found err, got: %v", err))
+
+	// the context ends while the transaction is running
+	ctx, cancel = context.WithCancel(context.Background())
+	err = store.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		if err := store.setTx(tx, []byte("key"), []byte("value")); err != nil {
+			return err
+		}
+		cancel()
+		return nil
+	})
+	assert(t, errors.Is(err, context.Canceled), fmt.Sprintf("want context canceled, got: %v", err))
+
+	_, err = store.Get([]byte("key"))
+	assert(t, err == ErrKeyNotFound, fmt.Sprintf("want not found err, got: %v", err))
+
+	last, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 0, fmt.Sprintf("want no logs committed, got last index: %d", last))
+}
+
+func TestNewStoreFromDB(t *testing.T) {
+	db, err := sql.Open(driverName, t.TempDir()+"/raft.db")
+	assertNoError(t, err)
+	defer db.Close()
+
+	store, err := NewStoreFromDB(db)
+	assertNoError(t, err)
+	assert(t, store.path == "", fmt.Sprintf("want empty path, got: %s", store.path))
+
+	err = store.StoreLog(createRaftLog(1, "log1"))
+	assertNoError(t, err)
+	err = store.Set([]byte("key1"), []byte("val1"))
+	assertNoError(t, err)
+
+	err = store.Close()
+	assertNoError(t, err)
+
+	// the database is still usable after closing the store
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&count)
+	assertNoError(t, err)
+	assert(t, count == 1, fmt.Sprintf("want 1 log, got: %d", count))
+}
+
+func TestStoreLogsTx(t *testing.T) {
+	db, err := sql.Open(driverName, t.TempDir()+"/raft.db")
+	assertNoError(t, err)
+	defer db.Close()
+
+	store, err := NewStoreFromDB(db)
+	assertNoError(t, err)
+	defer store.Close()
+
+	_, err = db.Exec("CREATE TABLE fsm (idx INTEGER PRIMARY KEY, value TEXT)")
+	assertNoError(t, err)
+
+	// apply logs and write their result in one transaction
+	apply := func(logs []*raft.Log, idx uint64, commit bool) error {
+		tx, err := db.Begin()
+		assertNoError(t, err)
+		defer store.EndStoreLogsTx(logs)
+		defer tx.Rollback()
+
+		if err := store.StoreLogsTx(tx, logs); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO fsm (idx, value) VALUES (?, ?)", idx, "applied"); err != nil {
+			return err
+		}
+		if !commit {
+			return nil
+		}
+		return tx.Commit()
+	}
+
+	count := func(query string) int {
+		var n int
+		err := db.QueryRow(query).Scan(&n)
+		assertNoError(t, err)
+		return n
+	}
+
+	err = apply([]*raft.Log{createRaftLog(1, "log1"), createRaftLog(2, "log2")}, 2, true)
+	assertNoError(t, err)
+	assert(t, count("SELECT COUNT(*) FROM logs") == 2, "want 2 logs")
+	assert(t, count("SELECT COUNT(*) FROM fsm") == 1, "want 1 fsm row")
+	last, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 2, fmt.Sprintf("want last index 2, got: %d", last))
+
+	// rolling back drops both the logs and the application row
+	err = apply([]*raft.Log{createRaftLog(3, "log3")}, 3, false)
+	assertNoError(t, err)
+
+	// a failing application write rolls back the logs too
+	err = apply([]*raft.Log{createRaftLog(3, "log3")}, 2, true)
+	assert(t, err != nil, "want error for duplicate fsm row")
+
+	assert(t, count("SELECT COUNT(*) FROM logs") == 2, "want 2 logs after rollbacks")
+	assert(t, count("SELECT COUNT(*) FROM fsm") == 1, "want 1 fsm row after rollbacks")
+	last, err = store.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 2, fmt.Sprintf("want last index 2 after rollbacks, got: %d", last))
+	err = store.GetLog(3, new(raft.Log))
+	assert(t, errors.Is(err, raft.ErrLogNotFound), fmt.Sprintf("want log not found err, got: %v", err))
+}
+
+func TestStoreLogsTxCaches(t *testing.T) {
+	db, err := sql.Open(driverName, t.TempDir()+"/raft.db")
+	assertNoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(2)
+
+	store, err := NewStoreFromDB(db, WithLogCache(10), WithIndexCache(true), WithUpsertLogs(true))
+	assertNoError(t, err)
+	defer store.Close()
+
+	storeLogRange(t, store, 1, 2, "old")
+
+	logs := []*raft.Log{createRaftLog(2, "new"), createRaftLog(3, "new")}
+	tx, err := db.Begin()
+	assertNoError(t, err)
+	err = store.StoreLogsTx(tx, logs)
+	assertNoError(t, err)
+
+	// reads before the commit see the logs as they were, which must not
+	// outlive the commit in the caches
+	log := new(raft.Log)
+	err = store.GetLog(2, log)
+	assertNoError(t, err)
+	assert(t, string(log.Data) == "old", fmt.Sprintf("want old log before commit, got: %q", log.Data))
+	last, err := store.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 2, fmt.Sprintf("want last index 2 before commit, got: %d", last))
+
+	err = tx.Commit()
+	assertNoError(t, err)
+	store.EndStoreLogsTx(logs)
+
+	err = store.GetLog(2, log)
+	assertNoError(t, err)
+	assert(t, string(log.Data) == "new", fmt.Sprintf("want new log after commit, got: %q", log.Data))
+	last, err = store.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 3, fmt.Sprintf("want last index 3 after commit, got: %d", last))
+}
+
+func TestNamespacedStore(t *testing.T) {
+	db, err := sql.Open(driverName, t.TempDir()+"/raft.db")
+	assertNoError(t, err)
+	defer db.Close()
+
+	store1, err := NewNamespacedStore(db, "group1")
+	assertNoError(t, err)
+	defer store1.Close()
+
+	store2, err := NewNamespacedStore(db, "group2")
+	assertNoError(t, err)
+	defer store2.Close()
+
+	err = store1.StoreLogs([]*raft.Log{
+		createRaftLog(1, "log1"),
+		createRaftLog(2, "log2"),
+	})
+	assertNoError(t, err)
+
+	err = store2.StoreLogs([]*raft.Log{
+		createRaftLog(10, "log10"),
+		createRaftLog(11, "log11"),
+		createRaftLog(12, "log12"),
+	})
+	assertNoError(t, err)
+
+	first, err := store1.FirstIndex()
+	assertNoError(t, err)
+	last, err := store1.LastIndex()
+	assertNoError(t, err)
+	assert(t, first == 1 && last == 2, fmt.Sprintf("want group1 range [1, 2], got: [%d, %d]", first, last))
+
+	first, err = store2.FirstIndex()
+	assertNoError(t, err)
+	last, err = store2.LastIndex()
+	assertNoError(t, err)
+	assert(t, first == 10 && last == 12, fmt.Sprintf("want group2 range [10, 12], got: [%d, %d]", first, last))
+
+	err = store1.Set([]byte("key1"), []byte("val1"))
+	assertNoError(t, err)
+	_, err = store2.Get([]byte("key1"))
+	assert(t, err == ErrKeyNotFound, fmt.Sprintf("want not found err, got: %s", err))
+
+	// closing a namespaced store leaves the shared database open
+	err = store1.Close()
+	assertNoError(t, err)
+	err = db.Ping()
+	assertNoError(t, err)
+
+	_, err = NewNamespacedStore(db, "bad namespace")
+	assert(t, err != nil, "want error for invalid namespace")
+}
+
+func storeLogRange(t testing.TB, store *SqliteStore, first, last uint64, data string) {
+	t.Helper()
+
+	var logs []*raft.Log
+	for i := first; i <= last; i++ {
+		logs = append(logs, createRaftLog(i, data))
+	}
+	err := store.StoreLogs(logs)
+	assertNoError(t, err)
+}
+
+func fileSize(t testing.TB, path string) int64 {
+	t.Helper()
+
+	fi, err := os.Stat(path)
+	assertNoError(t, err)
+	return fi.Size()
+}
+
+func TestPing(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer store.deleteDB()
+
+	err := store.Ping(context.Background())
+	assertNoError(t, err)
+	assert(t, store.Healthy(), "want open store to be healthy")
+
+	store.Close()
+
+	err = store.Ping(context.Background())
+	assert(t, err != nil, "want error pinging a closed store")
+	assert(t, !store.Healthy(), "want closed store to be unhealthy")
+}
+
+func TestVacuum(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 1000, strings.Repeat("x", 1024))
+	err := store.DeleteRange(1, 990)
+	assertNoError(t, err)
+
+	// flush the WAL so the main file reflects the deletes
+	_, err = store.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	assertNoError(t, err)
+	before := fileSize(t, store.path)
+
+	err = store.Vacuum()
+	assertNoError(t, err)
+	_, err = store.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	assertNoError(t, err)
+	after := fileSize(t, store.path)
+	assert(t, after < before, fmt.Sprintf("want file to shrink, got %d bytes before and %d after", before, after))
+
+	idx, err := store.FirstIndex()
+	assertNoError(t, err)
+	assert(t, idx == 991, fmt.Sprintf("want first index 991, got: %d", idx))
+}
+
+func TestShrink(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 2000, strings.Repeat("x", 1024))
+	err := store.DeleteRange(1, 1990)
+	assertNoError(t, err)
+	before := fileSize(t, store.path) + fileSize(t, store.path+"-wal")
+
+	err = store.Shrink()
+	assertNoError(t, err)
+	after := fileSize(t, store.path) + fileSize(t, store.path+"-wal")
+	assert(t, after < before/10, fmt.Sprintf("want files to shrink tenfold, got %d bytes before and %d after", before, after))
+
+	assertBounds(t, store, 1991, 2000)
+	logs, err := store.CountLogs()
+	assertNoError(t, err)
+	assert(t, logs == 10, fmt.Sprintf("want 10 logs, got: %d", logs))
+}
+
+func TestIncrementalVacuum(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithAutoVacuum("incremental"))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 500, strings.Repeat("x", 1024))
+	err = store.DeleteRange(1, 400)
+	assertNoError(t, err)
+
+	freelist := func() int64 {
+		var n int64
+		err := store.db.QueryRow("PRAGMA freelist_count").Scan(&n)
+		assertNoError(t, err)
+		return n
+	}
+	before := freelist()
+	assert(t, before > 10, fmt.Sprintf("want free pages after deleting, got: %d", before))
+
+	err = store.IncrementalVacuum(10)
+	assertNoError(t, err)
+	after := freelist()
+	assert(t, after == before-10, fmt.Sprintf("want %d free pages, got: %d", before-10, after))
+
+	err = store.IncrementalVacuum(0)
+	assertNoError(t, err)
+	after = freelist()
+	assert(t, after == 0, fmt.Sprintf("want no free pages, got: %d", after))
+}
+
+func TestVacuumInto(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 1000, strings.Repeat("x", 1024))
+	err := store.DeleteRange(1, 990)
+	assertNoError(t, err)
+	_, err = store.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	assertNoError(t, err)
+
+	path := t.TempDir() + "/compacted.db"
+	err = store.VacuumInto(path)
+	assertNoError(t, err)
+	assert(t, fileSize(t, path) < fileSize(t, store.path), "want compacted copy to be smaller")
+
+	compacted, err := NewStore(path)
+	assertNoError(t, err)
+	defer compacted.Close()
+
+	idx, err := compacted.LastIndex()
+	assertNoError(t, err)
+	assert(t, idx == 1000, fmt.Sprintf("want last index 1000, got: %d", idx))
+}
+
+func TestBackup(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 5, 50, "log")
+	err := store.Set([]byte("key1"), []byte("val1"))
+	assertNoError(t, err)
+	err = store.SetUint64([]byte("key2"), 42)
+	assertNoError(t, err)
+
+	path := t.TempDir() + "/backup.db"
+	err = store.Backup(path)
+	assertNoError(t, err)
+
+	backup, err := NewStore(path)
+	assertNoError(t, err)
+	defer backup.Close()
+
+	first, err := backup.FirstIndex()
+	assertNoError(t, err)
+	last, err := backup.LastIndex()
+	assertNoError(t, err)
+	assert(t, first == 5 && last == 50, fmt.Sprintf("want range [5, 50], got: [%d, %d]", first, last))
+
+	val, err := backup.Get([]byte("key1"))
+	assertNoError(t, err)
+	assert(t, string(val) == "val1", fmt.Sprintf("want val1, got: %s", val))
+
+	n, err := backup.GetUint64([]byte("key2"))
+	assertNoError(t, err)
+	assert(t, n == 42, fmt.Sprintf("want 42, got: %d", n))
+
+	// the backup is a point in time copy
+	err = store.StoreLog(createRaftLog(51, "log"))
+	assertNoError(t, err)
+	last, err = backup.LastIndex()
+	assertNoError(t, err)
+	assert(t, last == 50, fmt.Sprintf("want backup last index 50, got: %d", last))
 }
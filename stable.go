@@ -0,0 +1,48 @@
+package raftsqlite
+
+import "errors"
+
+// The keys raft keeps in its StableStore.
+var (
+	keyCurrentTerm  = []byte("CurrentTerm")
+	keyLastVoteTerm = []byte("LastVoteTerm")
+	keyLastVoteCand = []byte("LastVoteCand")
+)
+
+// CurrentTerm returns the current term raft persisted in the store, 0 if
+// there is none yet, as for a node that never started.
+func (s *SqliteStore) CurrentTerm() (uint64, error) {
+	return s.getRaftUint64(keyCurrentTerm)
+}
+
+// SetCurrentTerm sets the current term raft reads on startup. It is
+// meant for tooling on a stopped node, raft maintains it while running.
+func (s *SqliteStore) SetCurrentTerm(term uint64) error {
+	return s.SetUint64(keyCurrentTerm, term)
+}
+
+// LastVoteTerm returns the term of the last vote raft cast, 0 if it never
+// voted.
+func (s *SqliteStore) LastVoteTerm() (uint64, error) {
+	return s.getRaftUint64(keyLastVoteTerm)
+}
+
+// LastVoteCand returns the address of the candidate raft last voted for,
+// nil if it never voted.
+func (s *SqliteStore) LastVoteCand() ([]byte, error) {
+	cand, err := s.Get(keyLastVoteCand)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	}
+	return cand, err
+}
+
+// getRaftUint64 returns the uint64 stored at one of the raft keys, 0 if
+// it is missing, which is how raft itself reads them.
+func (s *SqliteStore) getRaftUint64(key []byte) (uint64, error) {
+	v, err := s.GetUint64(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, nil
+	}
+	return v, err
+}
@@ -0,0 +1,48 @@
+package raftsqlite
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRaftStableKeys(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	// a fresh store reads as a node that never started
+	term, err := store.CurrentTerm()
+	assertNoError(t, err)
+	assert(t, term == 0, fmt.Sprintf("want current term 0, got: %d", term))
+	voteTerm, err := store.LastVoteTerm()
+	assertNoError(t, err)
+	assert(t, voteTerm == 0, fmt.Sprintf("want last vote term 0, got: %d", voteTerm))
+	cand, err := store.LastVoteCand()
+	assertNoError(t, err)
+	assert(t, cand == nil, fmt.Sprintf("want no last vote candidate, got: %s", cand))
+
+	err = store.SetCurrentTerm(42)
+	assertNoError(t, err)
+	term, err = store.CurrentTerm()
+	assertNoError(t, err)
+	assert(t, term == 42, fmt.Sprintf("want current term 42, got: %d", term))
+
+	// the values are stored under the keys raft uses
+	term, err = store.GetUint64([]byte("CurrentTerm"))
+	assertNoError(t, err)
+	assert(t, term == 42, fmt.Sprintf("want current term 42 under the raft key, got: %d", term))
+
+	err = store.SetUint64([]byte("LastVoteTerm"), 41)
+	assertNoError(t, err)
+	err = store.Set([]byte("LastVoteCand"), []byte("node1"))
+	assertNoError(t, err)
+
+	voteTerm, err = store.LastVoteTerm()
+	assertNoError(t, err)
+	assert(t, voteTerm == 41, fmt.Sprintf("want last vote term 41, got: %d", voteTerm))
+	cand, err = store.LastVoteCand()
+	assertNoError(t, err)
+	assert(t, string(cand) == "node1", fmt.Sprintf("want last vote candidate node1, got: %s", cand))
+}
@@ -0,0 +1,155 @@
+package raftsqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Stats holds statistics about a SqliteStore.
+type Stats struct {
+	// LogCount is the number of logs stored.
+	LogCount uint64
+
+	// FirstIndex and LastIndex delimit the stored logs, both are 0 if
+	// there are no logs.
+	FirstIndex uint64
+	LastIndex  uint64
+
+	// KVCount is the number of keys in the stable store, not counting
+	// the expired ones.
+	KVCount uint64
+
+	// PageCount is the number of pages in the database file.
+	PageCount int64
+
+	// PageSize is the size of a database page in bytes.
+	PageSize int64
+
+	// FreelistCount is the number of unused pages in the database file.
+	FreelistCount int64
+
+	// LogCacheHits and LogCacheMisses count the lookups of the log cache
+	// set with WithLogCache.
+	LogCacheHits   uint64
+	LogCacheMisses uint64
+
+	// DBStats holds the connection pool statistics.
+	sql.DBStats
+}
+
+// Stats returns statistics about the store. The counts and indexes are
+// gathered within a single read transaction, so they are consistent with
+// each other.
+func (s *SqliteStore) Stats() (Stats, error) {
+	tx, err := s.beginRead(context.Background())
+	if err != nil {
+		return Stats{}, err
+	}
+	// nothing to commit, the transaction only provides a stable view
+	defer tx.Rollback()
+
+	var stats Stats
+	err = tx.QueryRow(fmt.Sprintf("SELECT COUNT(*), IFNULL(MIN(idx), 0), IFNULL(MAX(idx), 0) FROM %s", s.opts.logsTable)).
+		Scan(&stats.LogCount, &stats.FirstIndex, &stats.LastIndex)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	// the expired keys not swept yet are absent to the other reads
+	err = tx.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE expires_at IS NULL OR expires_at > ?", s.opts.kvTable),
+		s.opts.clock.Now().UnixNano()).Scan(&stats.KVCount)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	pragmas := []struct {
+		name string
+		dest *int64
+	}{
+		{"page_count", &stats.PageCount},
+		{"page_size", &stats.PageSize},
+		{"freelist_count", &stats.FreelistCount},
+	}
+	for _, p := range pragmas {
+		if err := tx.QueryRow("PRAGMA " + p.name).Scan(p.dest); err != nil {
+			return Stats{}, err
+		}
+	}
+
+	stats.LogCacheHits, stats.LogCacheMisses = s.logCache.stats()
+	stats.DBStats = s.DBStats()
+	return stats, nil
+}
+
+// DBStats returns the connection pool statistics of the store database,
+// without querying it.
+func (s *SqliteStore) DBStats() sql.DBStats {
+	s.connMu.RLock()
+	defer s.connMu.RUnlock()
+	return s.db.Stats()
+}
+
+// DiskUsage describes the space taken by a SqliteStore on disk.
+type DiskUsage struct {
+	// Size is the combined size in bytes of the database file and its
+	// -wal and -shm files.
+	Size int64
+
+	// DBSize, WALSize and SHMSize are the sizes in bytes of each file, 0
+	// if the file does not exist.
+	DBSize  int64
+	WALSize int64
+	SHMSize int64
+
+	// PageCount is the number of pages in the database file.
+	PageCount int64
+
+	// FreelistCount is the number of unused pages in the database file.
+	FreelistCount int64
+
+	// Fragmentation is the ratio of unused pages, which Shrink or Vacuum
+	// reclaim, to the total number of pages.
+	Fragmentation float64
+}
+
+// DiskUsage returns the space taken by the store on disk. A large WALSize
+// relative to DBSize points at checkpoints falling behind rather than at
+// data growth. It returns a zero DiskUsage for in-memory stores and for
+// stores created from an existing *sql.DB, whose file is unknown.
+func (s *SqliteStore) DiskUsage() (DiskUsage, error) {
+	file := dsnFilePath(s.path)
+	if file == "" {
+		return DiskUsage{}, nil
+	}
+
+	var usage DiskUsage
+	err := s.withReconnect(func() error {
+		return s.db.QueryRow("SELECT page_count, freelist_count FROM pragma_page_count(), pragma_freelist_count()").
+			Scan(&usage.PageCount, &usage.FreelistCount)
+	})
+	if err != nil {
+		return DiskUsage{}, err
+	}
+	if usage.PageCount > 0 {
+		usage.Fragmentation = float64(usage.FreelistCount) / float64(usage.PageCount)
+	}
+
+	sizes := []struct {
+		name string
+		dest *int64
+	}{
+		{file, &usage.DBSize},
+		{file + "-wal", &usage.WALSize},
+		{file + "-shm", &usage.SHMSize},
+	}
+	for _, sz := range sizes {
+		n, err := fileSizeIfExists(sz.name)
+		if err != nil {
+			return DiskUsage{}, err
+		}
+		*sz.dest = n
+	}
+	usage.Size = usage.DBSize + usage.WALSize + usage.SHMSize
+	return usage, nil
+}
@@ -0,0 +1,124 @@
+package raftsqlite
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	stats, err := store.Stats()
+	assertNoError(t, err)
+	assert(t, stats.LogCount == 0, fmt.Sprintf("want 0 logs, got: %d", stats.LogCount))
+	assert(t, stats.FirstIndex == 0 && stats.LastIndex == 0, fmt.Sprintf("want range [0, 0], got: [%d, %d]", stats.FirstIndex, stats.LastIndex))
+
+	storeLogRange(t, store, 3, 12, "log")
+	err = store.Set([]byte("key1"), []byte("val1"))
+	assertNoError(t, err)
+	err = store.SetUint64([]byte("key2"), 2)
+	assertNoError(t, err)
+
+	// reading the stats doesn't write
+	txCount := store.txCount.Load()
+	stats, err = store.Stats()
+	assertNoError(t, err)
+	assert(t, store.txCount.Load() == txCount, "want no transaction committed")
+	assert(t, stats.LogCount == 10, fmt.Sprintf("want 10 logs, got: %d", stats.LogCount))
+	assert(t, stats.FirstIndex == 3 && stats.LastIndex == 12, fmt.Sprintf("want range [3, 12], got: [%d, %d]", stats.FirstIndex, stats.LastIndex))
+	assert(t, stats.KVCount == 2, fmt.Sprintf("want 2 keys, got: %d", stats.KVCount))
+	assert(t, stats.PageCount > 0, fmt.Sprintf("want pages, got: %d", stats.PageCount))
+	assert(t, stats.PageSize > 0, fmt.Sprintf("want page size, got: %d", stats.PageSize))
+	assert(t, stats.MaxOpenConnections == 1, fmt.Sprintf("want 1 max open connection, got: %d", stats.MaxOpenConnections))
+}
+
+func TestStatsTTL(t *testing.T) {
+	clock := newFakeClock()
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithClock(clock))
+	assertNoError(t, err)
+	defer store.Close()
+
+	err = store.Set([]byte("term"), []byte("1"))
+	assertNoError(t, err)
+	err = store.SetWithTTL([]byte("lease"), []byte("node1"), time.Minute)
+	assertNoError(t, err)
+
+	stats, err := store.Stats()
+	assertNoError(t, err)
+	assert(t, stats.KVCount == 2, fmt.Sprintf("want 2 keys, got: %d", stats.KVCount))
+
+	// the expired key is not counted before it is swept
+	clock.Advance(time.Minute)
+	stats, err = store.Stats()
+	assertNoError(t, err)
+	assert(t, stats.KVCount == 1, fmt.Sprintf("want 1 key, got: %d", stats.KVCount))
+}
+
+func TestStatsIndexCache(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithIndexCache(true))
+	assertNoError(t, err)
+	defer store.Close()
+
+	storeLogRange(t, store, 1, 3, "log")
+	_, err = store.LastIndex()
+	assertNoError(t, err)
+
+	_, err = store.Stats()
+	assertNoError(t, err)
+	_, _, ok := store.indexCache.get()
+	assert(t, ok, "want the cached indexes kept")
+}
+
+func TestDBStats(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithMaxOpenConns(4))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	stats := store.DBStats()
+	assert(t, stats.MaxOpenConnections == 4, fmt.Sprintf("want 4 max open connections, got: %d", stats.MaxOpenConnections))
+	assert(t, stats.OpenConnections >= 1, fmt.Sprintf("want an open connection, got: %d", stats.OpenConnections))
+}
+
+func TestDiskUsage(t *testing.T) {
+	store := mustSqliteDiskStore(t)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	storeLogRange(t, store, 1, 500, strings.Repeat("x", 1024))
+	err := store.Checkpoint("truncate")
+	assertNoError(t, err)
+	err = store.DeleteRange(1, 400)
+	assertNoError(t, err)
+
+	usage, err := store.DiskUsage()
+	assertNoError(t, err)
+
+	dbSize, walSize, shmSize := fileSize(t, store.path), fileSize(t, store.path+"-wal"), fileSize(t, store.path+"-shm")
+	assert(t, usage.DBSize == dbSize, fmt.Sprintf("want db size %d, got: %d", dbSize, usage.DBSize))
+	assert(t, usage.WALSize == walSize, fmt.Sprintf("want wal size %d, got: %d", walSize, usage.WALSize))
+	assert(t, usage.SHMSize == shmSize, fmt.Sprintf("want shm size %d, got: %d", shmSize, usage.SHMSize))
+	assert(t, usage.Size == dbSize+walSize+shmSize, fmt.Sprintf("want size %d, got: %d", dbSize+walSize+shmSize, usage.Size))
+	assert(t, usage.WALSize > 0, "want the deletes in the wal")
+
+	assert(t, usage.FreelistCount > 0 && usage.FreelistCount < usage.PageCount,
+		fmt.Sprintf("want some free pages, got %d of %d", usage.FreelistCount, usage.PageCount))
+	want := float64(usage.FreelistCount) / float64(usage.PageCount)
+	assert(t, usage.Fragmentation == want, fmt.Sprintf("want fragmentation %f, got: %f", want, usage.Fragmentation))
+
+	mem := mustSqliteInMemoryStore(t)
+	defer mem.Close()
+	usage, err = mem.DiskUsage()
+	assertNoError(t, err)
+	assert(t, usage == DiskUsage{}, fmt.Sprintf("want zero usage for in-memory stores, got: %+v", usage))
+}
@@ -0,0 +1,272 @@
+// Package stress runs concurrent writers and readers against a
+// raftsqlite store, to validate a pragma and pool configuration under a
+// given workload before relying on it.
+package stress
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftsqlite "github.com/mauri870/raft-sqlite"
+)
+
+// StressConfig configures a StressTest run.
+type StressConfig struct {
+	// Store is the store under test. The run appends logs past its last
+	// index, so it should be a store dedicated to the test.
+	Store *raftsqlite.SqliteStore
+
+	// Writers is the number of goroutines storing logs, defaults to 1.
+	// With more than one, batches may commit out of order, which a store
+	// enforcing monotonic indexes rejects.
+	Writers int
+
+	// Readers is the number of goroutines reading logs back, defaults
+	// to 4.
+	Readers int
+
+	// BatchSize is the number of logs per StoreLogs call, defaults to 1.
+	BatchSize int
+
+	// DataSize is the size in bytes of the payload of every log,
+	// defaults to 256.
+	DataSize int
+
+	// Duration is how long the run lasts, zero running until the context
+	// is done.
+	Duration time.Duration
+}
+
+// StressResult reports the outcome of a StressTest run.
+type StressResult struct {
+	// Duration is how long the run lasted.
+	Duration time.Duration
+
+	// Writes and Reads are the number of logs successfully stored and
+	// read back.
+	Writes, Reads uint64
+
+	// WriteErrors and ReadErrors are the number of failed StoreLogs and
+	// GetLog calls.
+	WriteErrors, ReadErrors uint64
+
+	// IntegrityErrors is the number of logs read back with unexpected
+	// contents, or missing after being successfully stored. Any of them
+	// means the configuration loses or corrupts data.
+	IntegrityErrors uint64
+}
+
+// WriteThroughput returns the stored logs per second.
+func (r StressResult) WriteThroughput() float64 {
+	return perSecond(r.Writes, r.Duration)
+}
+
+// ReadThroughput returns the read logs per second.
+func (r StressResult) ReadThroughput() float64 {
+	return perSecond(r.Reads, r.Duration)
+}
+
+// WriteErrorRate returns the fraction of StoreLogs calls that failed.
+func (r StressResult) WriteErrorRate() float64 {
+	return errorRate(r.WriteErrors, r.Writes)
+}
+
+// ReadErrorRate returns the fraction of GetLog calls that failed.
+func (r StressResult) ReadErrorRate() float64 {
+	return errorRate(r.ReadErrors, r.Reads)
+}
+
+func perSecond(n uint64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+func errorRate(errs, ok uint64) float64 {
+	if errs+ok == 0 {
+		return 0
+	}
+	return float64(errs) / float64(errs+ok)
+}
+
+// StressTest runs cfg.Writers goroutines storing logs and cfg.Readers
+// goroutines reading random ones back against cfg.Store, until
+// cfg.Duration elapses or ctx is done, which is a normal way to stop the
+// run rather than an error. Every log carries a payload derived from its
+// index, so the readers detect corrupted logs, and the logs successfully
+// stored are all read back once the run stops. An error is only returned
+// if the run can't start.
+func StressTest(ctx context.Context, cfg StressConfig) (StressResult, error) {
+	if cfg.Store == nil {
+		return StressResult{}, errors.New("stress: nil store")
+	}
+	if cfg.Writers < 0 || cfg.Readers < 0 || cfg.BatchSize < 0 || cfg.DataSize < 0 || cfg.Duration < 0 {
+		return StressResult{}, errors.New("stress: negative config value")
+	}
+	if cfg.Writers == 0 {
+		cfg.Writers = 1
+	}
+	if cfg.Readers == 0 {
+		cfg.Readers = 4
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 1
+	}
+	if cfg.DataSize == 0 {
+		cfg.DataSize = 256
+	}
+	// the payload starts with the index of the log
+	cfg.DataSize = max(cfg.DataSize, 8)
+
+	base, err := cfg.Store.LastIndex()
+	if err != nil {
+		return StressResult{}, fmt.Errorf("stress: reading last index: %w", err)
+	}
+
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	r := &run{cfg: cfg, base: base}
+	r.next.Store(base)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.write(ctx)
+		}()
+	}
+	for i := 0; i < cfg.Readers; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r.read(ctx, rand.New(rand.NewSource(seed)))
+		}(start.UnixNano() + int64(i))
+	}
+	wg.Wait()
+
+	res := StressResult{
+		Duration:    time.Since(start),
+		Writes:      r.writes.Load(),
+		Reads:       r.reads.Load(),
+		WriteErrors: r.writeErrors.Load(),
+		ReadErrors:  r.readErrors.Load(),
+	}
+	res.IntegrityErrors = r.integrityErrors.Load() + r.verifyStored()
+	return res, nil
+}
+
+// run is the state shared by the goroutines of a StressTest run.
+type run struct {
+	cfg  StressConfig
+	base uint64
+
+	// next is the last index handed out to a writer.
+	next atomic.Uint64
+
+	writes, reads           atomic.Uint64
+	writeErrors, readErrors atomic.Uint64
+	integrityErrors         atomic.Uint64
+
+	mu sync.Mutex
+	// stored are the first and last indexes of the committed batches.
+	stored [][2]uint64
+}
+
+func (r *run) write(ctx context.Context) {
+	size := uint64(r.cfg.BatchSize)
+	for ctx.Err() == nil {
+		last := r.next.Add(size)
+		first := last - size + 1
+
+		logs := make([]*raft.Log, 0, size)
+		for idx := first; idx <= last; idx++ {
+			logs = append(logs, &raft.Log{Index: idx, Term: 1, Type: raft.LogCommand, Data: payload(idx, r.cfg.DataSize)})
+		}
+
+		if err := r.cfg.Store.StoreLogsCtx(ctx, logs); err != nil {
+			if ctx.Err() == nil {
+				r.writeErrors.Add(1)
+			}
+			continue
+		}
+		r.writes.Add(size)
+
+		r.mu.Lock()
+		r.stored = append(r.stored, [2]uint64{first, last})
+		r.mu.Unlock()
+	}
+}
+
+func (r *run) read(ctx context.Context, rnd *rand.Rand) {
+	log := new(raft.Log)
+	for ctx.Err() == nil {
+		high := r.next.Load()
+		if high == r.base {
+			// nothing handed out yet
+			time.Sleep(time.Millisecond)
+			continue
+		}
+
+		idx := r.base + 1 + uint64(rnd.Int63n(int64(high-r.base)))
+		err := r.cfg.Store.GetLogCtx(ctx, idx, log)
+		switch {
+		case errors.Is(err, raft.ErrLogNotFound):
+			// not committed yet, or its write failed
+		case errors.Is(err, raftsqlite.ErrLogCorrupted):
+			r.integrityErrors.Add(1)
+		case err != nil:
+			if ctx.Err() == nil {
+				r.readErrors.Add(1)
+			}
+		case !r.valid(idx, log):
+			r.integrityErrors.Add(1)
+		default:
+			r.reads.Add(1)
+		}
+	}
+}
+
+// verifyStored reads back every committed log, returning how many are
+// missing or corrupted.
+func (r *run) verifyStored() uint64 {
+	var failed uint64
+	log := new(raft.Log)
+	for _, batch := range r.stored {
+		for idx := batch[0]; idx <= batch[1]; idx++ {
+			if err := r.cfg.Store.GetLog(idx, log); err != nil || !r.valid(idx, log) {
+				failed++
+			}
+		}
+	}
+	return failed
+}
+
+func (r *run) valid(idx uint64, log *raft.Log) bool {
+	return log.Index == idx && log.Term == 1 && bytes.Equal(log.Data, payload(idx, r.cfg.DataSize))
+}
+
+// payload returns the data of the log at idx, its index followed by
+// bytes derived from it.
+func payload(idx uint64, size int) []byte {
+	data := make([]byte, size)
+	binary.BigEndian.PutUint64(data, idx)
+	for i := 8; i < size; i++ {
+		data[i] = byte(idx) + byte(i)
+	}
+	return data
+}
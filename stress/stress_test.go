@@ -0,0 +1,92 @@
+package stress
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	raftsqlite "github.com/mauri870/raft-sqlite"
+)
+
+func mustStore(t *testing.T, opts ...raftsqlite.Option) *raftsqlite.SqliteStore {
+	t.Helper()
+
+	store, err := raftsqlite.NewStoreWithOptions(t.TempDir()+"/raft.db", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStressTest(t *testing.T) {
+	store := mustStore(t)
+
+	res, err := StressTest(context.Background(), StressConfig{
+		Store:     store,
+		Writers:   2,
+		Readers:   4,
+		BatchSize: 8,
+		DataSize:  128,
+		Duration:  200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.IntegrityErrors != 0 {
+		t.Fatalf("want no integrity errors, got: %d", res.IntegrityErrors)
+	}
+	if res.Writes == 0 || res.Reads == 0 {
+		t.Fatalf("want writes and reads, got: %d and %d", res.Writes, res.Reads)
+	}
+	if res.WriteErrors != 0 || res.ReadErrors != 0 {
+		t.Fatalf("want no errors, got: %d write and %d read errors", res.WriteErrors, res.ReadErrors)
+	}
+
+	// every committed log is in the store
+	last, err := store.LastIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := store.CountLogs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != res.Writes || last < res.Writes {
+		t.Fatalf("want %d logs, got: %d up to index %d", res.Writes, count, last)
+	}
+	if res.WriteThroughput() <= 0 {
+		t.Fatalf("want a write throughput, got: %f", res.WriteThroughput())
+	}
+}
+
+func TestStressTestCancel(t *testing.T) {
+	store := mustStore(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	res, err := StressTest(ctx, StressConfig{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("want the run to stop on cancellation, took: %v", elapsed)
+	}
+	if res.IntegrityErrors != 0 {
+		t.Fatalf("want no integrity errors, got: %d", res.IntegrityErrors)
+	}
+}
+
+func TestStressTestInvalidConfig(t *testing.T) {
+	_, err := StressTest(context.Background(), StressConfig{})
+	if err == nil {
+		t.Fatal("want error for nil store")
+	}
+
+	_, err = StressTest(context.Background(), StressConfig{Store: mustStore(t), Writers: -1})
+	if err == nil {
+		t.Fatal("want error for negative writers")
+	}
+}
@@ -0,0 +1,57 @@
+package raftsqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SetWithTTL is like Set, but the key expires after ttl. Expired keys
+// are treated as absent by the read methods, and are deleted by the
+// sweeper enabled with WithTTLSweeper. Setting the key again with Set
+// removes its expiration.
+func (s *SqliteStore) SetWithTTL(k, v []byte, ttl time.Duration) error {
+	if s.opts.readOnly {
+		return ErrReadOnly
+	}
+
+	v, err := s.sealValue(v)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := s.opts.clock.Now().Add(ttl)
+	return s.transaction(func(tx *sql.Tx) error {
+		return s.setSealedTTLTx(tx, k, v, expiresAt)
+	})
+}
+
+// setSealedTTLTx sets k to the sealed value v within tx, expiring at
+// expiresAt.
+func (s *SqliteStore) setSealedTTLTx(tx *sql.Tx, k, v []byte, expiresAt time.Time) error {
+	_, err := tx.Exec(fmt.Sprintf("INSERT OR REPLACE INTO %s (key, value, expires_at) VALUES (?, ?, ?)", s.opts.kvTable), k, v, expiresAt.UnixNano())
+	return err
+}
+
+// deleteExpired removes the expired keys, returning how many were
+// deleted.
+func (s *SqliteStore) deleteExpired() (int64, error) {
+	var deleted int64
+	err := s.transaction(func(tx *sql.Tx) error {
+		res, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE expires_at <= ?", s.opts.kvTable), s.opts.clock.Now().UnixNano())
+		if err != nil {
+			return err
+		}
+
+		deleted, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if deleted > 0 {
+		s.opts.logger.Debug("deleted expired keys", "count", deleted)
+	}
+	return deleted, nil
+}
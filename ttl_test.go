@@ -0,0 +1,74 @@
+package raftsqlite
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSetWithTTL(t *testing.T) {
+	clock := newFakeClock()
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithClock(clock))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err = store.SetWithTTL([]byte("lease"), []byte("node1"), time.Minute)
+	assertNoError(t, err)
+	err = store.Set([]byte("term"), []byte("1"))
+	assertNoError(t, err)
+
+	val, err := store.Get([]byte("lease"))
+	assertNoError(t, err)
+	assert(t, string(val) == "node1", fmt.Sprintf("want node1, got: %s", val))
+
+	clock.Advance(time.Minute)
+
+	_, err = store.Get([]byte("lease"))
+	assert(t, err == ErrKeyNotFound, fmt.Sprintf("want not found err, got: %v", err))
+
+	values, err := store.GetMany([][]byte{[]byte("lease"), []byte("term")})
+	assertNoError(t, err)
+	assert(t, len(values) == 1, fmt.Sprintf("want 1 value, got: %d", len(values)))
+
+	keys, err := store.Keys()
+	assertNoError(t, err)
+	assert(t, len(keys) == 1 && string(keys[0]) == "term", fmt.Sprintf("want only the term key, got: %q", keys))
+
+	// setting the key again without a ttl makes it permanent
+	err = store.Set([]byte("lease"), []byte("node2"))
+	assertNoError(t, err)
+	clock.Advance(time.Hour)
+	val, err = store.Get([]byte("lease"))
+	assertNoError(t, err)
+	assert(t, string(val) == "node2", fmt.Sprintf("want node2, got: %s", val))
+}
+
+func TestTTLSweeper(t *testing.T) {
+	clock := newFakeClock()
+	store, err := NewStoreWithOptions(t.TempDir()+"/raft.db", WithClock(clock), WithTTLSweeper(5*time.Millisecond))
+	assertNoError(t, err)
+	defer func() {
+		store.Close()
+		store.deleteDB()
+	}()
+
+	err = store.SetWithTTL([]byte("lease"), []byte("node1"), time.Minute)
+	assertNoError(t, err)
+	err = store.Set([]byte("term"), []byte("1"))
+	assertNoError(t, err)
+
+	clock.Advance(time.Minute)
+
+	var count int
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		err := store.db.QueryRow("SELECT COUNT(*) FROM kv").Scan(&count)
+		assertNoError(t, err)
+		if count == 1 {
+			break
+		}
+	}
+	assert(t, count == 1, fmt.Sprintf("want the expired key to be swept, got %d keys", count))
+}
@@ -3,6 +3,7 @@ package raftsqlite
 import (
 	"bytes"
 	"encoding/binary"
+	"strings"
 
 	"github.com/hashicorp/go-msgpack/v2/codec"
 )
@@ -36,3 +37,22 @@ func uint64ToBytes(u uint64) []byte {
 	binary.BigEndian.PutUint64(buf, u)
 	return buf
 }
+
+// Returns the smallest key greater than every key starting with prefix,
+// or nil if there is none
+func prefixUpperBound(prefix []byte) []byte {
+	upper := bytes.Clone(prefix)
+	for i := len(upper) - 1; i >= 0; i-- {
+		if upper[i] < 0xff {
+			upper[i]++
+			return upper[:i+1]
+		}
+	}
+	return nil
+}
+
+// quoteString returns s as a SQL string literal, for the statements
+// which can't take it as an argument
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}